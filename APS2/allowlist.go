@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Verifica se o host da URL está na lista de permitidos. Padrões "*.dominio"
+// aceitam qualquer subdomínio, mas não o próprio domínio.
+func checkAllowedHost(rawURL string, patterns []string) error {
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := strings.ToLower(u.Hostname())
+
+	for _, pattern := range patterns {
+		if hostMatches(host, strings.ToLower(pattern)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("host %q não está na lista de permitidos (-allow-host)", host)
+}
+
+func hostMatches(host, pattern string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
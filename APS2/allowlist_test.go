@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCheckAllowedHost(t *testing.T) {
+	tests := []struct {
+		url      string
+		patterns []string
+		ok       bool
+	}{
+		{"https://cdn.exemplo.com/a.iso", nil, true},
+		{"https://cdn.exemplo.com/a.iso", []string{"cdn.exemplo.com"}, true},
+		{"https://CDN.Exemplo.com:8443/a.iso", []string{"cdn.exemplo.com"}, true},
+		{"https://cdn.exemplo.com/a.iso", []string{"*.exemplo.com"}, true},
+		{"https://a.b.exemplo.com/a.iso", []string{"*.EXEMPLO.com"}, true},
+		// O curinga não cobre o próprio domínio nem sufixos parecidos
+		{"https://exemplo.com/a.iso", []string{"*.exemplo.com"}, false},
+		{"https://malexemplo.com/a.iso", []string{"*.exemplo.com"}, false},
+		{"https://exemplo.com.evil.net/a.iso", []string{"exemplo.com", "*.exemplo.com"}, false},
+		{"https://outro.net/a.iso", []string{"exemplo.com", "*.outro.net", "outro.net"}, true},
+	}
+	for _, tt := range tests {
+		err := checkAllowedHost(tt.url, tt.patterns)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s com %q: %v, esperado ok=%v", tt.url, tt.patterns, err, tt.ok)
+		}
+	}
+}
+
+// A lista vale para a URL final, depois dos redirecionamentos: um destino
+// fora dela falha antes de criar o arquivo ou pedir faixas
+func TestAllowedHostAfterRedirect(t *testing.T) {
+	data := testData(10000)
+	target := newRangeServer(t, data)
+	// O destino é acessado por outro nome, para ter um host diferente do
+	// redirecionador
+	targetURL, _ := url.Parse(target.fileURL())
+	targetURL.Host = strings.Replace(targetURL.Host, "127.0.0.1", "localhost", 1)
+	redirect := httptest.NewServer(http.RedirectHandler(targetURL.String(), http.StatusFound))
+	defer redirect.Close()
+
+	t.Run("permitido", func(t *testing.T) {
+		cfg := testConfig(t, redirect.URL+"/arquivo.bin")
+		cfg.AllowedHosts = []string{"localhost"}
+		if _, _, err := runDownload(context.Background(), cfg); err != nil {
+			t.Fatal(err)
+		}
+		checkFile(t, cfg.Output, data)
+	})
+
+	t.Run("recusado", func(t *testing.T) {
+		before := countRanged(target.Requests())
+		cfg := testConfig(t, redirect.URL+"/arquivo.bin")
+		// Só o host de origem: o redirecionamento sai da lista
+		cfg.AllowedHosts = []string{"127.0.0.1", "*.localhost"}
+		_, _, err := runDownload(context.Background(), cfg)
+		if err == nil || !strings.Contains(err.Error(), "localhost") {
+			t.Fatalf("erro %v, esperado host localhost fora da lista", err)
+		}
+		if _, err := os.Stat(cfg.Output); !os.IsNotExist(err) {
+			t.Error("arquivo criado para um host recusado")
+		}
+		if n := countRanged(target.Requests()) - before; n != 0 {
+			t.Errorf("%d faixas pedidas ao host recusado", n)
+		}
+	})
+}
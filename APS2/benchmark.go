@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Resultado de uma execução do benchmark
+type runResult struct {
+	Duration time.Duration
+	// Tamanho do arquivo remoto
+	Bytes int64
+	Err   error
+}
+
+// Velocidade efetiva da execução em MB/s
+func (r runResult) speedMB() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) / (1024 * 1024) / r.Duration.Seconds()
+}
+
+type benchmarkStats struct {
+	Runs   int
+	Failed int
+	Min    time.Duration
+	Max    time.Duration
+	Mean   time.Duration
+	Median time.Duration
+	P95    time.Duration
+	StdDev time.Duration
+	// Velocidade média em MB/s, calculada pelo tamanho/duração de cada execução
+	SpeedMB float64
+}
+
+// Estatísticas das execuções bem-sucedidas; as que falharam só entram na
+// contagem, já que a duração delas não diz nada sobre a velocidade
+func computeStats(results []runResult) benchmarkStats {
+	stats := benchmarkStats{Runs: len(results)}
+
+	var durations []time.Duration
+	var speed float64
+	for _, r := range results {
+		if r.Err != nil {
+			stats.Failed++
+			continue
+		}
+		durations = append(durations, r.Duration)
+		speed += r.speedMB()
+	}
+	if len(durations) == 0 {
+		return stats
+	}
+	slices.Sort(durations)
+
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	n := len(durations)
+	stats.Min = durations[0]
+	stats.Max = durations[n-1]
+	stats.Mean = total / time.Duration(n)
+	stats.Median = percentile(durations, 50)
+	stats.P95 = percentile(durations, 95)
+	stats.SpeedMB = speed / float64(n)
+
+	var variance float64
+	for _, d := range durations {
+		diff := float64(d - stats.Mean)
+		variance += diff * diff
+	}
+	stats.StdDev = time.Duration(math.Sqrt(variance / float64(n)))
+	return stats
+}
+
+// Percentil p (0-100) de durações já ordenadas, interpolando entre as duas
+// amostras mais próximas
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(rank)
+	if lo >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	frac := rank - float64(lo)
+	return sorted[lo] + time.Duration(frac*float64(sorted[lo+1]-sorted[lo]))
+}
+
+// Execuções iniciais tratadas como aquecimento (-warmup): pagam DNS, TCP e
+// TLS, que as seguintes reaproveitam do pool de conexões do cliente
+const defaultWarmupRuns = 1
+
+// Estatísticas de todas as execuções e, com aquecimento, as das execuções de
+// aquecimento e as do regime separadamente
+func logBenchmarkStats(results []runResult, warmup int) {
+	logRunStats("Estatísticas das execuções", results)
+	if warmup <= 0 || warmup >= len(results) {
+		return
+	}
+	logRunStats("Estatísticas do aquecimento", results[:warmup])
+	logRunStats("Estatísticas do regime", results[warmup:])
+}
+
+func logRunStats(msg string, results []runResult) {
+	stats := computeStats(results)
+	if stats.Failed == stats.Runs {
+		slog.Error("Nenhuma execução concluída", "execucoes", stats.Runs)
+		return
+	}
+
+	round := func(d time.Duration) time.Duration { return d.Round(time.Microsecond) }
+	slog.Info(msg,
+		"execucoes", stats.Runs,
+		"falhas", stats.Failed,
+		"min", round(stats.Min),
+		"max", round(stats.Max),
+		"media", round(stats.Mean),
+		"mediana", round(stats.Median),
+		"p95", round(stats.P95),
+		"desvio", round(stats.StdDev),
+		"mbps", math.Round(stats.SpeedMB*100)/100,
+	)
+}
+
+// Grava uma linha por execução em CSV (-csv), para comparar a variação entre
+// execuções e configurações sem depender dos logs
+func writeBenchmarkCSV(path string, results []runResult, warmup int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"run", "duration_seconds", "bytes", "speed_mbps", "error", "warmup"})
+	for i, r := range results {
+		var errMsg string
+		if r.Err != nil {
+			errMsg = r.Err.Error()
+		}
+		w.Write([]string{
+			strconv.Itoa(i + 1),
+			strconv.FormatFloat(r.Duration.Seconds(), 'f', 6, 64),
+			strconv.FormatInt(r.Bytes, 10),
+			strconv.FormatFloat(r.speedMB(), 'f', 3, 64),
+			errMsg,
+			strconv.FormatBool(i < warmup),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("erro gravando CSV: %w", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Algoritmo usado quando -algo não é informado, e sempre no histórico, nos
+// atributos estendidos, nos manifestos e em -hash-url
+const defaultAlgo = "sha256"
+
+// Algoritmos aceitos por -algo
+var hashAlgos = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+func newHash(algo string) hash.Hash {
+	return hashAlgos[algo]()
+}
+
+func (c Config) algo() string {
+	if c.Algo == "" {
+		return defaultAlgo
+	}
+	return c.Algo
+}
+
+// Confere o algoritmo e se o checksum esperado tem o tamanho do digest dele,
+// para que um hash colado errado falhe antes do download
+func checkDigest(algo, expected string) error {
+	newFn, ok := hashAlgos[algo]
+	if !ok {
+		return fmt.Errorf("algoritmo de checksum desconhecido: %s (use md5, sha1, sha256 ou sha512)", algo)
+	}
+	if expected == "" {
+		return nil
+	}
+	expected = strings.TrimSpace(expected)
+	if size := newFn().Size() * 2; len(expected) != size {
+		return fmt.Errorf("checksum %s deve ter %d dígitos hexadecimais, recebido %d", algo, size, len(expected))
+	}
+	if _, err := hex.DecodeString(expected); err != nil {
+		return fmt.Errorf("checksum %s inválido: %q", algo, expected)
+	}
+	return nil
+}
+
+// Calcula o digest do arquivo no algoritmo pedido
+func fileDigest(path, algo string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := newHash(algo)
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Calcula o SHA-256 do arquivo baixado
+func fileChecksum(path string) (string, error) {
+	return fileDigest(path, defaultAlgo)
+}
+
+// Digest do arquivo baixado. No fluxo único usa o digest calculado durante
+// a cópia, no algoritmo de -algo; com chunks fora de ordem, ou em outro
+// algoritmo, é preciso ler o arquivo ao final.
+func (d *download) digest(algo string) (string, error) {
+	if algo == d.cfg.algo() && d.streamDigest != "" {
+		return d.streamDigest, nil
+	}
+	sum, err := fileDigest(d.cfg.Output, algo)
+	if err != nil {
+		return "", fmt.Errorf("erro calculando checksum: %w", err)
+	}
+	if algo == d.cfg.algo() {
+		d.streamDigest = sum
+	}
+	return sum, nil
+}
+
+// Compara o arquivo baixado com o checksum esperado
+func (d *download) verifyChecksum() error {
+	return d.compareChecksum(d.cfg.algo(), d.cfg.Checksum)
+}
+
+// Grava o digest em path no formato do sha256sum ("<digest>  <arquivo>"),
+// com o nome do arquivo sem o diretório, para conferir com sha256sum -c na
+// mesma pasta
+func writeChecksumFile(path, algo, sum, output string) error {
+	line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(output))
+	if err := os.WriteFile(path, []byte(line), 0644); err != nil {
+		return fmt.Errorf("erro gravando -checksum-output: %w", err)
+	}
+	slog.Info("Checksum gravado", "arquivo", path, algo, sum)
+	return nil
+}
+
+// Grava o digest do arquivo baixado, no algoritmo de -algo, em
+// -checksum-output
+func (d *download) writeChecksumOutput() error {
+	algo := d.cfg.algo()
+	sum, err := d.digest(algo)
+	if err != nil {
+		return err
+	}
+	return writeChecksumFile(d.cfg.ChecksumOutput, algo, sum, d.cfg.Output)
+}
+
+func (d *download) compareChecksum(algo, expected string) error {
+	actual, err := d.digest(algo)
+	if err != nil {
+		return err
+	}
+
+	expected = strings.ToLower(strings.TrimSpace(expected))
+	if actual != expected {
+		return fmt.Errorf("checksum não confere: esperado %s, obtido %s", expected, actual)
+	}
+
+	slog.Info("Checksum verificado", algo, actual)
+	return nil
+}
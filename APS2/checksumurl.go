@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Valor de -checksum-url que tenta <url>.sha256 e depois <url>.md5
+const checksumURLAuto = "auto"
+
+var errNoSidecar = errors.New("arquivo de checksum não encontrado")
+
+// Algoritmo do checksum pela extensão do arquivo publicado ao lado do
+// download (.md5, .sha1, .sha256, .sha512); sem extensão conhecida assume
+// SHA-256
+func sidecarAlgorithm(url string) string {
+	ext := strings.ToLower(path.Ext(strings.SplitN(url, "?", 2)[0]))
+	if _, ok := hashAlgos[strings.TrimPrefix(ext, ".")]; ok {
+		return strings.TrimPrefix(ext, ".")
+	}
+	return defaultAlgo
+}
+
+// Lê o digest de um arquivo no formato do sha256sum/md5sum. Com várias
+// linhas usa a do arquivo baixado; com uma só aceita o digest sozinho.
+func parseSidecar(body, algo, fileName string) (string, error) {
+	size := newHash(algo).Size() * 2
+
+	var lines [][]string
+	for _, line := range strings.Split(body, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && !strings.HasPrefix(fields[0], "#") {
+			lines = append(lines, fields)
+		}
+	}
+
+	var sum string
+	switch {
+	case len(lines) == 1:
+		sum = lines[0][0]
+	default:
+		for _, fields := range lines {
+			if len(fields) >= 2 && strings.TrimPrefix(fields[1], "*") == fileName {
+				sum = fields[0]
+				break
+			}
+		}
+	}
+	if sum == "" {
+		return "", fmt.Errorf("nenhum %s para %s no arquivo de checksum", algo, fileName)
+	}
+
+	sum = strings.ToLower(sum)
+	if len(sum) != size || strings.Trim(sum, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("%s inválido no arquivo de checksum: %q", algo, sum)
+	}
+	return sum, nil
+}
+
+func fetchSidecar(ctx context.Context, cfg Config, url string) (string, error) {
+	req, err := newRequest(ctx, cfg, "GET", url)
+	if err != nil {
+		return "", err
+	}
+	resp, err := cfg.do(req)
+	if err != nil {
+		return "", fmt.Errorf("erro buscando checksum: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone:
+		return "", fmt.Errorf("%w: %s", errNoSidecar, url)
+	default:
+		return "", fmt.Errorf("erro buscando checksum %s: %s", url, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("erro lendo checksum: %w", err)
+	}
+	return string(body), nil
+}
+
+// Busca o checksum esperado de -checksum-url antes do download e o coloca em
+// cfg.Checksum, com o algoritmo da extensão em cfg.Algo
+func withSidecarChecksum(ctx context.Context, cfg Config) (Config, error) {
+	candidates := []string{cfg.ChecksumURL}
+	if cfg.ChecksumURL == checksumURLAuto {
+		candidates = []string{cfg.URL + ".sha256", cfg.URL + ".md5"}
+	}
+
+	for _, url := range candidates {
+		body, err := fetchSidecar(ctx, cfg, url)
+		if errors.Is(err, errNoSidecar) && len(candidates) > 1 {
+			continue
+		}
+		if err != nil {
+			return cfg, err
+		}
+
+		algo := sidecarAlgorithm(url)
+		sum, err := parseSidecar(body, algo, getFileName(cfg.URL))
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Checksum, cfg.Algo = sum, algo
+		slog.Info("Checksum esperado obtido", "url", url, algo, sum)
+		return cfg, nil
+	}
+	return cfg, fmt.Errorf("%w: %s", errNoSidecar, strings.Join(candidates, ", "))
+}
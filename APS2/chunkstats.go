@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Resultado de um chunk para o resumo de -stats
+type chunkStat struct {
+	start, end int64
+	bytes      int64
+	duration   time.Duration
+	attempts   int
+	err        error
+}
+
+func (s chunkStat) speedMBps() float64 {
+	if s.duration <= 0 {
+		return 0
+	}
+	return float64(s.bytes) / 1024 / 1024 / s.duration.Seconds()
+}
+
+// Estatísticas dos chunks de um download; nil desativa a coleta
+type chunkStats struct {
+	mu    sync.Mutex
+	stats []chunkStat
+}
+
+func (c *chunkStats) add(s chunkStat) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.stats = append(c.stats, s)
+	c.mu.Unlock()
+}
+
+// Escreve a tabela com faixa, bytes, duração e velocidade de cada chunk, em
+// ordem de posição no arquivo, e destaca o chunk mais lento
+func (c *chunkStats) write(w io.Writer) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.stats) == 0 {
+		return
+	}
+	sort.Slice(c.stats, func(i, j int) bool { return c.stats[i].start < c.stats[j].start })
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "faixa\tbytes\tduração\tMB/s\ttentativas\t")
+	slowest := c.stats[0]
+	for _, s := range c.stats {
+		status := ""
+		if s.err != nil {
+			status = "  falhou"
+		}
+		fmt.Fprintf(tw, "%d-%d\t%d\t%s\t%.2f\t%d\t%s\n",
+			s.start, s.end, s.bytes, s.duration.Round(time.Millisecond), s.speedMBps(), s.attempts, status)
+		if s.duration > slowest.duration {
+			slowest = s
+		}
+	}
+	tw.Flush()
+
+	if len(c.stats) > 1 {
+		slog.Info("Chunk mais lento", "inicio", slowest.start, "fim", slowest.end, "duracao", slowest.duration.Round(time.Millisecond), "mbps", math.Round(slowest.speedMBps()*100)/100)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Chaves do arquivo de -config que substituem os argumentos posicionais
+var positionalKeys = []string{"url", "threads", "limit"}
+
+// Valores de um arquivo de configuração, por nome de opção. Listas e mapas
+// viram vários valores, como se a opção fosse repetida; um mapa em "header"
+// vira "Chave: Valor".
+type configValues map[string][]string
+
+// Lê o arquivo de -config, em JSON (.json) ou YAML (.yaml, .yml). As chaves
+// são os nomes das opções da linha de comando, mais url, threads e limit.
+func loadConfigFile(path string) (configValues, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("erro lendo -config: %w", err)
+	}
+
+	var values configValues
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		values, err = parseConfigJSON(data)
+	case ".yaml", ".yml":
+		values, err = parseConfigYAML(string(data))
+	default:
+		return nil, fmt.Errorf("formato de -config não reconhecido: %q (use .json, .yaml ou .yml)", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro em %s: %w", path, err)
+	}
+	return values, nil
+}
+
+func parseConfigJSON(data []byte) (configValues, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	values := configValues{}
+	for key, v := range raw {
+		switch v := v.(type) {
+		case []any:
+			for _, item := range v {
+				s, err := configScalar(key, item)
+				if err != nil {
+					return nil, err
+				}
+				values[key] = append(values[key], s)
+			}
+		case map[string]any:
+			for _, name := range sortedKeys(v) {
+				s, err := configScalar(key, v[name])
+				if err != nil {
+					return nil, err
+				}
+				values[key] = append(values[key], name+": "+s)
+			}
+		default:
+			s, err := configScalar(key, v)
+			if err != nil {
+				return nil, err
+			}
+			values[key] = []string{s}
+		}
+	}
+	return values, nil
+}
+
+func configScalar(key string, v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("valor inválido para %s: %v", key, v)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Lê o subconjunto de YAML usado em arquivos de configuração: "chave: valor"
+// no primeiro nível e, abaixo de uma chave sem valor, itens "- valor" ou
+// pares "Chave: Valor" indentados. Comentários com # são ignorados. O resto
+// do YAML (mapas e listas entre chaves e colchetes, âncoras, valores em
+// várias linhas) é recusado em vez de virar um valor estranho.
+func parseConfigYAML(data string) (configValues, error) {
+	values := configValues{}
+	var current string
+
+	for n, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if trimmed == "---" || trimmed == "..." {
+			return nil, fmt.Errorf("linha %d: vários documentos YAML não são aceitos", n+1)
+		}
+
+		if line[0] == ' ' || line[0] == '\t' {
+			if current == "" {
+				return nil, fmt.Errorf("linha %d: item indentado fora de uma chave", n+1)
+			}
+			if item, ok := strings.CutPrefix(trimmed, "- "); ok {
+				v, err := yamlScalar(item)
+				if err != nil {
+					return nil, fmt.Errorf("linha %d: %w", n+1, err)
+				}
+				values[current] = append(values[current], v)
+				continue
+			}
+			name, value, ok := strings.Cut(trimmed, ":")
+			if !ok {
+				return nil, fmt.Errorf("linha %d: esperado \"- valor\" ou \"Chave: Valor\"", n+1)
+			}
+			name = strings.TrimSpace(name)
+			if err := yamlKey(name); err != nil {
+				return nil, fmt.Errorf("linha %d: %w", n+1, err)
+			}
+			if strings.TrimSpace(value) == "" {
+				return nil, fmt.Errorf("linha %d: %s sem valor; só um nível de indentação é aceito", n+1, name)
+			}
+			v, err := yamlScalar(value)
+			if err != nil {
+				return nil, fmt.Errorf("linha %d: %w", n+1, err)
+			}
+			values[current] = append(values[current], name+": "+v)
+			continue
+		}
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("linha %d: esperado \"chave: valor\"", n+1)
+		}
+		key = strings.TrimSpace(key)
+		if err := yamlKey(key); err != nil {
+			return nil, fmt.Errorf("linha %d: %w", n+1, err)
+		}
+		if value = strings.TrimSpace(value); value == "" {
+			current = key
+			continue
+		}
+		current = ""
+		v, err := yamlScalar(value)
+		if err != nil {
+			return nil, fmt.Errorf("linha %d: %w", n+1, err)
+		}
+		values[key] = []string{v}
+	}
+	return values, nil
+}
+
+// Uma chave começando por esses caracteres é uma construção de YAML que o
+// leitor não entende, como "{A: b}" ou "- item" no primeiro nível
+func yamlKey(key string) error {
+	if key == "" || strings.ContainsAny(key[:1], "{}[]&*!|>-?\"'%@`") {
+		return fmt.Errorf("chave não suportada: %q", key)
+	}
+	return nil
+}
+
+// Tira as aspas de um valor YAML ou, sem aspas, um comentário no fim da
+// linha. Valores que começam com um indicador de YAML sem suporte aqui
+// (mapa ou lista entre chaves e colchetes, âncora, alias, tag, bloco em
+// várias linhas) dão erro; para usá-los como texto, ponha entre aspas.
+func yamlScalar(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s != "" && (s[0] == '"' || s[0] == '\'') {
+		if len(s) < 2 || s[len(s)-1] != s[0] {
+			return "", fmt.Errorf("aspas sem fechar em %s", s)
+		}
+		if s[0] == '"' {
+			unquoted, err := strconv.Unquote(s)
+			if err != nil {
+				return "", fmt.Errorf("valor entre aspas inválido: %s", s)
+			}
+			return unquoted, nil
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	if s != "" && strings.ContainsAny(s[:1], "{}[]&*!|>%@`") {
+		return "", fmt.Errorf("valor não suportado: %s (use aspas para um texto)", s)
+	}
+	return s, nil
+}
+
+// Aplica os valores do arquivo às opções que não foram passadas na linha de
+// comando, que sempre têm prioridade
+func applyConfigFile(fs *flag.FlagSet, values configValues) error {
+	onCLI := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { onCLI[f.Name] = true })
+
+	for _, name := range sortedKeys(values) {
+		if slices.Contains(positionalKeys, name) {
+			continue
+		}
+		if name == "config" || fs.Lookup(name) == nil {
+			return fmt.Errorf("opção desconhecida em -config: %s", name)
+		}
+		if onCLI[name] {
+			continue
+		}
+		for _, v := range values[name] {
+			if err := fs.Set(name, v); err != nil {
+				return fmt.Errorf("valor inválido para %s em -config: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Argumentos posicionais do arquivo, usados quando a linha de comando não
+// tem nenhum: url (sem -input), threads (padrão auto) e limit (padrão 0)
+func (v configValues) positional(withURL bool) []string {
+	var args []string
+	if withURL {
+		if len(v["url"]) == 0 {
+			return nil
+		}
+		args = append(args, v["url"][0])
+	}
+	return append(args, firstOr(v["threads"], "auto"), firstOr(v["limit"], "0"))
+}
+
+func firstOr(values []string, fallback string) string {
+	if len(values) == 0 {
+		return fallback
+	}
+	return values[0]
+}
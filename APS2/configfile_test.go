@@ -0,0 +1,160 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigJSON(t *testing.T) {
+	tests := []struct {
+		name, in string
+		want     configValues
+		err      string
+	}{
+		{
+			name: "escalares",
+			in:   `{"url": "http://x/a", "threads": 8, "limit": 1.5, "insecure": true}`,
+			want: configValues{"url": {"http://x/a"}, "threads": {"8"}, "limit": {"1.5"}, "insecure": {"true"}},
+		},
+		{
+			name: "lista",
+			in:   `{"mirror": ["http://a/f", "http://b/f"]}`,
+			want: configValues{"mirror": {"http://a/f", "http://b/f"}},
+		},
+		{
+			name: "mapa em ordem de chave",
+			in:   `{"header": {"X-B": "2", "X-A": "1"}}`,
+			want: configValues{"header": {"X-A: 1", "X-B: 2"}},
+		},
+		{name: "objeto aninhado", in: `{"header": {"X-A": {"b": 1}}}`, err: "valor inválido para header"},
+		{name: "nulo", in: `{"threads": null}`, err: "valor inválido para threads"},
+		{name: "JSON inválido", in: `{"url": `, err: "unexpected end"},
+	}
+	for _, tt := range tests {
+		got, err := parseConfigJSON([]byte(tt.in))
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: erro %v, esperado %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %v, esperado %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseConfigYAML(t *testing.T) {
+	tests := []struct {
+		name, in string
+		want     configValues
+		err      string
+	}{
+		{
+			name: "escalares e comentários",
+			in:   "# download\nurl: http://x/a:b # comentário\nthreads: 8\n\nlimit: '2'\n",
+			want: configValues{"url": {"http://x/a:b"}, "threads": {"8"}, "limit": {"2"}},
+		},
+		{
+			name: "aspas",
+			in:   "user-agent: \"a # b\\tc\"\noutput: 'it''s.bin'\n",
+			want: configValues{"user-agent": {"a # b\tc"}, "output": {"it's.bin"}},
+		},
+		{
+			name: "lista e mapa indentados",
+			in:   "mirror:\n  - http://a/f\n  - \"http://b/f\"\nheader:\n  X-A: 1\n  Authorization: Bearer x\n",
+			want: configValues{"mirror": {"http://a/f", "http://b/f"}, "header": {"X-A: 1", "Authorization: Bearer x"}},
+		},
+		{
+			name: "valor entre aspas com indicador",
+			in:   "header:\n  X-A: \"{b}\"\n",
+			want: configValues{"header": {"X-A: {b}"}},
+		},
+		{name: "mapa entre chaves", in: "header: {A: b}\n", err: "linha 1: valor não suportado"},
+		{name: "lista entre colchetes", in: "mirror: [http://a/f, http://b/f]\n", err: "linha 1: valor não suportado"},
+		{name: "lista entre colchetes indentada", in: "mirror:\n  - [a, b]\n", err: "linha 2: valor não suportado"},
+		{name: "âncora", in: "output: &nome a.bin\n", err: "valor não suportado"},
+		{name: "alias", in: "output: *nome\n", err: "valor não suportado"},
+		{name: "bloco literal", in: "header: |\n  A: b\n", err: "valor não suportado"},
+		{name: "bloco dobrado", in: "user-agent: >\n  a b\n", err: "valor não suportado"},
+		{name: "tag", in: "threads: !!int 8\n", err: "valor não suportado"},
+		{name: "chave entre chaves", in: "{header: a}\n", err: "chave não suportada"},
+		{name: "lista no primeiro nível", in: "- a: b\n", err: "chave não suportada"},
+		{name: "dois níveis", in: "header:\n  X-A:\n    b: c\n", err: "linha 2: X-A sem valor"},
+		{name: "vários documentos", in: "url: a\n---\nurl: b\n", err: "linha 2: vários documentos"},
+		{name: "aspas sem fechar", in: "output: \"a.bin\n", err: "aspas sem fechar"},
+		{name: "indentação sem chave", in: "  - a\n", err: "item indentado fora de uma chave"},
+		{name: "sem dois-pontos", in: "url\n", err: "esperado \"chave: valor\""},
+	}
+	for _, tt := range tests {
+		got, err := parseConfigYAML(tt.in)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: erro %v, esperado %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %v, esperado %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// A linha de comando tem prioridade sobre o arquivo, inclusive nas opções
+// repetíveis, e o arquivo preenche o resto
+func TestConfigFilePrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "download.yaml")
+	yaml := "url: http://x/a\nthreads: 8\noutput: arquivo.bin\nretries: 5\nheader:\n  X-Arquivo: 1\n"
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	values, err := loadConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output string
+	var retries int
+	header := http.Header{}
+	fs := flag.NewFlagSet("teste", flag.ContinueOnError)
+	fs.StringVar(&output, "output", "", "")
+	fs.IntVar(&retries, "retries", 3, "")
+	fs.Var(headerFlag(header), "header", "")
+	if err := fs.Parse([]string{"-output", "cli.bin", "-header", "X-Cli: 2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := applyConfigFile(fs, values); err != nil {
+		t.Fatal(err)
+	}
+	if output != "cli.bin" {
+		t.Errorf("output %q, esperado o da linha de comando", output)
+	}
+	if retries != 5 {
+		t.Errorf("retries %d, esperado 5 do arquivo", retries)
+	}
+	if got := header; len(got) != 1 || got.Get("X-Cli") != "2" {
+		t.Errorf("cabeçalhos %v, esperado só o da linha de comando", got)
+	}
+	if got, want := values.positional(true), []string{"http://x/a", "8", "0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("argumentos %v, esperado %v", got, want)
+	}
+
+	values["nao-existe"] = []string{"1"}
+	if err := applyConfigFile(fs, values); err == nil || !strings.Contains(err.Error(), "opção desconhecida") {
+		t.Errorf("erro %v para opção desconhecida", err)
+	}
+}
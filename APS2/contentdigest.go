@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+var errChunkDigest = errors.New("Content-Digest não confere")
+
+// Algoritmos do Content-Digest (RFC 9530) aceitos, do mais forte ao mais
+// fraco
+var contentDigestAlgos = []struct {
+	name string
+	new  func() hash.Hash
+}{
+	{"sha-512", sha512.New},
+	{"sha-256", sha256.New},
+}
+
+// Digest que o servidor anunciou para o corpo desta resposta, no formato
+// "sha-256=:<base64>:". Só o Content-Digest serve para conferir uma faixa:
+// o Repr-Digest é do arquivo inteiro, não dos bytes de um 206.
+type contentDigest struct {
+	algo string
+	want []byte
+	h    hash.Hash
+}
+
+// Lê o Content-Digest da resposta; nil se ausente ou sem algoritmo
+// conhecido, caso em que a faixa é aceita sem conferência
+func parseContentDigest(h http.Header) *contentDigest {
+	sums := map[string][]byte{}
+	for _, v := range h.Values("Content-Digest") {
+		for _, item := range strings.Split(v, ",") {
+			name, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+			if !ok || len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+				continue
+			}
+			sum, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+			if err != nil {
+				continue
+			}
+			sums[strings.ToLower(strings.TrimSpace(name))] = sum
+		}
+	}
+
+	for _, a := range contentDigestAlgos {
+		if sum, ok := sums[a.name]; ok {
+			return &contentDigest{algo: a.name, want: sum, h: a.new()}
+		}
+	}
+	return nil
+}
+
+// Recebe os bytes do corpo conforme são copiados
+func (c *contentDigest) Write(p []byte) (int, error) {
+	return c.h.Write(p)
+}
+
+func (c *contentDigest) check(start, end int64) error {
+	if got := c.h.Sum(nil); !bytes.Equal(got, c.want) {
+		return fmt.Errorf("%w na faixa %d-%d (%s)", errChunkDigest, start, end, c.algo)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Tamanho total desconhecido: "*" no Content-Range ou resposta sem
+// Content-Length
+const unknownSize = -1
+
+// Interpreta um cabeçalho "Content-Range: bytes start-end/total". Um total
+// "*" é retornado como unknownSize.
+func parseContentRange(header string) (start, end, total int64, err error) {
+	spec, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("Content-Range inválido: %q", header)
+	}
+
+	rangePart, totalPart, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("Content-Range inválido: %q", header)
+	}
+
+	startStr, endStr, ok := strings.Cut(rangePart, "-")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("Content-Range inválido: %q", header)
+	}
+
+	if start, err = strconv.ParseInt(startStr, 10, 64); err != nil {
+		return 0, 0, 0, fmt.Errorf("Content-Range inválido: %q", header)
+	}
+	if end, err = strconv.ParseInt(endStr, 10, 64); err != nil || end < start {
+		return 0, 0, 0, fmt.Errorf("Content-Range inválido: %q", header)
+	}
+
+	if totalPart == "*" {
+		return start, end, unknownSize, nil
+	}
+	if total, err = strconv.ParseInt(totalPart, 10, 64); err != nil || end >= total {
+		return 0, 0, 0, fmt.Errorf("Content-Range inválido: %q", header)
+	}
+
+	return start, end, total, nil
+}
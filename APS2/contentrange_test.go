@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		header            string
+		start, end, total int64
+		ok                bool
+	}{
+		{"bytes 0-1023/4096", 0, 1023, 4096, true},
+		{"bytes 4095-4095/4096", 4095, 4095, 4096, true},
+		// Total desconhecido
+		{"bytes 0-1023/*", 0, 1023, unknownSize, true},
+		{"bytes */4096", 0, 0, 0, false},
+		{"bytes 0-4096/4096", 0, 0, 0, false},
+		{"bytes 10-5/100", 0, 0, 0, false},
+		{"bytes 0-1023", 0, 0, 0, false},
+		{"items 0-1/2", 0, 0, 0, false},
+		{"", 0, 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, end, total, err := parseContentRange(tt.header)
+		if (err == nil) != tt.ok || start != tt.start || end != tt.end || total != tt.total {
+			t.Errorf("parseContentRange(%q) = %d, %d, %d, %v; esperado %d, %d, %d, ok=%v",
+				tt.header, start, end, total, err, tt.start, tt.end, tt.total, tt.ok)
+		}
+	}
+}
+
+// Servidor que responde faixas com total "*", com ou sem HEAD; sem Range
+// envia o arquivo sem Content-Length. Guarda as requisições como o
+// rangeServer.
+func newStarServer(t *testing.T, data []byte, head bool) (string, func() []string) {
+	var mu sync.Mutex
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, strings.TrimSpace(r.Method+" "+strings.TrimPrefix(r.Header.Get("Range"), "bytes=")))
+		mu.Unlock()
+
+		if r.Method == http.MethodHead {
+			if !head {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			return
+		}
+		start, end, ranged := requestedRange(r.Header.Get("Range"), int64(len(data)))
+		if !ranged {
+			w.Write(data)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/*", start, end))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[start : end+1])
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/arquivo.bin", func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), requests...)
+	}
+}
+
+// Sem HEAD, o GET de sondagem só traz "*" como total: o tamanho fica
+// desconhecido e o arquivo vem num único fluxo, sem faixas
+func TestContentRangeUnknownTotal(t *testing.T) {
+	data := testData(10000)
+	url, requests := newStarServer(t, data, false)
+	cfg := testConfig(t, url)
+
+	size, _, err := runDownload(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(data)) {
+		t.Errorf("tamanho %d, esperado %d", size, len(data))
+	}
+	checkFile(t, cfg.Output, data)
+
+	// Só a sondagem usa Range; o arquivo vem numa requisição sem faixa
+	var ranged, plain int
+	for _, r := range requests() {
+		switch r {
+		case "GET 0-0":
+			ranged++
+		case "GET":
+			plain++
+		}
+	}
+	if ranged != 1 || plain != 1 {
+		t.Errorf("requisições %q, esperadas a sondagem e um único GET sem faixa", requests())
+	}
+}
+
+// Com o tamanho do HEAD, faixas com total "*" são aceitas: o total
+// desconhecido não é comparado com o tamanho do arquivo
+func TestContentRangeStarChunks(t *testing.T) {
+	data := testData(10000)
+	url, requests := newStarServer(t, data, true)
+	cfg := testConfig(t, url)
+
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+	if n := countRanged(requests()); n != int(cfg.Threads) {
+		t.Errorf("%d faixas pedidas, esperadas %d", n, cfg.Threads)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Comandos de -control, lidos um por linha da entrada padrão enquanto o
+// download acontece. Dão à linha de comando os controles que a biblioteca
+// oferece pelo Config: pausa e retomada, a taxa e a rajada do limite de
+// banda e, pelos Hooks, o andamento.
+type controller struct {
+	pause  *PauseControl
+	rl     *RateLimiter
+	status hookStatus
+	// Saída do comando status; a saída padrão pode ser o próprio arquivo
+	// (-output -) ou os eventos de -json
+	out io.Writer
+}
+
+func newController(cfg Config) *controller {
+	return &controller{pause: cfg.Pause, rl: cfg.RateLimiter, out: os.Stderr}
+}
+
+// Lê comandos até o fim da entrada. Um comando inválido é avisado e os
+// seguintes continuam valendo.
+func (c *controller) serve(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if err := c.handle(scanner.Text()); err != nil {
+			slog.Warn("Comando inválido", "erro", err)
+		}
+	}
+}
+
+func (c *controller) handle(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	switch cmd := strings.ToLower(fields[0]); cmd {
+	case "pause":
+		c.pause.Pause()
+		slog.Info("Download pausado")
+	case "resume":
+		c.pause.Resume()
+		slog.Info("Download retomado")
+	case "status":
+		fmt.Fprintln(c.out, c.status.String())
+	case "limit", "burst":
+		if len(fields) != 2 {
+			return fmt.Errorf("use %s <MB>", cmd)
+		}
+		mb, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil || mb < 0 || math.IsNaN(mb) || math.IsInf(mb, 0) {
+			return fmt.Errorf("valor inválido para %s: %q", cmd, fields[1])
+		}
+		bytes := int64(mb * 1024 * 1024)
+		if cmd == "limit" {
+			c.rl.SetRate(bytes)
+			slog.Info("Limite de banda alterado", "MBps", mb)
+		} else {
+			c.rl.SetBurst(bytes)
+			slog.Info("Rajada do limite de banda alterada", "MB", mb)
+		}
+	default:
+		return fmt.Errorf("comando desconhecido %q (use pause, resume, status, limit ou burst)", cmd)
+	}
+	return nil
+}
+
+// Andamento do download acompanhado pelos Hooks, para o comando status. No
+// benchmark cada execução recomeça a contagem no OnStart.
+type hookStatus struct {
+	mu       sync.Mutex
+	started  time.Time
+	total    int64
+	done     int64
+	chunks   int
+	finished int
+	retries  int
+	lastErr  error
+	result   *Result
+}
+
+func (s *hookStatus) hooks() *Hooks {
+	return &Hooks{
+		OnStart: func(total int64) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.started, s.total, s.done = time.Now(), total, 0
+			s.chunks, s.finished, s.retries = 0, 0, 0
+			s.lastErr, s.result = nil, nil
+		},
+		OnChunkStart: func(ByteRange) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.chunks++
+		},
+		OnChunkDone: func(ByteRange, int64, time.Duration) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.finished++
+		},
+		OnRetry: func(_ ByteRange, _ int, err error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.retries++
+			s.lastErr = err
+		},
+		OnProgress: func(done, total int64) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.done, s.total = done, total
+		},
+		OnComplete: func(r Result) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.result = &r
+		},
+	}
+}
+
+func (s *hookStatus) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r := s.result; r != nil {
+		switch {
+		case r.Err != nil:
+			return fmt.Sprintf("falhou depois de %s: %v", r.Elapsed.Round(time.Millisecond), r.Err)
+		case r.Skipped:
+			return "arquivo local já atualizado, nada baixado"
+		}
+		return fmt.Sprintf("concluído: %d bytes em %s", r.Size, r.Elapsed.Round(time.Millisecond))
+	}
+	if s.started.IsZero() {
+		return "aguardando o início do download"
+	}
+
+	var b strings.Builder
+	if s.total > 0 {
+		fmt.Fprintf(&b, "%.1f%% (%d de %d bytes)", float64(s.done)*100/float64(s.total), s.done, s.total)
+	} else {
+		fmt.Fprintf(&b, "%d bytes", s.done)
+	}
+	if elapsed := time.Since(s.started).Seconds(); elapsed > 0 {
+		fmt.Fprintf(&b, ", %.2f MB/s", float64(s.done)/elapsed/1024/1024)
+	}
+	fmt.Fprintf(&b, ", %d de %d chunks concluídos", s.finished, s.chunks)
+	if s.retries > 0 {
+		fmt.Fprintf(&b, ", %d novas tentativas (última: %v)", s.retries, s.lastErr)
+	}
+	return b.String()
+}
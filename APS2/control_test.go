@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestControlPauseResume(t *testing.T) {
+	cfg := Config{Pause: NewPauseControl()}
+	c := newController(cfg)
+
+	steps := []struct {
+		line   string
+		paused bool
+	}{
+		{"pause", true},
+		{"  PAUSE  ", true},
+		{"", true},
+		{"resume", false},
+		{"resume", false},
+	}
+	for _, s := range steps {
+		if err := c.handle(s.line); err != nil {
+			t.Fatalf("%q: %v", s.line, err)
+		}
+		if got := cfg.Pause.Paused(); got != s.paused {
+			t.Errorf("depois de %q Paused() = %v, esperado %v", s.line, got, s.paused)
+		}
+	}
+
+	if err := c.handle("stop"); err == nil {
+		t.Error("comando desconhecido aceito")
+	}
+}
+
+// Um comando inválido não interrompe a leitura dos seguintes
+func TestControlServe(t *testing.T) {
+	cfg := Config{Pause: NewPauseControl()}
+	newController(cfg).serve(strings.NewReader("xyz\npause\n"))
+	if !cfg.Pause.Paused() {
+		t.Error("pause depois de um comando inválido não foi aplicado")
+	}
+}
+
+func TestControlLimitAndBurst(t *testing.T) {
+	cfg := Config{Pause: NewPauseControl(), RateLimiter: NewRateLimiter(0)}
+	c := newController(cfg)
+
+	const mb = 1024 * 1024
+	if err := c.handle("limit 2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.RateLimiter.Rate(); got != 2*mb {
+		t.Errorf("limit 2: Rate() = %d, esperado %d", got, 2*mb)
+	}
+	if err := c.handle("burst 0.5"); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.RateLimiter.capacity(); got != mb/2 {
+		t.Errorf("burst 0.5: capacidade %d, esperada %d", got, mb/2)
+	}
+	if err := c.handle("limit 0"); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.RateLimiter.Rate(); got != 0 {
+		t.Errorf("limit 0: Rate() = %d, esperado sem limite", got)
+	}
+
+	for _, line := range []string{"limit", "limit -1", "limit x", "limit NaN", "burst 1 2"} {
+		if err := c.handle(line); err == nil {
+			t.Errorf("%q aceito", line)
+		}
+	}
+}
+
+// O comando status mostra o andamento recebido pelos Hooks
+func TestControlStatus(t *testing.T) {
+	data := testData(10000)
+	srv := newFaultServer(t, data, faults{fail: 1})
+	cfg := testConfig(t, srv.fileURL())
+	c := newController(cfg)
+	var out strings.Builder
+	c.out = &out
+	cfg.Hooks = c.status.hooks()
+
+	if err := c.handle("status"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "aguardando") {
+		t.Errorf("status antes do download: %q", out.String())
+	}
+
+	hooks := cfg.Hooks
+	hooks.OnStart(int64(len(data)))
+	hooks.OnChunkStart(ByteRange{0, 4999})
+	hooks.OnProgress(2500, int64(len(data)))
+	out.Reset()
+	c.handle("status")
+	if got := out.String(); !strings.Contains(got, "25.0%") || !strings.Contains(got, "0 de 1 chunks") {
+		t.Errorf("status no meio do download: %q", got)
+	}
+
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	c.handle("status")
+	if got := out.String(); !strings.Contains(got, "concluído: 10000 bytes") {
+		t.Errorf("status depois do download: %q", got)
+	}
+}
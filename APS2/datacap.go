@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"sync/atomic"
+)
+
+var errDataCap = errors.New("limite de dados atingido")
+
+// Bytes recebidos da rede em toda a execução, somando as execuções do
+// benchmark e os arquivos de -input e -manifest. Com um limite, nenhum chunk
+// novo começa depois que ele é atingido; os que já estão em andamento
+// terminam. nil desativa a contagem.
+type DataUsage struct {
+	used  atomic.Int64
+	limit int64
+}
+
+// Contador com limite em bytes; zero conta sem limitar
+func NewDataUsage(limit int64) *DataUsage {
+	return &DataUsage{limit: limit}
+}
+
+func (u *DataUsage) add(n int64) {
+	if u != nil {
+		u.used.Add(n)
+	}
+}
+
+// Total de bytes recebidos até agora
+func (u *DataUsage) Used() int64 {
+	if u == nil {
+		return 0
+	}
+	return u.used.Load()
+}
+
+func (u *DataUsage) exceeded() bool {
+	return u != nil && u.limit > 0 && u.used.Load() >= u.limit
+}
+
+// Soma ao DataUsage cada leitura do corpo de uma resposta
+type usageReader struct {
+	r     io.Reader
+	usage *DataUsage
+}
+
+func (u *usageReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	u.usage.add(int64(n))
+	return n, err
+}
+
+// Total recebido ao final da execução
+func logDataUsage(u *DataUsage) {
+	if u == nil {
+		return
+	}
+	args := []any{"bytes", u.Used()}
+	if u.limit > 0 {
+		args = append(args, "limite", u.limit)
+	}
+	slog.Info("Dados recebidos na execução", args...)
+}
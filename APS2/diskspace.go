@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Confere se há espaço livre para o arquivo antes de reservá-lo. O Truncate
+// pode criar um arquivo esparso e o disco cheio só aparecer no meio do
+// download. Se o arquivo de destino já existe (-force), o espaço que ele
+// ocupa será liberado.
+func checkDiskSpace(path string, size int64) error {
+	avail, ok := availableSpace(filepath.Dir(path))
+	if !ok {
+		return nil
+	}
+
+	if fi, err := os.Stat(path); err == nil {
+		avail += uint64(fi.Size())
+	}
+
+	if uint64(size) > avail {
+		return fmt.Errorf("espaço em disco insuficiente: o arquivo tem %d bytes e há %d bytes livres em %s", size, avail, filepath.Dir(path))
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package main
+
+// Sem statfs disponível: não há como saber, o download segue normalmente
+func availableSpace(dir string) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// Tempo que um endereço resolvido fica no cache de -dns-cache
+const dnsCacheTTL = 5 * time.Minute
+
+type dnsEntry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// Cache de resolução de nomes compartilhado pelas conexões de todos os
+// chunks: o host é resolvido uma vez em vez de a cada conexão nova
+type dnsCache struct {
+	mu sync.Mutex
+	// Consulta ao resolvedor do sistema; os testes trocam por uma que conta
+	// as consultas
+	lookupIP func(ctx context.Context, network, host string) ([]net.IP, error)
+	ttl      time.Duration
+	entries  map[string]dnsEntry
+}
+
+func newDNSCache() *dnsCache {
+	return &dnsCache{lookupIP: net.DefaultResolver.LookupIP, ttl: dnsCacheTTL, entries: map[string]dnsEntry{}}
+}
+
+// Endereços do host na família pedida ("ip", "ip4" ou "ip6"). A trava fica
+// presa durante a consulta para que as conexões abertas ao mesmo tempo no
+// início esperem a primeira resolução em vez de repeti-la.
+func (c *dnsCache) lookup(ctx context.Context, network, host string) ([]net.IP, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := network + "/" + host
+	if e, ok := c.entries[key]; ok && time.Now().Before(e.expires) {
+		return e.ips, nil
+	}
+
+	started := time.Now()
+	ips, err := c.lookupIP(ctx, network, host)
+	if err != nil {
+		return nil, err
+	}
+	slog.Debug("Nome resolvido", "host", host, "enderecos", len(ips), "duracao", time.Since(started))
+
+	c.entries[key] = dnsEntry{ips: ips, expires: time.Now().Add(c.ttl)}
+	return ips, nil
+}
+
+// Conecta usando os endereços do cache, tentando um de cada vez na ordem do
+// resolvedor até algum aceitar
+func (c *dnsCache) dial(ctx context.Context, dialer *net.Dialer, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	family := "ip"
+	switch network {
+	case "tcp4":
+		family = "ip4"
+	case "tcp6":
+		family = "ip6"
+	}
+	ips, err := c.lookup(ctx, family, host)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ips) == 0 {
+		return nil, &net.AddrError{Err: "nenhum endereço encontrado", Addr: host}
+	}
+
+	var errs []error
+	for _, ip := range ips {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
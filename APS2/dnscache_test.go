@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Cache que resolve qualquer nome para 127.0.0.1 e conta as consultas
+func countingDNSCache() (*dnsCache, *atomic.Int32) {
+	var lookups atomic.Int32
+	c := newDNSCache()
+	c.lookupIP = func(ctx context.Context, network, host string) ([]net.IP, error) {
+		lookups.Add(1)
+		return []net.IP{net.IPv4(127, 0, 0, 1)}, nil
+	}
+	return c, &lookups
+}
+
+// As conexões de todos os chunks, abertas ao mesmo tempo, usam uma única
+// resolução do host
+func TestDNSCacheResolvesOnce(t *testing.T) {
+	data := testData(100000)
+	srv := newRangeServer(t, data)
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	cfg := testConfig(t, "http://arquivos.test:"+port+"/arquivo.bin")
+	cfg.Threads = 8
+	cache, lookups := countingDNSCache()
+	var dials atomic.Int32
+	client := newHTTPClient(cfg)
+	transport := client.Transport.(*http.Transport)
+	// Sem reuso cada requisição abre a sua conexão
+	transport.DisableKeepAlives = true
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dials.Add(1)
+		return cache.dial(ctx, &net.Dialer{}, network, addr)
+	}
+	cfg.Client = client
+
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+
+	if n := lookups.Load(); n != 1 {
+		t.Errorf("%d consultas DNS, esperada uma", n)
+	}
+	if n := dials.Load(); n <= int32(cfg.Threads) {
+		t.Errorf("só %d conexões abertas", n)
+	}
+}
+
+// Depois do TTL o host é resolvido de novo; as famílias têm entradas
+// separadas
+func TestDNSCacheExpires(t *testing.T) {
+	cache, lookups := countingDNSCache()
+	cache.ttl = 50 * time.Millisecond
+	ctx := context.Background()
+
+	for range 3 {
+		if _, err := cache.lookup(ctx, "ip", "arquivos.test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := lookups.Load(); n != 1 {
+		t.Fatalf("%d consultas dentro do TTL, esperada uma", n)
+	}
+
+	if _, err := cache.lookup(ctx, "ip4", "arquivos.test"); err != nil {
+		t.Fatal(err)
+	}
+	if n := lookups.Load(); n != 2 {
+		t.Errorf("%d consultas, esperada uma nova para ip4", n)
+	}
+
+	time.Sleep(2 * cache.ttl)
+	if _, err := cache.lookup(ctx, "ip", "arquivos.test"); err != nil {
+		t.Fatal(err)
+	}
+	if n := lookups.Load(); n != 3 {
+		t.Errorf("%d consultas, esperada uma nova depois do TTL", n)
+	}
+}
+
+// Um erro do resolvedor não fica no cache
+func TestDNSCacheError(t *testing.T) {
+	cache, lookups := countingDNSCache()
+	resolve := cache.lookupIP
+	cache.lookupIP = func(ctx context.Context, network, host string) ([]net.IP, error) {
+		if lookups.Load() == 0 {
+			lookups.Add(1)
+			return nil, &net.DNSError{Err: "falha temporária", Name: host, IsTemporary: true}
+		}
+		return resolve(ctx, network, host)
+	}
+
+	_, err := cache.dial(context.Background(), &net.Dialer{}, "tcp", "arquivos.test:1")
+	if err == nil || !strings.Contains(err.Error(), "falha temporária") {
+		t.Fatalf("erro %v, esperado o do resolvedor", err)
+	}
+	if _, err := cache.lookup(context.Background(), "ip", "arquivos.test"); err != nil {
+		t.Fatal(err)
+	}
+	if n := lookups.Load(); n != 2 {
+		t.Errorf("%d consultas, esperada uma nova depois do erro", n)
+	}
+}
+
+// Resolução fria (cache novo a cada vez) contra a resolução em cache, com o
+// resolvedor do sistema: go test -bench DNSCache
+func BenchmarkDNSCache(b *testing.B) {
+	ctx := context.Background()
+	b.Run("fria", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := newDNSCache().lookup(ctx, "ip", "localhost"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("cache", func(b *testing.B) {
+		cache := newDNSCache()
+		for b.Loop() {
+			if _, err := cache.lookup(ctx, "ip", "localhost"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// Modo -dry-run: consulta o arquivo remoto e mostra o que seria feito, sem
+// criar nenhum arquivo
+func runDryRun(ctx context.Context, cfg Config) error {
+	info, mirrors, err := probeMirrors(ctx, cfg, cfg.URL)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("URL:      %s\n", cfg.URL)
+	if info.URL != cfg.URL {
+		fmt.Printf("URL final: %s\n", info.URL)
+	}
+	if err := checkAllowedHost(info.URL, cfg.AllowedHosts); err != nil {
+		return err
+	}
+	for _, m := range mirrors[1:] {
+		fmt.Printf("Espelho:  %s\n", m)
+	}
+	fmt.Printf("Arquivo:  %s\n", cfg.Output)
+	if info.Size == unknownSize {
+		fmt.Println("Tamanho:  desconhecido")
+	} else {
+		fmt.Printf("Tamanho:  %d bytes\n", info.Size)
+	}
+	if info.ETag != "" {
+		fmt.Printf("ETag:     %s\n", info.ETag)
+	}
+	if info.Encoding != "" {
+		fmt.Printf("Content-Encoding: %s\n", info.Encoding)
+	}
+	fmt.Printf("Aceita Range: %t\n", info.AcceptRanges)
+
+	if info.Size == 0 {
+		fmt.Println("Arquivo vazio, nada a baixar")
+		return nil
+	}
+
+	cfg = cfg.applyHostOverride(info.URL)
+	chunkSize := planChunkSize(cfg, &info)
+	if !info.AcceptRanges {
+		fmt.Println("Plano: fluxo único, sem chunks")
+		return nil
+	}
+
+	chunks := chunkCount(info.Size, chunkSize)
+	fmt.Printf("Plano: %d chunks de até %d bytes\n", chunks, chunkSize)
+	for i := int64(0); i < chunks; i++ {
+		start, end := chunkRange(i, chunkSize, info.Size)
+		fmt.Printf("  chunk %d: bytes %d-%d (%d bytes)\n", i, start, end, end-start+1)
+	}
+	return nil
+}
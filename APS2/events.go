@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Evento emitido em JSON (um por linha) com -json, para que outros
+// programas acompanhem o download sem interpretar os logs
+type event struct {
+	Event      string    `json:"event"`
+	Time       time.Time `json:"time"`
+	URL        string    `json:"url"`
+	Output     string    `json:"output,omitempty"`
+	TotalBytes int64     `json:"totalBytes"`
+	BytesDone  int64     `json:"bytesDone"`
+	Speed      float64   `json:"speed"`
+	Elapsed    float64   `json:"elapsed"`
+	Range      string    `json:"range,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+const (
+	eventStart     = "start"
+	eventProgress  = "progress"
+	eventChunkDone = "chunk-done"
+	eventComplete  = "complete"
+	eventError     = "error"
+)
+
+type eventLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newEventLog(w io.Writer) *eventLog {
+	return &eventLog{enc: json.NewEncoder(w)}
+}
+
+// Sem -json o eventLog é nil e nada é emitido
+func (l *eventLog) emit(e event) {
+	if l == nil {
+		return
+	}
+	e.Time = time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enc.Encode(e)
+}
+
+// Evento com o estado atual de um download em andamento
+func (d *download) event(kind string, started time.Time) event {
+	elapsed := time.Since(started).Seconds()
+	done := d.written.Load()
+
+	e := event{
+		Event:      kind,
+		URL:        d.cfg.URL,
+		Output:     d.cfg.Output,
+		TotalBytes: d.size,
+		BytesDone:  done,
+		Elapsed:    elapsed,
+	}
+	if elapsed > 0 {
+		e.Speed = float64(done) / elapsed
+	}
+	return e
+}
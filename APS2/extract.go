@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Formato de compressão identificado pelos primeiros bytes do arquivo
+type compression struct {
+	name  string
+	magic []byte
+	// Programa externo usado quando a biblioteca padrão não tem decodificador
+	tool string
+}
+
+var compressions = []compression{
+	{name: "gzip", magic: []byte{0x1f, 0x8b}},
+	{name: "bzip2", magic: []byte("BZh")},
+	{name: "zstd", magic: []byte{0x28, 0xb5, 0x2f, 0xfd}, tool: "zstd"},
+	{name: "xz", magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, tool: "xz"},
+}
+
+// Extensões de compressão removidas do nome do arquivo extraído
+var compressedExts = map[string]string{
+	".gz":   "",
+	".gzip": "",
+	".bz2":  "",
+	".zst":  "",
+	".xz":   "",
+	".tgz":  ".tar",
+	".tbz2": ".tar",
+	".txz":  ".tar",
+}
+
+func detectCompression(path string) (*compression, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	head := make([]byte, 8)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	for i := range compressions {
+		if bytes.HasPrefix(head, compressions[i].magic) {
+			return &compressions[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func extractedName(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if repl, ok := compressedExts[ext]; ok {
+		return strings.TrimSuffix(path, path[len(path)-len(ext):]) + repl
+	}
+	return path
+}
+
+// Descompacta o arquivo baixado de acordo com os bytes mágicos, sem confiar
+// na extensão. Retorna o caminho final, que é o original se o formato não
+// for reconhecido. Um arquivo que já existe com o nome extraído só é
+// substituído com force.
+func extractFile(path string, force bool) (string, error) {
+	c, err := detectCompression(path)
+	if err != nil {
+		return path, err
+	}
+	if c == nil {
+		slog.Info("Formato de compressão não reconhecido, arquivo mantido como baixado")
+		return path, nil
+	}
+
+	if c.tool != "" {
+		if _, err := exec.LookPath(c.tool); err != nil {
+			slog.Warn("Programa de descompactação não disponível, arquivo mantido como baixado", "formato", c.name, "programa", c.tool)
+			return path, nil
+		}
+	}
+
+	target := extractedName(path)
+	if target != path && !force {
+		if _, err := os.Stat(target); err == nil {
+			return path, errOutputExists(target)
+		}
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return path, err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return path, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := decompress(c, in, tmp); err != nil {
+		tmp.Close()
+		return path, fmt.Errorf("erro descompactando %s: %w", c.name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return path, err
+	}
+
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return path, err
+	}
+	if target != path {
+		os.Remove(path)
+	}
+
+	slog.Info("Arquivo descompactado", "formato", c.name, "arquivo", target)
+	return target, nil
+}
+
+func decompress(c *compression, in io.Reader, out io.Writer) error {
+	switch c.name {
+	case "gzip":
+		zr, err := gzip.NewReader(in)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		_, err = io.Copy(out, zr)
+		return err
+	case "bzip2":
+		_, err := io.Copy(out, bzip2.NewReader(in))
+		return err
+	default:
+		cmd := exec.Command(c.tool, "-dc")
+		cmd.Stdin = in
+		cmd.Stdout = out
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func gzipData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// O formato vem dos bytes mágicos: a extensão só decide o nome final
+func TestExtractMisleadingExtension(t *testing.T) {
+	plain := testData(4096)
+	tests := []struct {
+		name    string
+		content []byte
+		want    string
+		data    []byte
+	}{
+		// gzip com extensão de outro formato
+		{"dados.bz2", gzipData(t, plain), "dados", plain},
+		// gzip sem extensão de compressão: descompactado no mesmo nome
+		{"dados.txt", gzipData(t, plain), "dados.txt", plain},
+		// .gz que não é gzip: mantido como baixado
+		{"dados.gz", plain, "dados.gz", plain},
+		{"pacote.tgz", gzipData(t, plain), "pacote.tar", plain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.name)
+			if err := os.WriteFile(path, tt.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := extractFile(path, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(filepath.Dir(path), tt.want); got != want {
+				t.Errorf("extraído em %s, esperado %s", got, want)
+			}
+			checkFile(t, got, tt.data)
+			if got != path {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("arquivo compactado %s ficou depois de extraído", path)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractExistingTarget(t *testing.T) {
+	plain := testData(4096)
+	existing := []byte("arquivo do usuário")
+
+	for _, force := range []bool{false, true} {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "dados.gz")
+		target := filepath.Join(dir, "dados")
+		compressed := gzipData(t, plain)
+		if err := os.WriteFile(path, compressed, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(target, existing, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := extractFile(path, force)
+		if !force {
+			if err == nil {
+				t.Fatal("extração sobrescreveu um arquivo existente sem -force")
+			}
+			if got != path {
+				t.Errorf("caminho %s depois da recusa, esperado o baixado %s", got, path)
+			}
+			checkFile(t, target, existing)
+			checkFile(t, path, compressed)
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkFile(t, target, plain)
+	}
+}
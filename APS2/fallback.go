@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Falha ao consultar o arquivo remoto antes de começar o download
+type probeError struct {
+	err error
+}
+
+func (e *probeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *probeError) Unwrap() error {
+	return e.err
+}
+
+// Chunks que esgotaram as tentativas, com o erro final de cada faixa
+type chunksFailedError struct {
+	missing int
+	errs    []error
+}
+
+// Faixas listadas na mensagem; as demais só entram na contagem
+const maxListedFailures = 5
+
+func (e *chunksFailedError) Error() string {
+	msg := fmt.Sprintf("%d chunks não foram baixados; execute novamente para retomar", e.missing)
+	if len(e.errs) == 0 {
+		return msg
+	}
+
+	var listed []string
+	for _, err := range e.errs[:min(len(e.errs), maxListedFailures)] {
+		listed = append(listed, err.Error())
+	}
+	if extra := len(e.errs) - len(listed); extra > 0 {
+		listed = append(listed, fmt.Sprintf("e mais %d", extra))
+	}
+	return msg + " (" + strings.Join(listed, "; ") + ")"
+}
+
+func (e *chunksFailedError) Unwrap() []error {
+	return e.errs
+}
+
+// A URL principal não respondeu ou perdeu chunks demais: o download inteiro
+// pode ser refeito a partir de -fallback-url. Checksum errado ou arquivo
+// remoto alterado não são resolvidos trocando de URL.
+func shouldFailover(err error) bool {
+	var pe *probeError
+	var ce *chunksFailedError
+	return errors.As(err, &pe) || errors.As(err, &ce)
+}
+
+// Confere que a URL alternativa serve o mesmo arquivo que a principal
+// informou: mesmo tamanho e, quando os dois informam, mesmo ETag
+func checkSameContent(primary, fallback remoteInfo) error {
+	if primary.Size != unknownSize && fallback.Size != unknownSize && primary.Size != fallback.Size {
+		return fmt.Errorf("URL alternativa serve outro conteúdo: %d bytes em vez de %d", fallback.Size, primary.Size)
+	}
+	if primary.ETag != "" && fallback.ETag != "" && primary.ETag != fallback.ETag {
+		return fmt.Errorf("URL alternativa serve outro conteúdo: ETag %s em vez de %s", fallback.ETag, primary.ETag)
+	}
+	return nil
+}
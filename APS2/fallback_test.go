@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckSameContent(t *testing.T) {
+	primary := remoteInfo{Size: 100, ETag: `"a"`}
+	tests := []struct {
+		fallback remoteInfo
+		ok       bool
+	}{
+		{remoteInfo{Size: 100, ETag: `"a"`}, true},
+		// Sem ETag num dos lados, só o tamanho é comparado
+		{remoteInfo{Size: 100}, true},
+		{remoteInfo{Size: unknownSize, ETag: `"a"`}, true},
+		{remoteInfo{Size: 99, ETag: `"a"`}, false},
+		{remoteInfo{Size: 100, ETag: `"b"`}, false},
+	}
+	for _, tt := range tests {
+		if err := checkSameContent(primary, tt.fallback); (err == nil) != tt.ok {
+			t.Errorf("%+v: %v, esperado ok=%v", tt.fallback, err, tt.ok)
+		}
+	}
+}
+
+func TestShouldFailover(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&probeError{errors.New("conexão recusada")}, true},
+		{&chunksFailedError{missing: 1}, true},
+		{errors.New("checksum não confere"), false},
+		{errSizeChanged, false},
+	}
+	for _, tt := range tests {
+		if got := shouldFailover(tt.err); got != tt.want {
+			t.Errorf("shouldFailover(%v) = %v, esperado %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// A principal fora do ar na consulta inicial: o download inteiro vem da
+// URL alternativa
+func TestFallbackPrimaryDown(t *testing.T) {
+	data := testData(10000)
+	down := httptest.NewServer(http.NotFoundHandler())
+	primary := down.URL + "/arquivo.bin"
+	down.Close()
+	fallback := newRangeServer(t, data)
+
+	cfg := testConfig(t, primary)
+	cfg.ProbeAttempts = 1
+	cfg.FallbackURL = fallback.fileURL()
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+	if n := countRanged(fallback.Requests()); n != int(cfg.Threads) {
+		t.Errorf("%d faixas pedidas à alternativa, esperadas %d", n, cfg.Threads)
+	}
+}
+
+// A principal responde à consulta mas falha todos os chunks: a alternativa
+// com o mesmo conteúdo termina o download; com outro tamanho, falha
+func TestFallbackChunksFailed(t *testing.T) {
+	data := testData(10000)
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("ETag", testETag)
+		serveRange(w, r, data)
+	}))
+	defer primary.Close()
+
+	t.Run("mesmo arquivo", func(t *testing.T) {
+		fallback := newRangeServer(t, data)
+		cfg := testConfig(t, primary.URL+"/arquivo.bin")
+		cfg.MaxAttempts = 1
+		cfg.FallbackURL = fallback.fileURL()
+		if _, _, err := runDownload(context.Background(), cfg); err != nil {
+			t.Fatal(err)
+		}
+		checkFile(t, cfg.Output, data)
+	})
+
+	t.Run("outro arquivo", func(t *testing.T) {
+		fallback := newRangeServer(t, testData(5000))
+		cfg := testConfig(t, primary.URL+"/arquivo.bin")
+		cfg.MaxAttempts = 1
+		cfg.FallbackURL = fallback.fileURL()
+		_, _, err := runDownload(context.Background(), cfg)
+		if err == nil || !strings.Contains(err.Error(), "outro conteúdo") {
+			t.Fatalf("erro %v, esperado URL alternativa com outro conteúdo", err)
+		}
+		if n := countRanged(fallback.Requests()); n != 0 {
+			t.Errorf("%d faixas pedidas à alternativa com outro conteúdo", n)
+		}
+	})
+}
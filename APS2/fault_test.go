@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Falhas aplicadas pelo faultServer. As faixas são identificadas pelo
+// último byte, que não muda quando uma nova tentativa continua o chunk de
+// onde parou.
+type faults struct {
+	// Responde 503 às primeiras N requisições de cada faixa
+	fail int
+	// Troca o status da primeira resposta de cada faixa
+	status int
+	// Corta o corpo da primeira resposta de cada faixa depois de N bytes
+	truncate int64
+	// Desloca o Content-Range da primeira resposta de cada faixa
+	badRange bool
+	// Ignora o Range e não envia Accept-Ranges, como um servidor sem
+	// suporte a faixas
+	noRanges bool
+}
+
+// Servidor de teste com defeitos, para exercitar as novas tentativas, a
+// validação das respostas de faixa e o fluxo único
+type faultServer struct {
+	*httptest.Server
+	data   []byte
+	faults faults
+
+	mu sync.Mutex
+	// Range de cada GET recebido, na ordem
+	ranges []string
+	seen   map[string]int
+}
+
+func newFaultServer(t *testing.T, data []byte, f faults) *faultServer {
+	s := &faultServer{data: data, faults: f, seen: map[string]int{}}
+	s.Server = httptest.NewServer(s)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *faultServer) fileURL() string {
+	return s.URL + "/arquivo.bin"
+}
+
+// Requisições de cada faixa, pelo último byte
+func (s *faultServer) count(rangeEnd int64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seen[strconv.FormatInt(rangeEnd, 10)]
+}
+
+func (s *faultServer) Ranges() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.ranges...)
+}
+
+func (s *faultServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f := s.faults
+	rangeHeader := r.Header.Get("Range")
+
+	var count int
+	if r.Method == http.MethodGet {
+		_, end, _ := strings.Cut(rangeHeader, "-")
+		s.mu.Lock()
+		s.ranges = append(s.ranges, rangeHeader)
+		if rangeHeader != "" {
+			s.seen[end]++
+			count = s.seen[end]
+		}
+		s.mu.Unlock()
+	}
+
+	if f.noRanges {
+		w.Header().Set("Content-Length", strconv.Itoa(len(s.data)))
+		if r.Method != http.MethodHead {
+			w.Write(s.data)
+		}
+		return
+	}
+	if count > 0 && count <= f.fail {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	// As demais falhas valem só para a primeira resposta de cada faixa
+	if count == 0 || count != f.fail+1 {
+		serveRange(w, r, s.data)
+		return
+	}
+
+	start, end, _ := requestedRange(rangeHeader, int64(len(s.data)))
+	switch {
+	case f.status == http.StatusOK:
+		r.Header.Del("Range")
+		serveRange(w, r, s.data)
+	case f.status != 0:
+		w.WriteHeader(f.status)
+	case f.badRange:
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start+1, end+1, len(s.data)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(s.data[start : end+1])
+	case f.truncate > 0:
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(s.data)))
+		w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(s.data[start : start+f.truncate])
+		w.(http.Flusher).Flush()
+		// Derruba a conexão no meio do corpo
+		panic(http.ErrAbortHandler)
+	default:
+		serveRange(w, r, s.data)
+	}
+}
+
+// Faixas dos 4 chunks de um arquivo de 10000 bytes
+var faultChunks = [][2]int64{{0, 2499}, {2500, 4999}, {5000, 7499}, {7500, 9999}}
+
+func TestFaultRetryAfterFailures(t *testing.T) {
+	data := testData(10000)
+	srv := newFaultServer(t, data, faults{fail: 2})
+	cfg := testConfig(t, srv.fileURL())
+
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+	for _, c := range faultChunks {
+		if n := srv.count(c[1]); n != 3 {
+			t.Errorf("faixa %d-%d pedida %d vezes, esperadas 3", c[0], c[1], n)
+		}
+	}
+}
+
+func TestFaultWrongStatus(t *testing.T) {
+	tests := []struct {
+		status  int
+		recover bool
+	}{
+		{http.StatusInternalServerError, true},
+		// Range ignorado: a faixa é pedida de novo
+		{http.StatusOK, true},
+		// Status permanente: falha sem novas tentativas
+		{http.StatusNotFound, false},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.status), func(t *testing.T) {
+			data := testData(10000)
+			srv := newFaultServer(t, data, faults{status: tt.status})
+			cfg := testConfig(t, srv.fileURL())
+
+			_, _, err := runDownload(context.Background(), cfg)
+			if !tt.recover {
+				if err == nil {
+					t.Fatal("download terminou apesar do status permanente")
+				}
+				for _, c := range faultChunks {
+					if n := srv.count(c[1]); n > 1 {
+						t.Errorf("faixa %d-%d pedida %d vezes com status %d", c[0], c[1], n, tt.status)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkFile(t, cfg.Output, data)
+			for _, c := range faultChunks {
+				if n := srv.count(c[1]); n != 2 {
+					t.Errorf("faixa %d-%d pedida %d vezes, esperadas 2", c[0], c[1], n)
+				}
+			}
+		})
+	}
+}
+
+// A nova tentativa continua do último byte recebido em vez de recomeçar a
+// faixa
+func TestFaultTruncatedBody(t *testing.T) {
+	data := testData(10000)
+	srv := newFaultServer(t, data, faults{truncate: 1000})
+	cfg := testConfig(t, srv.fileURL())
+
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+
+	ranges := srv.Ranges()
+	for _, c := range faultChunks {
+		first := fmt.Sprintf("bytes=%d-%d", c[0], c[1])
+		retry := fmt.Sprintf("bytes=%d-%d", c[0]+1000, c[1])
+		for _, want := range []string{first, retry} {
+			found := false
+			for _, r := range ranges {
+				found = found || r == want
+			}
+			if !found {
+				t.Errorf("faixa %s não foi pedida (pedidas: %q)", want, ranges)
+			}
+		}
+	}
+}
+
+func TestFaultBadContentRange(t *testing.T) {
+	data := testData(10000)
+	srv := newFaultServer(t, data, faults{badRange: true})
+	cfg := testConfig(t, srv.fileURL())
+
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+	for _, c := range faultChunks {
+		if n := srv.count(c[1]); n != 2 {
+			t.Errorf("faixa %d-%d pedida %d vezes, esperadas 2 (a primeira com Content-Range deslocado)", c[0], c[1], n)
+		}
+	}
+}
+
+// Sem Accept-Ranges e com o Range ignorado, o download cai para o fluxo
+// único: depois da sondagem, um GET sem Range
+func TestFaultNoRanges(t *testing.T) {
+	data := testData(10000)
+	srv := newFaultServer(t, data, faults{noRanges: true})
+	cfg := testConfig(t, srv.fileURL())
+
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+
+	whole := 0
+	for _, r := range srv.Ranges() {
+		switch r {
+		case "":
+			whole++
+		case "bytes=0-0":
+			// sondagem de suporte a Range
+		default:
+			t.Errorf("faixa %s pedida a um servidor sem Range", r)
+		}
+	}
+	if whole != 1 {
+		t.Errorf("%d GETs do arquivo inteiro, esperado 1", whole)
+	}
+}
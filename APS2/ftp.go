@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// URLs ftp:// e ftps:// são baixadas por FTP em vez de HTTP. O ftps:// usa
+// TLS implícito (porta 990), como o curl; o canal de dados também é
+// cifrado (PROT P).
+func isFTP(rawURL string) bool {
+	scheme, _, _ := strings.Cut(rawURL, "://")
+	scheme = strings.ToLower(scheme)
+	return scheme == "ftp" || scheme == "ftps"
+}
+
+// Conexão de controle com um servidor FTP, já autenticada e em modo
+// binário. Cada chunk abre a sua: o FTP só transfere um arquivo por vez em
+// cada conexão.
+type ftpConn struct {
+	conn net.Conn
+	text *textproto.Conn
+	tls  *tls.Config
+	// Fecha as conexões quando o contexto é cancelado
+	stop func() bool
+
+	mu   sync.Mutex
+	data net.Conn
+}
+
+// Conecta ao servidor da URL e faz o login com o usuário da URL, o de
+// -user ou o anônimo. Retorna também o caminho do arquivo, relativo ao
+// diretório inicial do usuário como no curl (ftp://host//caminho é
+// absoluto).
+func dialFTP(ctx context.Context, cfg Config, rawURL string) (*ftpConn, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+	secure := strings.EqualFold(u.Scheme, "ftps")
+	port := u.Port()
+	if port == "" {
+		port = "21"
+		if secure {
+			port = "990"
+		}
+	}
+	file := strings.TrimPrefix(u.Path, "/")
+	if file == "" || strings.HasSuffix(file, "/") {
+		return nil, "", fmt.Errorf("URL FTP sem arquivo: %s", rawURL)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return nil, "", fmt.Errorf("erro conectando ao servidor FTP: %w", err)
+	}
+
+	c := &ftpConn{conn: conn}
+	if secure {
+		c.tls = &tls.Config{
+			ServerName:         u.Hostname(),
+			RootCAs:            cfg.RootCAs,
+			InsecureSkipVerify: cfg.Insecure,
+			// Servidores que exigem a mesma sessão TLS no canal de dados
+			// aceitam a retomada da sessão do controle
+			ClientSessionCache: tls.NewLRUClientSessionCache(1),
+		}
+		conn = tls.Client(conn, c.tls)
+		c.conn = conn
+	}
+	c.text = textproto.NewConn(conn)
+	c.stop = context.AfterFunc(ctx, func() { c.closeAll() })
+
+	user, pass := "anonymous", "anonymous@"
+	if u.User != nil {
+		user = u.User.Username()
+		pass, _ = u.User.Password()
+	} else if cfg.Username != "" {
+		user, pass = cfg.Username, cfg.Password
+	}
+
+	if err := c.login(user, pass, secure); err != nil {
+		c.Close()
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		return nil, "", err
+	}
+	return c, file, nil
+}
+
+func (c *ftpConn) login(user, pass string, secure bool) error {
+	if _, _, err := c.text.ReadResponse(220); err != nil {
+		return fmt.Errorf("servidor FTP recusou a conexão: %w", err)
+	}
+	code, _, err := c.cmd(0, "USER %s", user)
+	if err != nil {
+		return err
+	}
+	if code == 331 {
+		code, _, err = c.cmd(0, "PASS %s", pass)
+		if err != nil {
+			return err
+		}
+	}
+	if code != 230 {
+		return ftpError(code, "login recusado", "")
+	}
+	if secure {
+		if _, _, err := c.cmd(200, "PBSZ 0"); err != nil {
+			return err
+		}
+		if _, _, err := c.cmd(200, "PROT P"); err != nil {
+			return err
+		}
+	}
+	_, _, err = c.cmd(200, "TYPE I")
+	return err
+}
+
+// Envia um comando e lê a resposta. Com expect diferente de zero, outro
+// código vira erro; com zero o código é devolvido para quem chama decidir.
+func (c *ftpConn) cmd(expect int, format string, args ...any) (int, string, error) {
+	if err := c.text.PrintfLine(format, args...); err != nil {
+		return 0, "", fmt.Errorf("erro enviando comando FTP: %w", err)
+	}
+	code, msg, err := c.text.ReadResponse(0)
+	if err != nil {
+		var perr *textproto.Error
+		if !errors.As(err, &perr) {
+			return 0, "", fmt.Errorf("erro lendo resposta FTP: %w", err)
+		}
+	}
+	if expect != 0 && code != expect {
+		name, _, _ := strings.Cut(format, " ")
+		return code, msg, ftpError(code, name, msg)
+	}
+	return code, msg, nil
+}
+
+// Erros 4xx do FTP são temporários e 5xx permanentes; viram um statusError
+// com um código HTTP equivalente para a classificação das novas tentativas
+func ftpError(code int, what, msg string) error {
+	status := http.StatusServiceUnavailable
+	if code >= 500 {
+		status = http.StatusBadRequest
+		if code == 550 {
+			status = http.StatusNotFound
+		}
+	}
+	return &statusError{code: status, msg: fmt.Sprintf("FTP %s: %d %s", what, code, msg)}
+}
+
+func (c *ftpConn) closeAll() {
+	c.mu.Lock()
+	if c.data != nil {
+		c.data.Close()
+	}
+	c.mu.Unlock()
+	c.conn.Close()
+}
+
+// Encerra sem QUIT: uma transferência interrompida no meio deixaria o
+// servidor respondendo à anterior antes
+func (c *ftpConn) Close() error {
+	c.stop()
+	c.closeAll()
+	return nil
+}
+
+func (c *ftpConn) size(file string) (int64, error) {
+	_, msg, err := c.cmd(213, "SIZE %s", file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+}
+
+func (c *ftpConn) modTime(file string) time.Time {
+	_, msg, err := c.cmd(213, "MDTM %s", file)
+	if err != nil {
+		return time.Time{}
+	}
+	t, err := time.Parse("20060102150405", strings.TrimSpace(msg))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// Abre a conexão de dados em modo passivo, pelo EPSV ou, se o servidor não
+// o conhece, pelo PASV. O endereço do PASV é ignorado e usa-se o do
+// controle, que continua certo atrás de NAT.
+func (c *ftpConn) openData(ctx context.Context) (net.Conn, error) {
+	var port string
+	if code, msg, err := c.cmd(0, "EPSV"); err != nil {
+		return nil, err
+	} else if code == 229 {
+		// (|||porta|), com qualquer caractere no lugar do |
+		i, j := strings.IndexByte(msg, '('), strings.LastIndexByte(msg, ')')
+		if i < 0 || j < i+3 {
+			return nil, fmt.Errorf("resposta EPSV inválida: %q", msg)
+		}
+		fields := strings.Split(msg[i+2:j-1], msg[i+1:i+2])
+		port = fields[len(fields)-1]
+	} else {
+		_, msg, err := c.cmd(227, "PASV")
+		if err != nil {
+			return nil, err
+		}
+		// (h1,h2,h3,h4,p1,p2)
+		i, j := strings.IndexByte(msg, '('), strings.LastIndexByte(msg, ')')
+		if i < 0 || j < i {
+			return nil, fmt.Errorf("resposta PASV inválida: %q", msg)
+		}
+		fields := strings.Split(msg[i+1:j], ",")
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("resposta PASV inválida: %q", msg)
+		}
+		hi, err1 := strconv.Atoi(fields[4])
+		lo, err2 := strconv.Atoi(fields[5])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("resposta PASV inválida: %q", msg)
+		}
+		port = strconv.Itoa(hi<<8 | lo)
+	}
+
+	host, _, _ := net.SplitHostPort(c.conn.RemoteAddr().String())
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, fmt.Errorf("erro abrindo conexão de dados FTP: %w", err)
+	}
+	if c.tls != nil {
+		conn = tls.Client(conn, c.tls)
+	}
+	return conn, nil
+}
+
+// Começa a transferir o arquivo a partir de offset. O corpo termina no fim
+// do arquivo; quem precisa de só uma faixa lê o que quer e fecha a conexão.
+func (c *ftpConn) retrieve(ctx context.Context, file string, offset int64) (io.Reader, error) {
+	data, err := c.openData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.data = data
+	c.mu.Unlock()
+	if offset > 0 {
+		if _, _, err := c.cmd(350, "REST %d", offset); err != nil {
+			return nil, fmt.Errorf("%w: %w", errNoFTPRest, err)
+		}
+	}
+	code, msg, err := c.cmd(0, "RETR %s", file)
+	if err != nil {
+		return nil, err
+	}
+	if code != 150 && code != 125 {
+		return nil, ftpError(code, "RETR", msg)
+	}
+	return data, nil
+}
+
+// Servidor recusou o REST: só dá para baixar a partir do início
+var errNoFTPRest = errors.New("servidor FTP não aceita REST")
+
+// Equivalente FTP do HEAD: tamanho pelo SIZE, data pelo MDTM e suporte a
+// faixas testando um REST. Sem REST, ou sem SIZE, o download é feito em
+// fluxo único.
+func ftpFileInfo(ctx context.Context, cfg Config, rawURL string) (remoteInfo, error) {
+	c, file, err := dialFTP(ctx, cfg, rawURL)
+	if err != nil {
+		return remoteInfo{}, err
+	}
+	defer c.Close()
+
+	info := remoteInfo{URL: rawURL, Size: unknownSize, Header: http.Header{}}
+	if size, err := c.size(file); err == nil {
+		info.Size = size
+	} else {
+		var se *statusError
+		if errors.As(err, &se) && se.code == http.StatusNotFound {
+			return remoteInfo{}, err
+		}
+		slog.Debug("Servidor FTP não informou o tamanho", "erro", err)
+	}
+	if info.LastModified = c.modTime(file); !info.LastModified.IsZero() {
+		// Sem ETag no FTP, é pela data que o .part reconhece o mesmo arquivo
+		// ao retomar
+		info.Header.Set("Last-Modified", info.LastModified.Format(http.TimeFormat))
+	}
+
+	code, _, err := c.cmd(0, "REST 0")
+	if err != nil {
+		return remoteInfo{}, err
+	}
+	info.AcceptRanges = code == 350 && info.Size != unknownSize
+	slog.Debug("Servidor FTP", "tamanho", info.Size, "rest", code == 350)
+	return info, nil
+}
+
+// Baixa a faixa start-end com REST seguido de RETR, fechando a conexão ao
+// ter os bytes da faixa
+func (d *download) fetchFTPRange(ctx context.Context, sw *sectionWriter, url string, start, end int64) (int64, error) {
+	d.policy.acquire()
+	defer d.policy.release()
+
+	c, file, err := dialFTP(ctx, d.cfg, url)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	body, err := c.retrieve(ctx, file, d.offset+start)
+	if err != nil {
+		return 0, err
+	}
+	n, err := d.copyBody(sw, io.LimitReader(body, end-start+1))
+	if err != nil {
+		return n, fmt.Errorf("erro copiando chunk: %w", err)
+	}
+	if n != end-start+1 {
+		if d.remoteSizeChanged() {
+			return n, errSizeChanged
+		}
+		return n, fmt.Errorf("servidor FTP encerrou a faixa %d-%d depois de %d bytes", start, end, n)
+	}
+	return n, nil
+}
+
+// Abre o fluxo único por FTP. Se o servidor recusa o REST de uma retomada,
+// recomeça do zero como um servidor HTTP que ignora o Range.
+func (d *download) openFTPStream(ctx context.Context, sw *sectionWriter) (io.ReadCloser, error) {
+	c, file, err := dialFTP(ctx, d.cfg, d.url)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.streamOffset > 0 {
+		slog.Info("Continuando o download", "bytes", d.streamOffset)
+	}
+	body, err := c.retrieve(ctx, file, d.streamOffset)
+	if errors.Is(err, errNoFTPRest) {
+		slog.Warn("Servidor não continuou o download, recomeçando do zero", "bytes", d.streamOffset)
+		c.Close()
+		d.written.Add(-d.streamOffset)
+		d.streamOffset = 0
+		sw.seek(0)
+		return d.openFTPStream(ctx, sw)
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{body, c}, nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Servidor FTP mínimo para os testes: login anônimo, SIZE, MDTM, EPSV, REST
+// e RETR de um único arquivo, com falhas configuráveis
+type fakeFTP struct {
+	ln   net.Listener
+	data []byte
+	// Recusa o REST com 502, como um servidor sem retomada
+	noRest bool
+	// Resposta às próximas retrFails chamadas de RETR no lugar do 150
+	retrReply string
+	retrFails int
+
+	mu       sync.Mutex
+	commands []string
+}
+
+var ftpModified = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func newFakeFTP(t *testing.T, data []byte) *fakeFTP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeFTP{ln: ln, data: data}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeFTP) url() string {
+	return "ftp://" + s.ln.Addr().String() + "/arquivo.bin"
+}
+
+// Comandos recebidos, sem os de login
+func (s *fakeFTP) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func (s *fakeFTP) count(prefix string) int {
+	n := 0
+	for _, c := range s.Commands() {
+		if strings.HasPrefix(c, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *fakeFTP) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(format string, args ...any) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+
+	reply("220 pronto")
+	var dataLn net.Listener
+	defer func() {
+		if dataLn != nil {
+			dataLn.Close()
+		}
+	}()
+	var rest int64
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch cmd {
+		case "USER":
+			reply("331 senha")
+			continue
+		case "PASS":
+			reply("230 ok")
+			continue
+		case "TYPE":
+			reply("200 ok")
+			continue
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, strings.TrimSpace(line))
+		fail := s.retrFails > 0 && cmd == "RETR"
+		if fail {
+			s.retrFails--
+		}
+		s.mu.Unlock()
+
+		if (cmd == "SIZE" || cmd == "MDTM" || cmd == "RETR") && arg != "arquivo.bin" {
+			reply("550 arquivo não encontrado")
+			continue
+		}
+		switch cmd {
+		case "SIZE":
+			reply("213 %d", len(s.data))
+		case "MDTM":
+			reply("213 %s", ftpModified.Format("20060102150405"))
+		case "REST":
+			if s.noRest {
+				reply("502 REST não implementado")
+				continue
+			}
+			rest, _ = strconv.ParseInt(arg, 10, 64)
+			reply("350 ok")
+		case "EPSV":
+			if dataLn, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+				reply("425 sem conexão de dados")
+				continue
+			}
+			reply("229 passivo (|||%d|)", dataLn.Addr().(*net.TCPAddr).Port)
+		case "RETR":
+			if fail {
+				reply("%s", s.retrReply)
+				continue
+			}
+			if dataLn == nil {
+				reply("425 use EPSV")
+				continue
+			}
+			reply("150 enviando")
+			data, err := dataLn.Accept()
+			dataLn.Close()
+			dataLn = nil
+			if err != nil {
+				return
+			}
+			// O cliente fecha a conexão de dados ao ter a faixa
+			data.Write(s.data[rest:])
+			data.Close()
+			rest = 0
+			reply("226 fim")
+		default:
+			reply("502 comando não implementado")
+		}
+	}
+}
+
+// SIZE e MDTM dão o tamanho e a data, e o REST aceito libera os chunks
+func TestFTPFileInfo(t *testing.T) {
+	data := testData(10000)
+	srv := newFakeFTP(t, data)
+
+	info, err := ftpFileInfo(context.Background(), Config{}, srv.url())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len(data)) || !info.AcceptRanges {
+		t.Errorf("tamanho %d, faixas %v", info.Size, info.AcceptRanges)
+	}
+	if !info.LastModified.Equal(ftpModified) {
+		t.Errorf("data %v, esperada %v", info.LastModified, ftpModified)
+	}
+	if got := info.Header.Get("Last-Modified"); got != ftpModified.Format(http.TimeFormat) {
+		t.Errorf("Last-Modified %q", got)
+	}
+
+	srv.noRest = true
+	info, err = ftpFileInfo(context.Background(), Config{}, srv.url())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.AcceptRanges {
+		t.Error("servidor sem REST aceitando faixas")
+	}
+
+	// Arquivo inexistente falha já no SIZE
+	_, err = ftpFileInfo(context.Background(), Config{}, strings.TrimSuffix(srv.url(), "arquivo.bin")+"outro.bin")
+	var se *statusError
+	if !errors.As(err, &se) || se.code != http.StatusNotFound {
+		t.Errorf("erro %v, esperado 550 como não encontrado", err)
+	}
+}
+
+// Cada chunk abre a sua conexão e pede a faixa com REST antes do RETR
+func TestFTPChunks(t *testing.T) {
+	data := testData(10000)
+	srv := newFakeFTP(t, data)
+	cfg := testConfig(t, srv.url())
+
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+
+	if n := srv.count("RETR "); n != int(cfg.Threads) {
+		t.Errorf("%d RETR, esperado um por chunk (%d)", n, cfg.Threads)
+	}
+	// Os chunks depois do primeiro começam com REST na sua posição
+	rests := map[string]bool{}
+	for _, c := range srv.Commands() {
+		if strings.HasPrefix(c, "REST ") && c != "REST 0" {
+			rests[c] = true
+		}
+	}
+	for _, want := range []string{"REST 2500", "REST 5000", "REST 7500"} {
+		if !rests[want] {
+			t.Errorf("sem %s nos comandos %v", want, srv.Commands())
+		}
+	}
+}
+
+// Sem REST o arquivo vem num único RETR desde o início
+func TestFTPWithoutRest(t *testing.T) {
+	data := testData(10000)
+	srv := newFakeFTP(t, data)
+	srv.noRest = true
+	cfg := testConfig(t, srv.url())
+
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+
+	if n := srv.count("RETR "); n != 1 {
+		t.Errorf("%d RETR, esperado um só", n)
+	}
+	// Só o REST 0 da consulta, recusado
+	if n := srv.count("REST "); n != 1 {
+		t.Errorf("%d REST, esperado só o da consulta: %v", n, srv.Commands())
+	}
+}
+
+// Um 4xx no RETR é temporário e o chunk tenta de novo; um 5xx é permanente
+// e o download falha sem novas tentativas
+func TestFTPRetrError(t *testing.T) {
+	data := testData(10000)
+
+	srv := newFakeFTP(t, data)
+	srv.retrReply, srv.retrFails = "450 arquivo ocupado", 1
+	cfg := testConfig(t, srv.url())
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+	if n := srv.count("RETR "); n != int(cfg.Threads)+1 {
+		t.Errorf("%d RETR, esperados %d com a nova tentativa", n, cfg.Threads+1)
+	}
+
+	srv = newFakeFTP(t, data)
+	srv.retrReply, srv.retrFails = "550 permissão negada", 1
+	cfg = testConfig(t, srv.url())
+	cfg.Threads = 1
+	_, _, err := runDownload(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "550 permissão negada") {
+		t.Fatalf("erro %v, esperado o 550 do RETR", err)
+	}
+	if n := srv.count("RETR "); n != 1 {
+		t.Errorf("%d RETR depois de um 550, esperado nenhuma nova tentativa", n)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// Tentativas de buscar o hash publicado em -hash-url antes de desistir
+const maxHashAttempts = 8
+
+// O endpoint ainda não tem o hash do conteúdo (ex.: está sendo calculado):
+// justifica nova tentativa, ao contrário de um hash diferente
+var errHashNotReady = errors.New("hash remoto ainda não disponível")
+
+// Monta a URL do hash a partir do modelo de -hash-url. {url} é a URL do
+// download e {name} o nome do arquivo remoto.
+func hashURL(template, rawURL string) string {
+	return strings.NewReplacer(
+		"{url}", rawURL,
+		"{name}", getFileName(rawURL),
+	).Replace(template)
+}
+
+// Lê o hash do corpo da resposta, aceitando tanto só o hash quanto uma linha
+// no formato do sha256sum ("<sha256>  <arquivo>")
+func parseHashBody(body string) (string, error) {
+	fields := strings.Fields(body)
+	if len(fields) == 0 {
+		return "", errHashNotReady
+	}
+	sum := strings.ToLower(fields[0])
+	if len(sum) != 64 || strings.Trim(sum, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("hash remoto inválido: %q", fields[0])
+	}
+	return sum, nil
+}
+
+func fetchRemoteHash(ctx context.Context, cfg Config, url string) (string, error) {
+	req, err := newRequest(ctx, cfg, "GET", url)
+	if err != nil {
+		return "", err
+	}
+	resp, err := cfg.do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errHashNotReady, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusAccepted, http.StatusNotFound, http.StatusTooEarly,
+		http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return "", fmt.Errorf("%w: %s", errHashNotReady, resp.Status)
+	default:
+		return "", fmt.Errorf("erro buscando hash remoto: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errHashNotReady, err)
+	}
+	return parseHashBody(string(body))
+}
+
+// Busca o hash publicado pelo servidor depois do download e compara com o
+// arquivo. Enquanto o hash não estiver pronto tenta de novo; um hash
+// diferente falha na hora.
+func (d *download) verifyRemoteHash(ctx context.Context) error {
+	url := hashURL(d.cfg.HashURL, d.cfg.URL)
+
+	for attempt := 1; ; attempt++ {
+		expected, err := fetchRemoteHash(ctx, d.cfg, url)
+		if err == nil {
+			return d.compareChecksum(defaultAlgo, expected)
+		}
+		if !errors.Is(err, errHashNotReady) || attempt == maxHashAttempts {
+			return err
+		}
+
+		delay := retryDelay(attempt)
+		slog.Info("Hash remoto indisponível, tentando novamente", "url", url, "tentativa", attempt, "maximo", maxHashAttempts, "erro", err, "espera", delay)
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
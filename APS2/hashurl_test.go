@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestHashURL(t *testing.T) {
+	got := hashURL("{url}.sha256", "https://exemplo.com/dir/a.iso")
+	if got != "https://exemplo.com/dir/a.iso.sha256" {
+		t.Errorf("hashURL({url}) = %s", got)
+	}
+	got = hashURL("https://hashes.exemplo.com/{name}", "https://exemplo.com/dir/a.iso?x=1")
+	if got != "https://hashes.exemplo.com/a.iso" {
+		t.Errorf("hashURL({name}) = %s", got)
+	}
+}
+
+func TestParseHashBody(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	tests := []struct {
+		body     string
+		want     string
+		notReady bool
+		ok       bool
+	}{
+		{sum, sum, false, true},
+		{strings.ToUpper(sum) + "  a.iso\n", sum, false, true},
+		{"", "", true, false},
+		{" \n", "", true, false},
+		{"abc", "", false, false},
+		{strings.Repeat("zz", 32), "", false, false},
+	}
+	for _, tt := range tests {
+		got, err := parseHashBody(tt.body)
+		if got != tt.want || (err == nil) != tt.ok || errors.Is(err, errHashNotReady) != tt.notReady {
+			t.Errorf("parseHashBody(%q) = %q, %v; esperado %q, ok=%v", tt.body, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+// Servidor do arquivo com um endpoint de hash que responde status antes de
+// ter o hash pronto
+func hashServer(t *testing.T, data []byte, pending []int, sum string) (string, func() int) {
+	var mu sync.Mutex
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, ".sha256") {
+			serveRange(w, r, data)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		hits++
+		if hits <= len(pending) {
+			w.WriteHeader(pending[hits-1])
+			return
+		}
+		w.Write([]byte(sum + "  arquivo.bin\n"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/arquivo.bin", func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return hits
+	}
+}
+
+// Hash indisponível primeiro e depois pronto: o download espera por ele e
+// confere; um hash diferente falha sem novas consultas
+func TestRemoteHash(t *testing.T) {
+	data := testData(10000)
+	sum := sha256.Sum256(data)
+	good := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name    string
+		pending []int
+		sum     string
+		ok      bool
+	}{
+		{"pronto depois de 503", []int{http.StatusServiceUnavailable}, good, true},
+		{"pronto depois de 202", []int{http.StatusAccepted}, good, true},
+		{"diferente depois de 404", []int{http.StatusNotFound}, strings.Repeat("0", 64), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, hits := hashServer(t, data, tt.pending, tt.sum)
+			cfg := testConfig(t, url)
+			cfg.HashURL = "{url}.sha256"
+
+			_, _, err := runDownload(context.Background(), cfg)
+			if (err == nil) != tt.ok {
+				t.Fatalf("runDownload() = %v, esperado ok=%v", err, tt.ok)
+			}
+			if err != nil && !strings.Contains(err.Error(), "checksum não confere") {
+				t.Errorf("erro %v, esperado checksum não confere", err)
+			}
+			// Uma consulta por status pendente e a que trouxe o hash
+			if want := len(tt.pending) + 1; hits() != want {
+				t.Errorf("hash consultado %d vezes, esperadas %d", hits(), want)
+			}
+		})
+	}
+}
+
+// Um status que não indica hash pendente falha sem nova consulta
+func TestRemoteHashError(t *testing.T) {
+	data := testData(10000)
+	url, hits := hashServer(t, data, []int{http.StatusForbidden}, "")
+	cfg := testConfig(t, url)
+	cfg.HashURL = "{url}.sha256"
+
+	_, _, err := runDownload(context.Background(), cfg)
+	if err == nil || errors.Is(err, errHashNotReady) {
+		t.Fatalf("erro %v, esperado erro definitivo do hash remoto", err)
+	}
+	if hits() != 1 {
+		t.Errorf("hash consultado %d vezes, esperada 1", hits())
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Cada download, concluído ou não, vira uma linha do histórico, que outra
+// execução lê de volta com os mesmos campos
+func TestHistoryRecordsDownloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "historico.jsonl")
+	began := time.Now()
+
+	data := testData(10000)
+	srv := newRangeServer(t, data)
+	cfg := testConfig(t, srv.fileURL())
+	cfg.History = OpenHistory(path)
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	failCfg := testConfig(t, missing.URL+"/sumiu.bin")
+	failCfg.History = cfg.History
+	if _, _, err := runDownload(context.Background(), failCfg); err == nil {
+		t.Fatal("download de um arquivo inexistente terminou sem erro")
+	}
+
+	entries, err := OpenHistory(path).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("%d registros no histórico, esperados 2", len(entries))
+	}
+
+	sum := sha256.Sum256(data)
+	ok := entries[0]
+	if ok.URL != cfg.URL || ok.Name != cfg.Output || ok.Size != int64(len(data)) || ok.Outcome != outcomeCompleted {
+		t.Errorf("registro do download concluído: %+v", ok)
+	}
+	if ok.Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("checksum %q, esperado o SHA-256 do arquivo", ok.Checksum)
+	}
+	if ok.Error != "" || ok.Duration <= 0 || ok.Timestamp.Before(began.Add(-time.Second)) {
+		t.Errorf("erro %q, duração %s, início %s", ok.Error, ok.Duration, ok.Timestamp)
+	}
+
+	failed := entries[1]
+	if failed.URL != failCfg.URL || failed.Outcome != outcomeFailed || failed.Error == "" || failed.Checksum != "" {
+		t.Errorf("registro do download com falha: %+v", failed)
+	}
+}
+
+func TestHistoryListWithoutFile(t *testing.T) {
+	entries, err := OpenHistory(filepath.Join(t.TempDir(), "nao-existe.jsonl")).List()
+	if err != nil || len(entries) != 0 {
+		t.Errorf("List() = %v, %v; esperado histórico vazio sem erro", entries, err)
+	}
+}
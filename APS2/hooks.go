@@ -0,0 +1,77 @@
+package main
+
+import "time"
+
+// Faixa de bytes de um chunk, com as duas pontas inclusas
+type ByteRange struct {
+	Start, End int64
+}
+
+// Resultado final de um download, passado para Hooks.OnComplete
+type Result struct {
+	URL    string
+	Output string
+	Size   int64
+	// Tempo desde o início de runDownload
+	Elapsed time.Duration
+	// O arquivo local já estava atualizado e nada foi baixado
+	Skipped bool
+	// nil quando o download terminou bem
+	Err error
+}
+
+// Funções chamadas nas etapas de um download, para quem usa o código como
+// biblioteca acompanhar o andamento sem ler os logs ou o -json. Qualquer
+// campo pode ficar nil. As funções de chunk e de progresso são chamadas de
+// várias goroutines ao mesmo tempo e devem retornar rápido: o chunk espera
+// a função terminar.
+type Hooks struct {
+	// Tamanho do arquivo, ou -1 se desconhecido, quando os chunks começam
+	OnStart func(totalSize int64)
+	// Um chunk vai ser baixado
+	OnChunkStart func(r ByteRange)
+	// Um chunk terminou, com os bytes baixados em todas as tentativas
+	OnChunkDone func(r ByteRange, bytes int64, dur time.Duration)
+	// A tentativa attempt da faixa falhou com err e vai ser repetida
+	OnRetry func(r ByteRange, attempt int, err error)
+	// A cada segundo, com os bytes já gravados (inclusive os de uma retomada)
+	OnProgress func(done, total int64)
+	// O download terminou, com ou sem erro
+	OnComplete func(result Result)
+}
+
+func (h *Hooks) start(total int64) {
+	if h != nil && h.OnStart != nil {
+		h.OnStart(total)
+	}
+}
+
+func (h *Hooks) chunkStart(start, end int64) {
+	if h != nil && h.OnChunkStart != nil {
+		h.OnChunkStart(ByteRange{start, end})
+	}
+}
+
+func (h *Hooks) chunkDone(start, end, bytes int64, dur time.Duration) {
+	if h != nil && h.OnChunkDone != nil {
+		h.OnChunkDone(ByteRange{start, end}, bytes, dur)
+	}
+}
+
+func (h *Hooks) retry(start, end int64, attempt int, err error) {
+	if h != nil && h.OnRetry != nil {
+		h.OnRetry(ByteRange{start, end}, attempt, err)
+	}
+}
+
+func (h *Hooks) progress(done, total int64) {
+	if h != nil && h.OnProgress != nil {
+		h.OnProgress(done, total)
+	}
+}
+
+func (h *Hooks) complete(r Result) {
+	if h != nil && h.OnComplete != nil {
+		h.OnComplete(r)
+	}
+}
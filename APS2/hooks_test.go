@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Ordem dos Hooks num download com uma falha por faixa: OnStart antes de
+// tudo, cada OnRetry e OnChunkDone depois do OnChunkStart da sua faixa, e
+// OnComplete uma vez, por último
+func TestHooksOrder(t *testing.T) {
+	data := testData(10000)
+	srv := newFaultServer(t, data, faults{fail: 1})
+	cfg := testConfig(t, srv.fileURL())
+
+	var (
+		mu        sync.Mutex
+		events    []string
+		started   = map[ByteRange]bool{}
+		doneBytes int64
+		retries   int
+		lastDone  int64
+		results   []Result
+	)
+	record := func(e string) {
+		events = append(events, e)
+	}
+	cfg.Hooks = &Hooks{
+		OnStart: func(total int64) {
+			mu.Lock()
+			defer mu.Unlock()
+			record("start")
+			if total != int64(len(data)) {
+				t.Errorf("OnStart com %d bytes, esperado %d", total, len(data))
+			}
+		},
+		OnChunkStart: func(r ByteRange) {
+			mu.Lock()
+			defer mu.Unlock()
+			record("chunk-start")
+			started[r] = true
+		},
+		OnRetry: func(r ByteRange, attempt int, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			record("retry")
+			retries++
+			if !started[r] {
+				t.Errorf("OnRetry da faixa %v antes do OnChunkStart", r)
+			}
+			if attempt != 1 || err == nil {
+				t.Errorf("OnRetry com tentativa %d e erro %v", attempt, err)
+			}
+		},
+		OnChunkDone: func(r ByteRange, bytes int64, _ time.Duration) {
+			mu.Lock()
+			defer mu.Unlock()
+			record("chunk-done")
+			if !started[r] {
+				t.Errorf("OnChunkDone da faixa %v sem OnChunkStart", r)
+			}
+			if bytes != r.End-r.Start+1 {
+				t.Errorf("OnChunkDone da faixa %v com %d bytes", r, bytes)
+			}
+			doneBytes += bytes
+		},
+		OnProgress: func(done, total int64) {
+			mu.Lock()
+			defer mu.Unlock()
+			lastDone = done
+		},
+		OnComplete: func(r Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			record("complete")
+			results = append(results, r)
+		},
+	}
+
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) == 0 || events[0] != "start" {
+		t.Fatalf("primeiro hook %q, esperado start", events)
+	}
+	if events[len(events)-1] != "complete" || len(results) != 1 {
+		t.Fatalf("OnComplete chamado %d vezes, último hook %q", len(results), events[len(events)-1])
+	}
+	if r := results[0]; r.Err != nil || r.Size != int64(len(data)) || r.Output != cfg.Output {
+		t.Errorf("Result = %+v", r)
+	}
+	if len(started) != len(faultChunks) || retries != len(faultChunks) {
+		t.Errorf("%d faixas iniciadas e %d novas tentativas, esperadas %d de cada", len(started), retries, len(faultChunks))
+	}
+	if doneBytes != int64(len(data)) {
+		t.Errorf("OnChunkDone soma %d bytes, esperados %d", doneBytes, len(data))
+	}
+	if lastDone != int64(len(data)) {
+		t.Errorf("último OnProgress com %d bytes, esperado %d", lastDone, len(data))
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Transferências simultâneas por host (-max-per-host), somando os chunks de
+// todos os arquivos e espelhos que usam o mesmo HostLimiter. Diferente de
+// -max-conns-per-host, que limita as conexões do transporte HTTP, conta
+// cada faixa em andamento, inclusive as multiplexadas no HTTP/2 e as de FTP
+// e SFTP, e as requisições curtas feitas por Config.do. nil não limita.
+type HostLimiter struct {
+	limit int
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+func NewHostLimiter(limit int) *HostLimiter {
+	return &HostLimiter{limit: limit, slots: map[string]chan struct{}{}}
+}
+
+func (h *HostLimiter) slot(host string) chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.slots[host]
+	if !ok {
+		s = make(chan struct{}, h.limit)
+		h.slots[host] = s
+	}
+	return s
+}
+
+// Espera uma vaga no host da URL. A função devolvida libera a vaga e deve
+// ser chamada mesmo quando a transferência falha.
+func (h *HostLimiter) acquire(ctx context.Context, rawURL string) (release func(), err error) {
+	if h == nil || h.limit <= 0 {
+		return func() {}, nil
+	}
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		host = strings.ToLower(u.Host)
+	}
+
+	s := h.slot(host)
+	select {
+	case s <- struct{}{}:
+	default:
+		slog.Debug("Aguardando vaga no host", "host", host, "limite", h.limit)
+		select {
+		case s <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return func() { <-s }, nil
+}
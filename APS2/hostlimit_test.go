@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Todas as requisições ao host contam para o -max-per-host: o HEAD, o GET
+// de teste do Range, o arquivo de checksum e as faixas
+func TestHostLimiterCountsEveryRequest(t *testing.T) {
+	data := testData(100000)
+	sum := sha256.Sum256(data)
+	sidecar := hex.EncodeToString(sum[:]) + "  arquivo.bin\n"
+
+	var mu sync.Mutex
+	active, peak := 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		active++
+		peak = max(peak, active)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			active--
+			mu.Unlock()
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		switch {
+		case r.URL.Path == "/arquivo.bin.sha256":
+			w.Write([]byte(sidecar))
+		case r.Method == http.MethodHead:
+			// Sem Accept-Ranges, para que o download sonde o Range com GET
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		default:
+			serveRange(w, r, data)
+		}
+	}))
+	defer srv.Close()
+
+	const limit = 2
+	limiter := NewHostLimiter(limit)
+	var wg sync.WaitGroup
+	for i := range 3 {
+		cfg := testConfig(t, srv.URL+"/arquivo.bin")
+		cfg.Output = filepath.Join(t.TempDir(), "arquivo.bin")
+		cfg.ChecksumURL = srv.URL + "/arquivo.bin.sha256"
+		cfg.HostLimiter = limiter
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := runDownload(context.Background(), cfg); err != nil {
+				t.Errorf("download %d: %v", i, err)
+				return
+			}
+			checkFile(t, cfg.Output, data)
+		}()
+	}
+	wg.Wait()
+
+	if peak > limit {
+		t.Errorf("%d requisições simultâneas no host, limite %d", peak, limit)
+	}
+}
+
+// Um 416 consulta o tamanho de novo com a vaga da faixa ainda ocupada; com
+// uma vaga só a consulta não pode esperar por outra
+func TestHostLimiterSizeRecheck(t *testing.T) {
+	data := testData(10000)
+	var mu sync.Mutex
+	refused := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		first := r.Header.Get("Range") != "" && !refused
+		refused = refused || first
+		mu.Unlock()
+		if first {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		serveRange(w, r, data)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(t, srv.URL+"/arquivo.bin")
+	cfg.HostLimiter = NewHostLimiter(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, _, err := runDownload(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+}
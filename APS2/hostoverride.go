@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Limites específicos de um host, para tratar com educação servidores que
+// aceitam menos conexões. Zero mantém o valor global.
+type HostOverride struct {
+	Threads int64
+	LimitMB int64
+
+	// Limitador compartilhado pelos arquivos deste host com -input e
+	// -manifest; nil cria um por download
+	limiter *RateLimiter
+}
+
+// Com vários arquivos, cada host com -host-limit ganha um único limitador,
+// para que o limite valha para a soma dos arquivos daquele host
+func shareHostLimits(cfg Config) {
+	for host, o := range cfg.HostOverrides {
+		if o.LimitMB > 0 {
+			o.limiter = cfg.newRateLimiter(o.LimitMB)
+			cfg.HostOverrides[host] = o
+		}
+	}
+}
+
+// Procura o override do host: nome exato primeiro, depois o padrão
+// "*.dominio" mais específico
+func findHostOverride(overrides map[string]HostOverride, host string) (HostOverride, bool) {
+	host = strings.ToLower(host)
+	if o, ok := overrides[host]; ok {
+		return o, true
+	}
+
+	patterns := make([]string, 0, len(overrides))
+	for p := range overrides {
+		if strings.HasPrefix(p, "*.") {
+			patterns = append(patterns, p)
+		}
+	}
+	sort.Slice(patterns, func(i, j int) bool { return len(patterns[i]) > len(patterns[j]) })
+
+	for _, p := range patterns {
+		if hostMatches(host, p) {
+			return overrides[p], true
+		}
+	}
+	return HostOverride{}, false
+}
+
+func (c Config) applyHostOverride(rawURL string) Config {
+	if len(c.HostOverrides) == 0 {
+		return c
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return c
+	}
+
+	o, ok := findHostOverride(c.HostOverrides, u.Hostname())
+	if !ok {
+		return c
+	}
+	if o.Threads > 0 {
+		c.Threads = o.Threads
+		c.AutoThreads = false
+	}
+	if o.LimitMB > 0 {
+		// O host tem limite próprio, fora do limitador global
+		c.LimitMB = o.LimitMB
+		c.RateLimiter = o.limiter
+	}
+	slog.Info("Usando limites do host", "host", u.Hostname(), "threads", c.Threads, "limiteMB", c.LimitMB)
+	return c
+}
+
+// Flags -host-threads e -host-limit no formato "host=valor"
+type hostOverrideFlag struct {
+	overrides map[string]HostOverride
+	limit     bool
+}
+
+func (f hostOverrideFlag) String() string {
+	return ""
+}
+
+func (f hostOverrideFlag) Set(value string) error {
+	host, v, ok := strings.Cut(value, "=")
+	host = strings.ToLower(strings.TrimSpace(host))
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if !ok || host == "" || err != nil || n <= 0 {
+		return fmt.Errorf("valor inválido %q, use host=número", value)
+	}
+
+	o := f.overrides[host]
+	if f.limit {
+		o.LimitMB = n
+	} else {
+		o.Threads = n
+	}
+	f.overrides[host] = o
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFindHostOverride(t *testing.T) {
+	overrides := map[string]HostOverride{
+		"cdn.exemplo.com":  {Threads: 2},
+		"*.exemplo.com":    {Threads: 4},
+		"*.eu.exemplo.com": {Threads: 8},
+	}
+	tests := []struct {
+		host    string
+		threads int64
+		ok      bool
+	}{
+		{"cdn.exemplo.com", 2, true},
+		{"CDN.Exemplo.com", 2, true},
+		{"www.exemplo.com", 4, true},
+		// O padrão mais específico vence
+		{"a.eu.exemplo.com", 8, true},
+		{"exemplo.com", 0, false},
+		{"outro.net", 0, false},
+	}
+	for _, tt := range tests {
+		o, ok := findHostOverride(overrides, tt.host)
+		if ok != tt.ok || o.Threads != tt.threads {
+			t.Errorf("%s: threads %d, ok=%v; esperado %d, ok=%v", tt.host, o.Threads, ok, tt.threads, tt.ok)
+		}
+	}
+}
+
+func TestHostOverrideFlag(t *testing.T) {
+	overrides := map[string]HostOverride{}
+	threads := hostOverrideFlag{overrides: overrides}
+	limit := hostOverrideFlag{overrides: overrides, limit: true}
+	if err := threads.Set(" CDN.exemplo.com = 2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := limit.Set("cdn.exemplo.com=5"); err != nil {
+		t.Fatal(err)
+	}
+	if o := overrides["cdn.exemplo.com"]; o.Threads != 2 || o.LimitMB != 5 {
+		t.Errorf("override %+v, esperado 2 threads e 5MB/s", o)
+	}
+	for _, v := range []string{"cdn.exemplo.com", "=2", "cdn.exemplo.com=0", "cdn.exemplo.com=x"} {
+		if err := threads.Set(v); err == nil {
+			t.Errorf("-host-threads %q aceito", v)
+		}
+	}
+}
+
+// O override vale para o host da URL final: só o destino do redirecionamento
+// muda o número de chunks
+func TestHostOverrideDownload(t *testing.T) {
+	data := testData(10000)
+	target := newRangeServer(t, data)
+	targetURL, _ := url.Parse(target.fileURL())
+	targetURL.Host = strings.Replace(targetURL.Host, "127.0.0.1", "localhost", 1)
+	redirect := httptest.NewServer(http.RedirectHandler(targetURL.String(), http.StatusFound))
+	defer redirect.Close()
+
+	tests := []struct {
+		name      string
+		overrides map[string]HostOverride
+		chunks    int
+	}{
+		{"host final", map[string]HostOverride{"localhost": {Threads: 2}}, 2},
+		{"host de origem", map[string]HostOverride{"127.0.0.1": {Threads: 2}}, 4},
+		{"outro host", map[string]HostOverride{"outro.net": {Threads: 2}}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := countRanged(target.Requests())
+			cfg := testConfig(t, redirect.URL+"/arquivo.bin")
+			cfg.HostOverrides = tt.overrides
+			if _, _, err := runDownload(context.Background(), cfg); err != nil {
+				t.Fatal(err)
+			}
+			checkFile(t, cfg.Output, data)
+			if n := countRanged(target.Requests()) - before; n != tt.chunks {
+				t.Errorf("%d faixas pedidas, esperadas %d", n, tt.chunks)
+			}
+		})
+	}
+}
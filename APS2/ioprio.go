@@ -0,0 +1,22 @@
+package main
+
+import "fmt"
+
+// Classes de prioridade de IO (ioprio) do Linux
+const (
+	ioClassNone       = 0
+	ioClassBestEffort = 2
+	ioClassIdle       = 3
+)
+
+func parseIOClass(name string) (int, error) {
+	switch name {
+	case "":
+		return ioClassNone, nil
+	case "best-effort":
+		return ioClassBestEffort, nil
+	case "idle":
+		return ioClassIdle, nil
+	}
+	return 0, fmt.Errorf("classe de IO inválida %q (use idle ou best-effort)", name)
+}
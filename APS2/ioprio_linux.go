@@ -0,0 +1,53 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+	// Nível padrão usado pelo kernel para a classe best-effort
+	ioprioDefaultLevel = 4
+)
+
+var ioprioSet = func(which, who, prio int) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, uintptr(which), uintptr(who), uintptr(prio))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Aplica a prioridade a todas as threads do processo. No Linux a prioridade
+// é por thread e as novas threads herdam a de quem as criou.
+func setIOPriority(class int) error {
+	if class == ioClassNone {
+		return nil
+	}
+
+	level := 0
+	if class == ioClassBestEffort {
+		level = ioprioDefaultLevel
+	}
+	prio := class<<ioprioClassShift | level
+
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return ioprioSet(ioprioWhoProcess, 0, prio)
+	}
+	for _, t := range tasks {
+		tid, err := strconv.Atoi(t.Name())
+		if err != nil {
+			continue
+		}
+		if err := ioprioSet(ioprioWhoProcess, tid, prio); err != nil {
+			return err
+		}
+	}
+	return nil
+}
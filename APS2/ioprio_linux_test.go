@@ -0,0 +1,69 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"syscall"
+	"testing"
+)
+
+type ioprioCall struct{ which, who, prio int }
+
+// Troca a syscall por uma que só registra as chamadas
+func fakeIOPrioSet(t *testing.T, err error) *[]ioprioCall {
+	var calls []ioprioCall
+	orig := ioprioSet
+	ioprioSet = func(which, who, prio int) error {
+		calls = append(calls, ioprioCall{which, who, prio})
+		return err
+	}
+	t.Cleanup(func() { ioprioSet = orig })
+	return &calls
+}
+
+func TestSetIOPriority(t *testing.T) {
+	tests := []struct {
+		class int
+		prio  int
+	}{
+		{ioClassIdle, ioClassIdle << ioprioClassShift},
+		{ioClassBestEffort, ioClassBestEffort<<ioprioClassShift | ioprioDefaultLevel},
+	}
+	for _, tt := range tests {
+		calls := fakeIOPrioSet(t, nil)
+		if err := setIOPriority(tt.class); err != nil {
+			t.Fatal(err)
+		}
+		// Uma chamada por thread, a principal inclusive
+		var tids []int
+		for _, c := range *calls {
+			if c.which != ioprioWhoProcess || c.prio != tt.prio {
+				t.Errorf("classe %d: ioprio_set(%d, %d, %#x), esperado prio %#x", tt.class, c.which, c.who, c.prio, tt.prio)
+			}
+			tids = append(tids, c.who)
+		}
+		if !slices.Contains(tids, os.Getpid()) {
+			t.Errorf("classe %d: thread principal %d fora das chamadas %v", tt.class, os.Getpid(), tids)
+		}
+	}
+}
+
+func TestSetIOPriorityNone(t *testing.T) {
+	calls := fakeIOPrioSet(t, nil)
+	if err := setIOPriority(ioClassNone); err != nil {
+		t.Fatal(err)
+	}
+	if len(*calls) != 0 {
+		t.Errorf("%d chamadas sem -io-class", len(*calls))
+	}
+}
+
+func TestSetIOPriorityError(t *testing.T) {
+	fakeIOPrioSet(t, syscall.EPERM)
+	if err := setIOPriority(ioClassIdle); !errors.Is(err, syscall.EPERM) {
+		t.Errorf("setIOPriority() = %v, esperado EPERM", err)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import "log/slog"
+
+func setIOPriority(class int) error {
+	if class != ioClassNone {
+		slog.Warn("-io-class só é suportado no Linux, ignorando")
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestParseIOClass(t *testing.T) {
+	tests := []struct {
+		name  string
+		class int
+		ok    bool
+	}{
+		{"", ioClassNone, true},
+		{"idle", ioClassIdle, true},
+		{"best-effort", ioClassBestEffort, true},
+		{"realtime", 0, false},
+		{"Idle", 0, false},
+	}
+	for _, tt := range tests {
+		class, err := parseIOClass(tt.name)
+		if (err == nil) != tt.ok || class != tt.class {
+			t.Errorf("parseIOClass(%q) = %d, %v; esperado %d, ok=%v", tt.name, class, err, tt.class, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+func parseLogLevel(s string) (slog.Level, error) {
+	switch s {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("nível de log inválido: %s (use debug, info, warn ou error)", s)
+}
+
+// Logger dos erros que encerram o programa. Fica sempre no stderr, mesmo
+// com -json, para que a saída com erro nunca aconteça sem mensagem.
+var fatalLogger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// Configura o logger padrão em stderr. Com -json os logs são descartados
+// para não se misturarem aos eventos, menos os de fatal.
+func setupLogger(level slog.Level, discard bool) {
+	var w io.Writer = os.Stderr
+	if discard {
+		w = io.Discard
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: level})))
+	if !discard {
+		fatalLogger = slog.Default()
+	}
+}
+
+func fatal(msg string, args ...any) {
+	fatalLogger.Error(msg, args...)
+	os.Exit(1)
+}
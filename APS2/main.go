@@ -1,16 +1,23 @@
 package main
 
 import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"path"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -29,44 +36,259 @@ func getFileName(rawURL string) string {
 	return fileName
 }
 
-func getFileSize(url string) (int64, error) {
-	resp, err := http.Head(url)
+// Informações do arquivo remoto obtidas no HEAD
+type remoteInfo struct {
+	Size int64
+	ETag string
+	// URL final depois dos redirecionamentos do HEAD e a que foi pedida
+	URL       string
+	Requested string
+	Header    http.Header
+	// Servidor aceita requisições com Range
+	AcceptRanges bool
+	// Content-Encoding da resposta; faixas de um conteúdo compactado não
+	// podem ser montadas como se fossem do arquivo original
+	Encoding string
+	// Last-Modified do servidor; zero se ausente ou inválido
+	LastModified time.Time
+	// Servidor respondeu 304 ao If-Modified-Since: a cópia local está
+	// atualizada e os demais campos ficam vazios
+	NotModified bool
+}
+
+func lastModified(h http.Header) time.Time {
+	t, err := http.ParseTime(h.Get("Last-Modified"))
 	if err != nil {
-		return 0, err
+		return time.Time{}
 	}
-	defer resp.Body.Close()
+	return t
+}
+
+const (
+	version          = "1.0"
+	defaultUserAgent = "aps2-downloader/" + version
+)
+
+// Cria uma requisição com os cabeçalhos configurados pelo usuário. O Range
+// é sempre definido por quem chama, nunca pelo usuário.
+func newRequest(ctx context.Context, cfg Config, method, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	userAgent := cfg.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
 
-	if resp.Header.Get("Accept-Ranges") != "bytes" {
-		return 0, fmt.Errorf("servidor não suporta downloads parciais (range requests)")
+	for key, values := range cfg.Header {
+		switch http.CanonicalHeaderKey(key) {
+		case "Range":
+			continue
+		case "Host":
+			req.Host = values[0]
+			continue
+		case "User-Agent":
+			req.Header.Del(key)
+		}
+		for _, v := range values {
+			req.Header.Add(key, v)
+		}
+	}
+
+	if cfg.Username != "" {
+		req.SetBasicAuth(cfg.Username, cfg.Password)
+	} else if cfg.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.BearerToken)
+	}
+	if cfg.redirectedHost != "" && strings.EqualFold(req.URL.Host, cfg.redirectedHost) {
+		stripCredentials(req, cfg)
+	}
+	return req, nil
+}
+
+func getFileSize(ctx context.Context, cfg Config, url string) (remoteInfo, error) {
+	if isFTP(url) || isSFTP(url) {
+		// A conexão de controle ocupa uma vaga no host, como as de HTTP
+		release, err := cfg.HostLimiter.acquire(ctx, url)
+		if err != nil {
+			return remoteInfo{}, err
+		}
+		defer release()
+		if isFTP(url) {
+			return ftpFileInfo(ctx, cfg, url)
+		}
+		return sftpFileInfo(ctx, cfg, url)
+	}
+	req, err := newRequest(ctx, cfg, "HEAD", url)
+	if err != nil {
+		return remoteInfo{}, err
+	}
+
+	resp, err := cfg.do(req)
+	if err != nil {
+		return probeFileSize(ctx, cfg, url, err)
+	}
+	// O HEAD não tem corpo: fecha já para liberar a vaga no host antes das
+	// sondagens com GET
+	resp.Body.Close()
+	slog.Debug("Resposta do HEAD", "status", resp.Status, "protocolo", resp.Proto)
+
+	if resp.StatusCode == http.StatusNotModified {
+		return remoteInfo{URL: resp.Request.URL.String(), NotModified: true}, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return probeFileSize(ctx, cfg, url, fmt.Errorf("HEAD retornou %s", resp.Status))
 	}
 
 	sizeStr := resp.Header.Get("Content-Length")
 	if sizeStr == "" {
-		return 0, fmt.Errorf("servidor não retornou Content-Length")
+		return probeFileSize(ctx, cfg, url, fmt.Errorf("HEAD sem Content-Length"))
 	}
 
 	size, err := strconv.ParseInt(sizeStr, 10, 64)
 	if err != nil {
-		return 0, err
+		return remoteInfo{}, err
 	}
 
-	return size, nil
+	info := remoteInfo{
+		Size:         size,
+		ETag:         resp.Header.Get("ETag"),
+		URL:          resp.Request.URL.String(),
+		Requested:    url,
+		Header:       resp.Header,
+		AcceptRanges: resp.Header.Get("Accept-Ranges") == "bytes",
+		Encoding:     resp.Header.Get("Content-Encoding"),
+		LastModified: lastModified(resp.Header),
+	}
+	// Muitos servidores aceitam Range sem anunciar no HEAD; só um
+	// "Accept-Ranges: none" explícito dispensa o teste
+	if !info.AcceptRanges && size > 0 && resp.Header.Get("Accept-Ranges") != "none" {
+		info.AcceptRanges = probeRanges(ctx, cfg.redirectedFrom(url, info.URL), info.URL, size)
+	}
+	return info, nil
+}
+
+// Pede o primeiro byte com Range para descobrir se o servidor atende faixas
+// mesmo sem Accept-Ranges no HEAD. Qualquer resposta que não seja um 206 com
+// o tamanho total esperado mantém o fluxo único.
+func probeRanges(ctx context.Context, cfg Config, url string, size int64) bool {
+	req, err := newRequest(ctx, cfg, "GET", url)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err := cfg.do(req)
+	if err != nil {
+		slog.Debug("GET de teste do Range falhou", "erro", err)
+		return false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		slog.Debug("Servidor ignorou o Range no GET de teste", "status", resp.Status)
+		return false
+	}
+	_, _, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+	if err != nil || total != size {
+		slog.Debug("Content-Range inesperado no GET de teste", "content-range", resp.Header.Get("Content-Range"))
+		return false
+	}
+	slog.Info("Servidor não anuncia Accept-Ranges, mas atende Range")
+	return true
+}
+
+// Alguns servidores recusam HEAD mas aceitam GET parcial: pede só o
+// primeiro byte e lê o tamanho total do Content-Range
+func probeFileSize(ctx context.Context, cfg Config, url string, headErr error) (remoteInfo, error) {
+	slog.Info("HEAD falhou, tentando GET com Range", "erro", headErr)
+
+	req, err := newRequest(ctx, cfg, "GET", url)
+	if err != nil {
+		return remoteInfo{}, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err := cfg.do(req)
+	if err != nil {
+		return remoteInfo{}, fmt.Errorf("HEAD falhou (%v) e o GET de sondagem também: %w", headErr, err)
+	}
+	defer resp.Body.Close()
+
+	info := remoteInfo{
+		ETag:         resp.Header.Get("ETag"),
+		URL:          resp.Request.URL.String(),
+		Requested:    url,
+		Header:       resp.Header,
+		Encoding:     resp.Header.Get("Content-Encoding"),
+		LastModified: lastModified(resp.Header),
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		_, _, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return remoteInfo{}, err
+		}
+		// Sem o total não há como dividir o arquivo em faixas
+		info.Size = total
+		info.AcceptRanges = total != unknownSize
+	case http.StatusOK:
+		// Ignorou o Range: só dá para baixar em fluxo único
+		info.Size = unknownSize
+		if resp.ContentLength >= 0 {
+			info.Size = resp.ContentLength
+		}
+	case http.StatusNotModified:
+		info.NotModified = true
+	default:
+		return remoteInfo{}, newStatusError(resp, "HEAD falhou (%v) e o GET de sondagem retornou %s", headErr, resp.Status)
+	}
+
+	return info, nil
 }
 
 // RateLimiter usando mutex
 type RateLimiter struct {
 	bytesPerSec int64
-	mu          sync.Mutex
-	tokens      int64
-	lastRefill  time.Time
+	// Máximo de tokens acumulados em períodos ociosos; zero acompanha
+	// bytesPerSec
+	burst      int64
+	mu         sync.Mutex
+	tokens     int64
+	lastRefill time.Time
 }
 
 func NewRateLimiter(bytesPerSec int64) *RateLimiter {
-	return &RateLimiter{
+	return NewRateLimiterBurst(bytesPerSec, 0)
+}
+
+// Limitador que acumula até burst bytes quando fica ocioso, liberando uma
+// rajada acima da taxa no início ou depois de uma pausa. Começa cheio.
+func NewRateLimiterBurst(bytesPerSec, burst int64) *RateLimiter {
+	rl := &RateLimiter{
 		bytesPerSec: bytesPerSec,
-		tokens:      bytesPerSec,
+		burst:       burst,
 		lastRefill:  time.Now(),
 	}
+	rl.tokens = rl.capacity()
+	return rl
+}
+
+// Tamanho do balde de tokens
+func (rl *RateLimiter) capacity() int64 {
+	if rl.burst > 0 {
+		return rl.burst
+	}
+	return rl.bytesPerSec
+}
+
+// Limitador de limitMB MB/s com a rajada de -burst
+func (c Config) newRateLimiter(limitMB int64) *RateLimiter {
+	return NewRateLimiterBurst(limitMB*1024*1024, c.BurstMB*1024*1024)
 }
 
 func (rl *RateLimiter) refill() {
@@ -75,10 +297,7 @@ func (rl *RateLimiter) refill() {
 
 	newTokens := int64(elapsed * float64(rl.bytesPerSec))
 	if newTokens > 0 {
-		rl.tokens += newTokens
-		if rl.tokens > rl.bytesPerSec {
-			rl.tokens = rl.bytesPerSec
-		}
+		rl.tokens = min(rl.tokens+newTokens, rl.capacity())
 		rl.lastRefill = now
 	}
 }
@@ -86,9 +305,16 @@ func (rl *RateLimiter) refill() {
 func (rl *RateLimiter) Wait(n int) {
 	for {
 		rl.mu.Lock()
+		if rl.bytesPerSec <= 0 {
+			rl.mu.Unlock()
+			return
+		}
 		rl.refill()
-		if rl.tokens >= int64(n) {
-			rl.tokens -= int64(n)
+		// O balde nunca passa da capacidade: com um balde menor que a
+		// leitura, basta ele encher
+		need := min(int64(n), rl.capacity())
+		if rl.tokens >= need {
+			rl.tokens -= need
 			rl.mu.Unlock()
 			break
 		}
@@ -97,150 +323,1747 @@ func (rl *RateLimiter) Wait(n int) {
 	}
 }
 
+// Muda a taxa com o download em andamento, valendo para todos os chunks
+// que compartilham o limitador. Zero ou negativo remove o limite.
+func (rl *RateLimiter) SetRate(bytesPerSec int64) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	// Contabiliza o tempo passado na taxa antiga antes de trocar
+	rl.refill()
+	rl.bytesPerSec = bytesPerSec
+	rl.tokens = min(rl.tokens, max(rl.capacity(), 0))
+}
+
+// Muda o tamanho da rajada; zero volta a acompanhar a taxa
+func (rl *RateLimiter) SetBurst(burst int64) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.refill()
+	rl.burst = burst
+	rl.tokens = min(rl.tokens, max(rl.capacity(), 0))
+}
+
+func (rl *RateLimiter) Rate() int64 {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.bytesPerSec
+}
+
+// Maior leitura que o limitador consegue liberar de uma vez
+func (rl *RateLimiter) maxRead() int64 {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.bytesPerSec <= 0 {
+		return 0
+	}
+	return rl.capacity()
+}
+
 type rateLimitedReader struct {
 	r  io.Reader
 	rl *RateLimiter
+	// O limite só vale depois que os chunks do download leram after bytes
+	// (-limit-after); o contador é compartilhado por eles. nil limita desde
+	// o início.
+	counter *atomic.Int64
+	after   int64
 }
 
+// Maior leitura liberada de uma vez pelo RateLimiter, para distribuir a
+// banda entre os chunks
+const rateLimitChunk = 16 * 1024
+
 func (r *rateLimitedReader) Read(p []byte) (int, error) {
-	if len(p) > 16*1024 {
-		p = p[:16*1024]
+	if r.counter != nil && r.counter.Load() < r.after {
+		n, err := r.r.Read(p)
+		r.counter.Add(int64(n))
+		return n, err
+	}
+	// Sem limite no momento (SetRate com zero) a leitura usa o buffer
+	// inteiro, como sem RateLimiter
+	limit := r.rl.maxRead()
+	if limit <= 0 {
+		return r.r.Read(p)
+	}
+	if len(p) > rateLimitChunk {
+		p = p[:rateLimitChunk]
+	}
+	// Com um balde menor que rateLimitChunk (ver SetRate e SetBurst) cada
+	// leitura pede no máximo o balde cheio
+	if int64(len(p)) > limit {
+		p = p[:limit]
 	}
 	r.rl.Wait(len(p))
 	return r.r.Read(p)
 }
 
-func downloadChunk(url string, start, end int64, file *os.File, wg *sync.WaitGroup, rl *RateLimiter) {
-	defer wg.Done()
+// Estado compartilhado pelos chunks de um download
+type download struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	cfg    Config
+	size   int64
+	url    string
+	file   RandomAccessWriter
+	rl     *RateLimiter
+	policy *serverPolicy
+	// URL final e espelhos usados nas requisições de faixa
+	mirrors *mirrorSet
+	// Vagas para chunks em nova tentativa (-max-concurrent-retries)
+	retries retryGate
+	// Duração e velocidade de cada chunk (-stats); nil desativa
+	chunkStats *chunkStats
+	// Bytes lidos sem limite de banda, até -limit-after
+	unlimited atomic.Int64
+
+	// Posição no arquivo remoto do primeiro byte do arquivo local, com
+	// -range-start; as faixas dos chunks são relativas ao arquivo local
+	offset int64
+	// Tamanho do arquivo remoto inteiro; igual a size sem -range-start e
+	// -range-end
+	remoteSize int64
+
+	// Digest do arquivo no algoritmo de -algo, calculado durante a cópia no
+	// fluxo único ou na primeira verificação
+	streamDigest string
+	// Fluxo único: bytes do início do arquivo já gravados, de onde a próxima
+	// tentativa continua com "Range: bytes=N-"
+	streamOffset int64
+	// Validador do If-Range ao continuar o fluxo único
+	streamIfRange string
+	// O transporte descompactou a resposta: os bytes gravados não são os do
+	// servidor e não dá para continuar com Range
+	streamUncompressed bool
+
+	written atomic.Int64
+	active  atomic.Int32
+
+	sizeMu      sync.Mutex
+	sizeChanged atomic.Bool
+
+	// Validador enviado em If-Range ao retomar; vazio em downloads novos
+	ifRange       string
+	remoteChanged atomic.Bool
+}
+
+// Baixa a faixa start-end, em várias requisições se o servidor limitar o
+// tamanho das faixas. Retorna quantos bytes foram gravados a partir de start.
+func (d *download) downloadChunk(ctx context.Context, url string, start, end int64) (int64, error) {
+	slog.Debug("Baixando chunk", "inicio", start, "fim", end)
+	d.active.Add(1)
+	defer d.active.Add(-1)
 
-	log.Printf("Baixando chunk %d-%d\n", start, end)
+	pos := start
+	for pos <= end {
+		reqEnd := end
+		if max := d.policy.maxRangeSize(); max > 0 && reqEnd-pos+1 > max {
+			reqEnd = pos + max - 1
+		}
+
+		n, err := d.fetchRange(ctx, url, pos, reqEnd)
+		pos += n
+		if err != nil {
+			return pos - start, err
+		}
+	}
 
-	req, err := http.NewRequest("GET", url, nil)
+	slog.Debug("Chunk baixado", "inicio", start, "fim", end)
+	return pos - start, nil
+}
+
+func (d *download) fetchRange(ctx context.Context, url string, start, end int64) (int64, error) {
+	// A espera pela vaga no host fica fora do watchdog
+	release, err := d.cfg.HostLimiter.acquire(ctx, url)
 	if err != nil {
-		log.Println("Erro criando requisição:", err)
-		return
+		return 0, err
 	}
-	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	defer release()
 
-	resp, err := http.DefaultClient.Do(req)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sw := newSectionWriter(d.file, start, &d.written)
+	wd := startWatchdog(d.cfg.IdleTimeout, d.cfg.RequestTimeout, sw.pos, d.cfg.Pause.Paused, cancel)
+	defer wd.stop()
+
+	_, err = d.fetchRangeTo(ctx, sw, url, start, end)
+	if ferr := sw.flush(); ferr != nil && err == nil {
+		err = fmt.Errorf("erro gravando chunk: %w", ferr)
+	}
+	// Só conta o que chegou ao arquivo: a próxima tentativa continua daí
+	n := sw.flushed() - start
+	if errors.Is(err, errChunkDigest) {
+		// Bytes corrompidos: a próxima tentativa pede a faixa inteira de novo
+		d.written.Add(-n)
+		n = 0
+	}
+	if err != nil && d.ctx.Err() == nil {
+		d.mirrors.fail(url)
+	}
+	if err != nil && wd.stalled.Load() {
+		return n, fmt.Errorf("chunk sem progresso por %s", d.cfg.IdleTimeout)
+	}
+	if err != nil && wd.expired.Load() {
+		return n, fmt.Errorf("requisição do chunk passou do tempo limite de %s", d.cfg.RequestTimeout)
+	}
+	return n, err
+}
+
+func (d *download) fetchRangeTo(ctx context.Context, sw *sectionWriter, url string, start, end int64) (int64, error) {
+	if isFTP(url) {
+		return d.fetchFTPRange(ctx, sw, url, start, end)
+	}
+	if isSFTP(url) {
+		return d.fetchSFTPRange(ctx, sw, url, start, end)
+	}
+	req, err := newRequest(ctx, d.cfg, "GET", url)
 	if err != nil {
-		log.Println("Erro no download:", err)
-		return
+		return 0, fmt.Errorf("erro criando requisição: %w", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", d.offset+start, d.offset+end))
+	if d.ifRange != "" {
+		req.Header.Set("If-Range", d.ifRange)
+	}
+
+	d.policy.acquire()
+	defer d.policy.release()
+
+	resp, err := d.cfg.httpClient().Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("erro no download: %w", err)
 	}
 	defer resp.Body.Close()
 
-	_, err = file.WriteAt([]byte{}, start)
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if enc := resp.Header.Get("Content-Encoding"); enc != "" && enc != "identity" {
+			return 0, fmt.Errorf("faixa %d-%d veio com Content-Encoding %s e não pode ser montada no arquivo", start, end, enc)
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		if d.remoteSizeChanged() {
+			return 0, errSizeChanged
+		}
+		d.policy.observeRangeRejected(end - start + 1)
+		return 0, newStatusError(resp, "servidor recusou a faixa %d-%d (%s)", start, end, resp.Status)
+	case http.StatusOK:
+		if d.ifRange != "" {
+			d.markRemoteChanged()
+			return 0, errRemoteChanged
+		}
+		return 0, newStatusError(resp, "servidor ignorou o Range da faixa %d-%d", start, end)
+	case http.StatusTooManyRequests:
+		d.policy.observeThrottle()
+		return 0, newStatusError(resp, "servidor limitou as requisições (%s)", resp.Status)
+	default:
+		return 0, newStatusError(resp, "resposta inesperada para a faixa %d-%d: %s", start, end, resp.Status)
+	}
+
+	// Mesmo com 206 a faixa recebida precisa ser a pedida, senão os bytes
+	// seriam gravados no offset errado. Servidores que limitam o tamanho da
+	// faixa respondem com menos bytes do que o pedido; o restante é pedido
+	// na próxima requisição.
+	cr := resp.Header.Get("Content-Range")
+	if cr == "" {
+		return 0, fmt.Errorf("resposta 206 sem Content-Range para a faixa %d-%d", start, end)
+	}
+	crStart, crEnd, total, err := parseContentRange(cr)
 	if err != nil {
-		log.Println("Erro preparando offset:", err)
-		return
+		return 0, err
+	}
+	crStart, crEnd = crStart-d.offset, crEnd-d.offset
+	if crStart != start || crEnd > end {
+		return 0, fmt.Errorf("servidor retornou a faixa %d-%d em vez de %d-%d", crStart, crEnd, start, end)
+	}
+	if total != unknownSize && total != d.remoteSize {
+		if d.remoteSizeChanged() {
+			return 0, errSizeChanged
+		}
+		return 0, fmt.Errorf("servidor informou %d bytes no Content-Range, mas o arquivo tem %d", total, d.remoteSize)
+	}
+	if crEnd < end {
+		d.policy.observeRangeLimit(crEnd - crStart + 1)
 	}
 
-	limitedReader := &rateLimitedReader{r: resp.Body, rl: rl}
+	_, err = d.file.WriteAt([]byte{}, start)
+	if err != nil {
+		return 0, fmt.Errorf("erro preparando offset: %w", err)
+	}
 
-	_, err = io.Copy(&sectionWriter{file: file, offset: start}, limitedReader)
+	var body io.Reader = io.LimitReader(resp.Body, end-start+1)
+	digest := parseContentDigest(resp.Header)
+	if digest != nil {
+		body = io.TeeReader(body, digest)
+	}
+	n, err := d.copyBody(sw, body)
 	if err != nil {
-		log.Println("Erro copiando chunk:", err)
-		return
+		return n, fmt.Errorf("erro copiando chunk: %w", err)
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("servidor não retornou dados para a faixa %d-%d", start, end)
+	}
+	// O digest cobre a resposta inteira: só confere com todos os bytes dela
+	if digest != nil && n == crEnd-crStart+1 {
+		if err := digest.check(crStart, crEnd); err != nil {
+			return n, err
+		}
+	}
+	if n == end-start+1 {
+		if err := d.checkTrailing(resp.Body, start, end); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Copia o corpo da resposta para o arquivo. O limite de leitura de 16KB só
+// se aplica quando há limite de banda; sem ele o buffer inteiro é usado.
+func (d *download) copyBody(dst io.Writer, body io.Reader) (int64, error) {
+	if d.cfg.SimulateDelay > 0 || d.cfg.SimulateJitter > 0 {
+		body = newSlowReader(body, d.cfg.SimulateDelay, d.cfg.SimulateJitter)
+	}
+	if d.rl != nil {
+		limited := &rateLimitedReader{r: body, rl: d.rl}
+		if d.cfg.LimitAfterMB > 0 {
+			limited.counter, limited.after = &d.unlimited, d.cfg.LimitAfterMB*1024*1024
+		}
+		body = limited
+	}
+	if d.cfg.Pause != nil {
+		body = &pausableReader{ctx: d.ctx, r: body, pause: d.cfg.Pause}
+	}
+	if d.cfg.Usage != nil {
+		body = &usageReader{r: body, usage: d.cfg.Usage}
 	}
 
-	log.Printf("Chunk %d-%d baixado\n", start, end)
+	size := d.cfg.BufferSize
+	if size <= 0 {
+		size = defaultBufferSize
+	}
+	return io.CopyBuffer(dst, body, make([]byte, size))
 }
 
+// Bytes acumulados por chunk antes de um WriteAt, para não fazer uma
+// chamada de sistema a cada leitura do corpo
+const writeBufferSize = 1024 * 1024
+
+// Grava a partir de offset, acumulando as escritas em um buffer. Quem usa
+// precisa chamar flush ao final, inclusive quando a cópia falha.
 type sectionWriter struct {
-	file   *os.File
+	file RandomAccessWriter
+	// Próximo offset a gravar no arquivo
 	offset int64
+	buf    []byte
+	// len(buf), lido pelo watchdog em outra goroutine
+	buffered atomic.Int64
+	// Total de bytes gravados por todos os chunks do download
+	counter *atomic.Int64
+}
+
+func newSectionWriter(file RandomAccessWriter, offset int64, counter *atomic.Int64) *sectionWriter {
+	return &sectionWriter{file: file, offset: offset, buf: make([]byte, 0, writeBufferSize), counter: counter}
 }
 
 func (sw *sectionWriter) Write(p []byte) (int, error) {
-	n, err := sw.file.WriteAt(p, sw.offset)
-	sw.offset += int64(n)
+	if len(sw.buf)+len(p) > cap(sw.buf) {
+		if err := sw.flush(); err != nil {
+			return 0, err
+		}
+	}
+	if len(p) >= cap(sw.buf) {
+		return sw.writeAt(p)
+	}
+	sw.buf = append(sw.buf, p...)
+	sw.buffered.Store(int64(len(sw.buf)))
+	return len(p), nil
+}
+
+func (sw *sectionWriter) writeAt(p []byte) (int, error) {
+	n, err := sw.file.WriteAt(p, atomic.LoadInt64(&sw.offset))
+	atomic.AddInt64(&sw.offset, int64(n))
+	if sw.counter != nil {
+		sw.counter.Add(int64(n))
+	}
 	return n, err
 }
 
-func runDownload(url string, threads int64, limitMB int64) {
-	log.Println("=============================")
-	log.Println("Download em lotes de arquivos")
-	log.Println("=============================")
-	log.Println("URL do arquivo:", url)
+// Grava o que estiver no buffer
+func (sw *sectionWriter) flush() error {
+	if len(sw.buf) == 0 {
+		return nil
+	}
+	n, err := sw.writeAt(sw.buf)
+	sw.buf = sw.buf[:copy(sw.buf, sw.buf[n:])]
+	sw.buffered.Store(int64(len(sw.buf)))
+	return err
+}
+
+// Posição até onde os bytes foram recebidos, gravados ou não; lida pelo
+// watchdog
+func (sw *sectionWriter) pos() int64 {
+	return atomic.LoadInt64(&sw.offset) + sw.buffered.Load()
+}
+
+// Volta a gravar a partir de offset; só com o buffer vazio
+func (sw *sectionWriter) seek(offset int64) {
+	atomic.StoreInt64(&sw.offset, offset)
+}
+
+// Posição até onde os bytes já estão no arquivo
+func (sw *sectionWriter) flushed() int64 {
+	return atomic.LoadInt64(&sw.offset)
+}
+
+const defaultBufferSize = 256 * 1024
+
+// Tamanho mínimo padrão de cada chunk, para não abrir uma conexão por
+// poucos bytes
+const defaultMinChunkSize = 1024 * 1024
+
+func (cfg Config) minChunkSize() int64 {
+	if cfg.MinChunk > 0 {
+		return cfg.MinChunk
+	}
+	return defaultMinChunkSize
+}
+
+// Opções de um download
+type Config struct {
+	URL     string
+	Threads int64
+	// Escolhe as threads pelo tamanho do arquivo, com Threads como máximo
+	AutoThreads bool
+	// Limite de banda em MB/s, zero para nenhum
+	LimitMB int64
+	// MB baixados em velocidade máxima antes de o limite de banda começar a
+	// valer
+	LimitAfterMB int64
+	// Rajada do limite de banda em MB, acumulada enquanto a banda não é
+	// usada; zero é igual ao limite por segundo
+	BurstMB int64
+	Output  string
+	Force   bool
+	// Destino alternativo dos bytes (memória, arquivo cifrado, upload em
+	// partes); nil grava em Output
+	Sink    RandomAccessWriter
+	History *History
+	// Eventos em JSON (-json); nil desativa
+	Events *eventLog
+	// Pausa e retoma o download em andamento; nil desativa
+	Pause *PauseControl
+	// Spans por download, chunk e tentativa; nil desativa
+	Tracer Tracer
+	// Contadores para o Prometheus (RegisterMetrics); nil desativa
+	Metrics *Metrics
+	// Funções chamadas nas etapas do download; nil desativa
+	Hooks *Hooks
+	// Reserva o espaço com fallocate em vez de criar um arquivo esparso
+	Preallocate bool
+	// Checksum esperado do arquivo, em hexadecimal
+	Checksum string
+	// Arquivo onde gravar o digest calculado, no formato do sha256sum
+	ChecksumOutput string
+	// Algoritmo do checksum: md5, sha1, sha256 ou sha512; vazio é sha256
+	Algo string
+	// Modelo da URL onde o servidor publica o SHA-256 do arquivo, com {url}
+	// e {name}; verificado depois do download
+	HashURL string
+	// Arquivo de checksum publicado ao lado do download (.sha256 ou .md5),
+	// ou "auto" para tentar <url>.sha256 e <url>.md5
+	ChecksumURL string
+	// Descompacta o arquivo ao final, detectando o formato pelos bytes mágicos
+	Extract bool
+	// Grava a URL de origem e o checksum nos atributos estendidos do arquivo
+	Xattr bool
+	// Usa o Last-Modified do servidor como mtime do arquivo
+	PreserveTimestamp bool
+	// Pula o download se o arquivo local for tão novo quanto o remoto e
+	// sobrescreve se o remoto for mais novo
+	OverwriteIfNewer bool
+	// Ao retomar, relê os chunks já baixados e baixa de novo os que não
+	// batem com o hash gravado no .part
+	VerifyResume bool
+	// Apaga o arquivo parcial quando o download falha e não pode ser retomado
+	CleanupOnError bool
+	// Mostra ao final uma tabela com duração e velocidade de cada chunk
+	Stats bool
+	// Cabeçalhos enviados em todas as requisições
+	Header http.Header
+	// Cliente usado em todas as requisições; nil usa http.DefaultClient
+	Client *http.Client
+	// Proxy HTTP, HTTPS ou SOCKS5; nil usa as variáveis de ambiente
+	Proxy *url.URL
+	// CAs aceitas no TLS; nil usa as do sistema
+	RootCAs *x509.CertPool
+	// Não verifica o certificado do servidor (-insecure)
+	Insecure bool
+	// Tempo máximo do download inteiro, zero para nenhum
+	Timeout time.Duration
+	// Tamanho do buffer de cópia de cada chunk
+	BufferSize int
+	// Janela do arquivo remoto a baixar, do byte RangeStart ao RangeEnd
+	// (inclusive); RangeEnd zero vai até o fim do arquivo
+	RangeStart int64
+	RangeEnd   int64
+	// Tamanho mínimo de cada chunk em bytes; arquivos pequenos usam menos
+	// threads. Zero usa defaultMinChunkSize
+	MinChunk int64
+	// Bytes além da faixa pedida: discard, warn ou error
+	Trailing string
+	// Códigos HTTP que justificam nova tentativa; vazio usa o padrão
+	RetryStatus []int
+	// Chunks em nova tentativa ao mesmo tempo, zero para sem limite
+	MaxConcurrentRetries int
+	// Pesos de faixas de bytes; chunks das faixas mais pesadas são baixados
+	// primeiro
+	Priorities []rangePriority
+	// Tempo máximo de cada requisição, incluindo a leitura do corpo
+	RequestTimeout time.Duration
+	// Intervalo mínimo entre a abertura de novas conexões
+	ConnectStagger time.Duration
+	// Intervalo entre o início de cada thread de chunks
+	Spread time.Duration
+	// Conexões ociosas mantidas por host para reuso; zero usa o número de
+	// threads
+	MaxIdleConns int
+	// Conexões abertas por host ao mesmo tempo, zero para sem limite
+	MaxConnsPerHost int
+	// Redirecionamentos seguidos por requisição; zero não segue nenhum
+	MaxRedirects int
+	// Recusa redirecionamentos para um host diferente do da URL pedida
+	SameHostRedirects bool
+	// Host para onde a URL foi redirecionada, quando diferente do pedido.
+	// As requisições feitas direto a ele saem sem credenciais, como o salto.
+	redirectedHost string
+	// Família de endereços das conexões: ip4, ip6 ou vazio para ambas
+	Prefer string
+	// Resolve cada host uma vez e reaproveita os endereços nas conexões
+	// seguintes
+	DNSCache bool
+	// Desativa o HTTP/2: cada chunk usa sua própria conexão TCP em vez de
+	// multiplexar todos numa só
+	HTTP1 bool
+	// Espera extra antes de tentar de novo um chunk que falhou por erro de
+	// conexão
+	ConnectCooldown time.Duration
+	// Tentativas de cada chunk no mesmo espelho antes de passar ao próximo;
+	// zero troca a cada tentativa
+	TriesPerMirror int
+	// Tentativas de cada chunk somando todos os espelhos; zero usa
+	// maxChunkAttempts
+	MaxAttempts int
+	// Tentativas da consulta inicial do tamanho; zero usa
+	// defaultProbeAttempts
+	ProbeAttempts int
+	// Tempo sem receber bytes após o qual um chunk é abortado, zero para nenhum
+	IdleTimeout time.Duration
 
-	log.Println("Obtendo tamanho do arquivo...")
-	fileSize, err := getFileSize(url)
+	// Limitador compartilhado entre vários downloads simultâneos, para que
+	// LimitMB valha para a soma deles; nil cria um por download
+	RateLimiter *RateLimiter
+	// Contagem dos bytes recebidos na execução, com o limite de -data-cap;
+	// nil não conta
+	Usage *DataUsage
+	// Transferências simultâneas por host (-max-per-host), compartilhado
+	// entre os downloads; nil não limita
+	HostLimiter *HostLimiter
+	// Arquivos baixados ao mesmo tempo com -input e -manifest
+	MaxConcurrentFiles int
+
+	// Threads e limite de banda por host, aplicados pela URL final
+	HostOverrides map[string]HostOverride
+	// Hosts aceitos para a URL final, depois dos redirecionamentos
+	AllowedHosts []string
+	// Espelhos com o mesmo arquivo, usados em rodízio nas faixas
+	Mirrors []string
+	// Mede a velocidade de cada espelho antes do download e distribui as
+	// faixas na proporção
+	ProbeMirrors bool
+	// URL com o mesmo arquivo (ex.: a origem por trás de um proxy de cache),
+	// usada no download inteiro se a principal falhar
+	FallbackURL string
+
+	// Padrão: defaultUserAgent
+	UserAgent string
+	// Autenticação Basic (Username/Password) ou Bearer
+	Username    string
+	Password    string
+	BearerToken string
+	// Chave privada para sftp:// e o known_hosts que confere a chave do
+	// servidor (padrão ~/.ssh/known_hosts)
+	SSHKey        string
+	SSHKnownHosts string
+	// Aceita qualquer chave do servidor SFTP, sem o known_hosts
+	// (-ssh-insecure-host-key). Independente de Insecure, que é só do TLS.
+	SSHInsecureHostKey bool
+
+	// Atraso artificial por leitura, apenas para testes
+	SimulateDelay  time.Duration
+	SimulateJitter time.Duration
+}
+
+func (c Config) httpClient() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return http.DefaultClient
+}
+
+func errOutputExists(path string) error {
+	return fmt.Errorf("arquivo %s já existe; use -force (ou -overwrite) para sobrescrever ou -output para escolher outro destino", path)
+}
+
+// Arquivo remoto vazio: não há chunks para dividir, só cria o destino
+func createEmptyOutput(cfg Config) error {
+	if _, err := os.Stat(cfg.Output); err == nil && !cfg.Force {
+		return errOutputExists(cfg.Output)
+	}
+
+	f, err := os.Create(cfg.Output)
 	if err != nil {
-		log.Println("Erro:", err)
-		return
+		return fmt.Errorf("erro criando arquivo final: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
 	}
-	log.Println("Tamanho do arquivo:", fileSize, "bytes")
+	os.Remove(partPath(cfg.Output))
 
-	chunkSize := (fileSize + threads - 1) / threads
-	chunks := (fileSize + chunkSize - 1) / chunkSize
-	log.Printf("Dividindo em %d chunks, cada um até %d bytes\n", chunks, chunkSize)
+	if cfg.Checksum == "" && cfg.ChecksumOutput == "" {
+		return nil
+	}
+	sum, err := fileDigest(cfg.Output, cfg.algo())
+	if err != nil {
+		return err
+	}
+	if expected := strings.ToLower(strings.TrimSpace(cfg.Checksum)); cfg.Checksum != "" && sum != expected {
+		return fmt.Errorf("checksum não confere: esperado %s, obtido %s", expected, sum)
+	}
+	if cfg.ChecksumOutput != "" {
+		return writeChecksumFile(cfg.ChecksumOutput, cfg.algo(), sum, cfg.Output)
+	}
+	return nil
+}
+
+// Abre o arquivo de destino, retomando um download anterior quando o
+// sidecar .part corresponde ao mesmo arquivo remoto. Um .part inconsistente
+// ou ilegível é relatado e o download recomeça do zero: o sidecar mostra que
+// o arquivo é um download incompleto, não um arquivo do usuário.
+func openOutput(cfg Config, info remoteInfo, chunkSize int64) (*os.File, *partState, error) {
+	partFile := partPath(cfg.Output)
+
+	if fi, err := os.Stat(cfg.Output); err == nil {
+		state, err := loadPartState(partFile)
+		switch {
+		case err == nil:
+			if err := state.validate(cfg.URL, info, cfg.RangeStart); err != nil {
+				slog.Warn("Estado do download não corresponde ao arquivo remoto, recomeçando do zero", "estado", partFile, "motivo", err)
+				break
+			}
+			return resumeOutput(cfg.Output, state, fi.Size(), cfg.VerifyResume)
+		case !errors.Is(err, os.ErrNotExist):
+			slog.Warn("Estado do download ilegível, recomeçando do zero", "estado", partFile, "erro", err)
+		case !cfg.Force:
+			return nil, nil, errOutputExists(cfg.Output)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+
+	// Com tamanho desconhecido o arquivo cresce conforme os bytes chegam,
+	// em um único chunk
+	if info.Size == unknownSize {
+		outFile, err := os.Create(cfg.Output)
+		if err != nil {
+			return nil, nil, fmt.Errorf("erro criando arquivo final: %w", err)
+		}
+		return outFile, newPartState(partFile, cfg.URL, info, chunkSize, 1), nil
+	}
+
+	if err := checkDiskSpace(cfg.Output, info.Size); err != nil {
+		return nil, nil, err
+	}
 
-	fileName := getFileName(url)
-	outFile, err := os.Create(fileName)
+	outFile, err := os.Create(cfg.Output)
 	if err != nil {
-		log.Println("Erro criando arquivo final:", err)
+		return nil, nil, fmt.Errorf("erro criando arquivo final: %w", err)
+	}
+
+	resize := outFile.Truncate
+	if cfg.Preallocate {
+		resize = func(size int64) error { return preallocate(outFile, size) }
+	}
+	if err := resize(info.Size); err != nil {
+		outFile.Close()
+		return nil, nil, fmt.Errorf("erro ajustando tamanho do arquivo: %w", err)
+	}
+
+	chunks := chunkCount(info.Size, chunkSize)
+	state := newPartState(partFile, cfg.URL, info, chunkSize, chunks)
+	state.Offset = cfg.RangeStart
+	if err := state.save(); err != nil {
+		slog.Warn("Não foi possível gravar o estado do download", "erro", err)
+	}
+
+	return outFile, state, nil
+}
+
+// Ajusta o mtime do arquivo para o Last-Modified do servidor. Sem o
+// cabeçalho o arquivo fica com a data do download.
+func preserveTimestamp(path string, modified time.Time) {
+	if modified.IsZero() {
+		slog.Info("Servidor não informou Last-Modified válido, mantendo a data do download")
 		return
 	}
-	defer outFile.Close()
+	if err := os.Chtimes(path, time.Time{}, modified); err != nil {
+		slog.Warn("Não foi possível ajustar a data do arquivo", "erro", err)
+	}
+}
 
-	if err := outFile.Truncate(fileSize); err != nil {
-		log.Println("Erro ajustando tamanho do arquivo:", err)
+// Registra o resultado do download no histórico, se configurado
+func recordHistory(cfg Config, size int64, started time.Time, skipped bool, err error) {
+	if cfg.History == nil {
 		return
 	}
 
-	rl := NewRateLimiter(limitMB * 1024 * 1024) // Convert MB/s para bytes/s
+	entry := HistoryEntry{
+		URL:       cfg.URL,
+		Name:      cfg.Output,
+		Size:      size,
+		Duration:  time.Since(started),
+		Outcome:   outcomeCompleted,
+		Timestamp: started,
+	}
+	if err != nil {
+		entry.Outcome = outcomeFailed
+		entry.Error = err.Error()
+	} else if skipped {
+		entry.Outcome = outcomeSkipped
+	} else if sum, err := fileChecksumCached(cfg.Output); err == nil {
+		entry.Checksum = sum
+	}
+
+	if err := cfg.History.Add(entry); err != nil {
+		slog.Warn("Não foi possível gravar o histórico", "erro", err)
+	}
+}
+
+func printHistory(h *History) error {
+	entries, err := h.List()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		fmt.Printf("%s\t%s\t%s\t%d bytes\t%s\t%s\n", e.Timestamp.Format(time.RFC3339), e.Outcome, e.Name, e.Size, e.Duration, e.URL)
+	}
+	return nil
+}
+
+func completeEvent(cfg Config, size int64, started time.Time) event {
+	elapsed := time.Since(started).Seconds()
+	e := event{Event: eventComplete, URL: cfg.URL, Output: cfg.Output, TotalBytes: size, BytesDone: size, Elapsed: elapsed}
+	if elapsed > 0 {
+		e.Speed = float64(size) / elapsed
+	}
+	return e
+}
+
+// Número de vezes que o download recomeça quando o arquivo remoto muda de
+// tamanho no meio do caminho
+const maxSizeRestarts = 3
+
+// Retorna o tamanho do arquivo remoto, usado nas estatísticas do benchmark.
+// skipped indica que o arquivo local já estava atualizado e nada foi baixado
+// (-overwrite-if-newer ou 304): o arquivo é do usuário e não desta execução.
+func runDownload(ctx context.Context, cfg Config) (fileSize int64, skipped bool, err error) {
+	started := time.Now()
+	defer func() { recordHistory(cfg, fileSize, started, skipped, err) }()
+	defer func() {
+		cfg.Hooks.complete(Result{URL: cfg.URL, Output: cfg.Output, Size: fileSize, Elapsed: time.Since(started), Skipped: skipped, Err: err})
+	}()
+
+	ctx, span := cfg.tracer().Start(ctx, "download")
+	span.SetAttr("url", cfg.URL)
+	defer func() {
+		span.SetAttr("size", fileSize)
+		switch {
+		case err != nil:
+			span.SetAttr("status", outcomeFailed)
+		case skipped:
+			span.SetAttr("status", outcomeSkipped)
+		default:
+			span.SetAttr("status", outcomeCompleted)
+		}
+		span.End(err)
+	}()
+
+	slog.Info("Download em lotes de arquivos", "url", cfg.URL)
+
+	if err := cfg.checkSink(); err != nil {
+		return 0, false, err
+	}
+
+	if cfg.ChecksumURL != "" {
+		if cfg, err = withSidecarChecksum(ctx, cfg); err != nil {
+			return 0, false, err
+		}
+	}
+
+	if cfg.Usage.exceeded() {
+		return 0, false, errDataCap
+	}
+
+	// Um arquivo sem .part já existia antes e é do usuário: nunca é apagado
+	_, statErr := os.Stat(cfg.Output)
+	_, partErr := os.Stat(partPath(cfg.Output))
+	userFile := statErr == nil && partErr != nil
+
+	source := cfg.URL
+	var primary remoteInfo
+	for restarts := 0; ; {
+		var output string
+		output, fileSize, err = attemptDownload(ctx, cfg, source, &primary)
+		if errors.Is(err, errUpToDate) {
+			cfg.Events.emit(completeEvent(cfg, fileSize, started))
+			return fileSize, true, nil
+		}
+		if err == nil {
+			cfg.Output = output
+			cfg.Events.emit(completeEvent(cfg, fileSize, started))
+			return fileSize, false, nil
+		}
+		if cfg.FallbackURL != "" && source != cfg.FallbackURL && shouldFailover(err) && ctx.Err() == nil {
+			slog.Warn("URL principal falhou, usando a URL alternativa", "erro", err, "url", cfg.FallbackURL)
+			source = cfg.FallbackURL
+			// Os chunks já baixados são aproveitados se o arquivo for o mesmo;
+			// senão o arquivo parcial desta execução pode ser sobrescrito
+			var ce *chunksFailedError
+			if errors.As(err, &ce) {
+				cfg.Force = true
+			}
+			continue
+		}
+		changed := errors.Is(err, errSizeChanged) || errors.Is(err, errRemoteChanged)
+		if !changed || restarts == maxSizeRestarts {
+			cfg.Events.emit(event{Event: eventError, URL: cfg.URL, Output: cfg.Output, TotalBytes: fileSize, Elapsed: time.Since(started).Seconds(), Error: err.Error()})
+			if cfg.CleanupOnError && output == "" && !userFile && cfg.Sink == nil {
+				cleanupPartial(cfg.Output)
+			}
+			return fileSize, false, err
+		}
+
+		// O arquivo parcial foi criado por esta execução (ou por uma anterior
+		// que estava sendo retomada), pode ser sobrescrito
+		slog.Warn("Arquivo remoto mudou, reiniciando o download", "erro", err)
+		cfg.Force = true
+		restarts++
+	}
+}
+
+// Tamanho dos chunks para um arquivo não vazio. Desativa info.AcceptRanges
+// quando o conteúdo compactado impede montar o arquivo a partir de faixas;
+// sem faixas o arquivo inteiro é um único chunk.
+func planChunkSize(cfg Config, info *remoteInfo) int64 {
+	fileSize := info.Size
+
+	if enc := info.Encoding; enc != "" && enc != "identity" && info.AcceptRanges {
+		slog.Warn("Servidor envia o arquivo com Content-Encoding, que não pode ser montado a partir de faixas", "encoding", enc)
+		info.AcceptRanges = false
+	}
+
+	if !info.AcceptRanges {
+		if fileSize == unknownSize {
+			slog.Warn("Tamanho desconhecido, baixando em fluxo único")
+		} else {
+			slog.Warn("Servidor não suporta downloads parciais (range requests), baixando em fluxo único")
+		}
+		return fileSize
+	}
+
+	threads := cfg.threadsFor(fileSize)
+	if cfg.AutoThreads {
+		slog.Info("Threads escolhidas pelo tamanho do arquivo", "threads", threads, "bytesPorChunk", autoChunkSize)
+	}
+	minChunk := cfg.minChunkSize()
+	if maxChunks := (fileSize + minChunk - 1) / minChunk; threads > maxChunks {
+		slog.Info("Arquivo pequeno, reduzindo threads", "threads", maxChunks, "pedidas", threads, "chunkMinimo", minChunk)
+		threads = maxChunks
+	}
+	chunkSize := (fileSize + threads - 1) / threads
+	if len(cfg.Priorities) > 0 {
+		chunkSize = max(chunkSize/priorityChunksPerThread, minChunk)
+	}
+	if a, ok := cfg.Sink.(partAligner); ok {
+		part := a.PartSize(fileSize)
+		chunkSize = (chunkSize + part - 1) / part * part
+	}
+	return chunkSize
+}
+
+// Com -auto-threads, um chunk a cada autoChunkSize bytes, até o máximo
+const (
+	autoChunkSize  = 32 * 1024 * 1024
+	autoMaxThreads = 16
+)
+
+// Número de threads para o tamanho do arquivo. limit é o <threads> da linha
+// de comando; zero usa autoMaxThreads.
+func autoThreads(fileSize, limit int64) int64 {
+	if limit <= 0 {
+		limit = autoMaxThreads
+	}
+	return min(max(chunkCount(fileSize, autoChunkSize), 1), limit)
+}
+
+func (c Config) threadsFor(fileSize int64) int64 {
+	if c.AutoThreads {
+		return autoThreads(fileSize, c.Threads)
+	}
+	return c.Threads
+}
+
+// Número de chunks de chunkSize bytes para cobrir o arquivo. Arredonda para
+// cima, então o último chunk começa antes do fim do arquivo e nunca é vazio,
+// mesmo quando fileSize é múltiplo exato do número de threads.
+func chunkCount(fileSize, chunkSize int64) int64 {
+	return (fileSize + chunkSize - 1) / chunkSize
+}
+
+// Faixa de bytes do chunk i; o último pode ser menor
+func chunkRange(i, chunkSize, fileSize int64) (start, end int64) {
+	start = i * chunkSize
+	end = min((i+1)*chunkSize, fileSize) - 1
+	return start, end
+}
+
+// Confere que as faixas cobrem o arquivo exatamente, sem faixas vazias nem
+// sobrepostas: uma sobreposição faria dois chunks gravarem o mesmo trecho
+// com WriteAt. O plano pode vir de um .part de outra execução.
+func checkChunkPlan(chunks, chunkSize, fileSize int64) error {
+	if chunkSize <= 0 || chunks != chunkCount(fileSize, chunkSize) {
+		return fmt.Errorf("plano de chunks inválido: %d chunks de %d bytes para %d bytes", chunks, chunkSize, fileSize)
+	}
+	next := int64(0)
+	for i := int64(0); i < chunks; i++ {
+		start, end := chunkRange(i, chunkSize, fileSize)
+		if start != next || end < start {
+			return fmt.Errorf("plano de chunks inválido: chunk %d com faixa %d-%d", i, start, end)
+		}
+		next = end + 1
+	}
+	if next != fileSize {
+		return fmt.Errorf("plano de chunks inválido: faixas cobrem %d de %d bytes", next, fileSize)
+	}
+	return nil
+}
+
+// Uma tentativa completa de download a partir de source, que é cfg.URL ou a
+// URL alternativa. primary guarda o que a URL principal informou, para
+// conferir que a alternativa serve o mesmo arquivo. Retorna o caminho final
+// do arquivo, que muda quando ele é descompactado; com erro o caminho só vem
+// preenchido se o download terminou e o arquivo deve ser mantido. errUpToDate
+// indica que o arquivo local já estava atualizado e não foi tocado.
+func attemptDownload(ctx context.Context, cfg Config, source string, primary *remoteInfo) (output string, fileSize int64, err error) {
+	slog.Debug("Obtendo tamanho do arquivo")
+	probeCfg := cfg
+	if cfg.OverwriteIfNewer {
+		probeCfg = cfg.ifModifiedSince(cfg.Output)
+	}
+	info, mirrors, err := probeMirrors(ctx, probeCfg, source)
+	if err != nil {
+		return "", 0, &probeError{err}
+	}
+	if info.NotModified {
+		fi, err := os.Stat(cfg.Output)
+		if err != nil {
+			return "", 0, err
+		}
+		slog.Info("Arquivo local já está atualizado (304), download pulado", "arquivo", cfg.Output)
+		return cfg.Output, fi.Size(), errUpToDate
+	}
+	if source == cfg.URL {
+		*primary = info
+	} else if primary.URL != "" {
+		if err := checkSameContent(*primary, info); err != nil {
+			return "", info.Size, err
+		}
+	}
+	fileSize = info.Size
+	if fileSize == unknownSize {
+		slog.Warn("Servidor não informou o tamanho do arquivo")
+	} else {
+		slog.Info("Tamanho do arquivo", "bytes", fileSize)
+	}
+	if info.URL != cfg.URL {
+		slog.Info("URL redirecionada", "url", info.URL)
+	}
+	if err := checkAllowedHost(info.URL, cfg.AllowedHosts); err != nil {
+		return "", fileSize, err
+	}
+	cfg = cfg.applyHostOverride(info.URL)
+	cfg = cfg.redirectedFrom(info.Requested, info.URL)
+
+	// Daqui em diante info.Size e fileSize são os da janela, que é o
+	// arquivo local
+	remoteSize := info.Size
+	var offset int64
+	if cfg.hasWindow() {
+		start, end, err := cfg.byteWindow(info.Size)
+		if err != nil {
+			return "", fileSize, err
+		}
+		offset = start
+		info.Size = end - start + 1
+		fileSize = info.Size
+		slog.Info("Baixando só uma faixa do arquivo", "inicio", start, "fim", end, "bytes", fileSize, "total", remoteSize)
+	}
+
+	if cfg.OverwriteIfNewer {
+		if localUpToDate(cfg.Output, info) {
+			slog.Info("Arquivo local já está atualizado, download pulado", "arquivo", cfg.Output)
+			return cfg.Output, fileSize, errUpToDate
+		}
+		// Com o mtime do servidor, a próxima execução compara datas iguais
+		cfg.Force = true
+		cfg.PreserveTimestamp = true
+	}
+
+	if fileSize == 0 {
+		create := createEmptyOutput
+		if cfg.Sink != nil {
+			create = func(cfg Config) error { return cfg.Sink.Truncate(0) }
+		}
+		if err := create(cfg); err != nil {
+			return "", fileSize, err
+		}
+		slog.Info("Arquivo vazio, nada a baixar", "arquivo", cfg.Output)
+		return cfg.Output, 0, nil
+	}
+
+	chunkSize := planChunkSize(cfg, &info)
+	if cfg.hasWindow() && !info.AcceptRanges {
+		return "", fileSize, errors.New("servidor não atende Range, necessário para -range-start e -range-end")
+	}
+
+	// outFile fica nil com Config.Sink, que é fechado por quem o criou
+	var (
+		outFile *os.File
+		dest    RandomAccessWriter = cfg.Sink
+		state   *partState
+	)
+	if cfg.Sink != nil {
+		state, err = openSink(cfg, info, chunkSize)
+	} else {
+		outFile, state, err = openOutput(cfg, info, chunkSize)
+		dest = outFile
+	}
+	if err != nil {
+		return "", fileSize, err
+	}
+	if outFile != nil {
+		defer outFile.Close()
+	}
+
+	chunkSize = state.ChunkSize
+	chunks := int64(len(state.Done))
+	if info.AcceptRanges {
+		if err := checkChunkPlan(chunks, chunkSize, fileSize); err != nil {
+			return "", fileSize, err
+		}
+	}
+	slog.Info("Dividindo em chunks", "chunks", chunks, "tamanho", chunkSize)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	var wg sync.WaitGroup
+	d := &download{
+		ctx:        ctx,
+		cancel:     cancel,
+		cfg:        cfg,
+		url:        info.URL,
+		size:       fileSize,
+		offset:     offset,
+		remoteSize: remoteSize,
+		file:       dest,
+		policy:     newServerPolicy(info),
+		mirrors:    newMirrorSet(mirrors),
+		retries:    newRetryGate(cfg.MaxConcurrentRetries),
+	}
+	if cfg.Stats {
+		d.chunkStats = &chunkStats{}
+	}
+	if cfg.ProbeMirrors && len(mirrors) > 1 && fileSize > 0 {
+		d.mirrors.setWeights(measureMirrors(ctx, cfg, mirrors, fileSize))
+	}
+	if state.resumed {
+		d.ifRange = state.ifRange()
+	}
+	if !info.AcceptRanges {
+		d.streamIfRange = state.ifRange()
+		if state.resumed && fileSize != unknownSize {
+			d.streamOffset = state.Streamed
+		}
+	}
+	d.rl = cfg.RateLimiter
+	if d.rl == nil && cfg.LimitMB > 0 {
+		d.rl = cfg.newRateLimiter(cfg.LimitMB)
+	}
 
+	resumed := d.streamOffset
 	for i := int64(0); i < chunks; i++ {
-		start := i * chunkSize
-		end := (i+1)*chunkSize - 1
-		if end >= fileSize {
-			end = fileSize - 1
+		if state.isDone(i) {
+			start, end := chunkRange(i, chunkSize, fileSize)
+			resumed += end - start + 1
 		}
+	}
+	progress := startProgress(d, fileSize, resumed)
+	defer func() { progress.stop(err) }()
+	cfg.Metrics.start(d)
+	defer cfg.Metrics.finish(d)
+
+	cfg.Events.emit(event{Event: eventStart, URL: cfg.URL, Output: cfg.Output, TotalBytes: fileSize, BytesDone: resumed})
+	cfg.Hooks.start(fileSize)
+
+	// Erro final de cada goroutine que desistiu, para o erro do download
+	// dizer quais faixas faltaram
+	var (
+		wg       sync.WaitGroup
+		failMu   sync.Mutex
+		failures []error
+	)
+	fail := func(err error) {
+		failMu.Lock()
+		failures = append(failures, err)
+		failMu.Unlock()
+	}
 
+	if !info.AcceptRanges {
 		wg.Add(1)
-		go downloadChunk(url, start, end, outFile, &wg, rl)
+		go func() {
+			defer wg.Done()
+			if err := d.downloadSingleStream(fileSize); err != nil {
+				slog.Error("Erro no download", "erro", err)
+				fail(fmt.Errorf("fluxo único: %w", err))
+				// O que já foi gravado é aproveitado pela próxima execução
+				if err := state.setStreamed(d.streamOffset); err != nil {
+					slog.Warn("Não foi possível gravar o estado do download", "erro", err)
+				}
+				return
+			}
+			if err := state.markDone(0, ""); err != nil {
+				slog.Warn("Não foi possível gravar o estado do download", "erro", err)
+			}
+		}()
+		chunks = 0
+	}
+
+	var jobs []chunkJob
+	for i := int64(0); i < chunks; i++ {
+		if state.isDone(i) {
+			continue
+		}
+
+		start, end := chunkRange(i, chunkSize, fileSize)
+		jobs = append(jobs, chunkJob{index: i, count: 1, start: start, end: end})
+	}
+	if state.resumed && len(cfg.Priorities) == 0 {
+		if merged := mergeJobs(jobs, cfg.threadsFor(fileSize)); len(merged) < len(jobs) {
+			slog.Info("Chunks pendentes vizinhos agrupados", "chunks", len(jobs), "faixas", len(merged))
+			jobs = merged
+		}
+	}
+
+	// Sem prioridades cada chunk tem seu worker; com prioridades as threads
+	// pegam os chunks da fila em ordem de peso
+	workers := len(jobs)
+	if len(cfg.Priorities) > 0 {
+		prioritizeChunks(jobs, cfg.Priorities)
+		workers = min(int(cfg.threadsFor(fileSize)), len(jobs))
+	}
+	queue := make(chan chunkJob, len(jobs))
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+
+	for w := 0; w < workers; w++ {
+		// Espaça o início das threads para não abrir todas as requisições
+		// no mesmo instante
+		if w > 0 && cfg.Spread > 0 {
+			if err := sleepContext(d.ctx, cfg.Spread); err != nil {
+				break
+			}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				// Os chunks que sobrarem ficam no .part para uma próxima
+				// execução
+				if cfg.Usage.exceeded() {
+					continue
+				}
+				if err := d.downloadChunkWithRetry(d.ctx, job.start, job.end); err != nil {
+					slog.Error("Erro no chunk", "inicio", job.start, "fim", job.end, "erro", err)
+					fail(fmt.Errorf("faixa %d-%d: %w", job.start, job.end, err))
+					continue
+				}
+				for i := job.index; i < job.index+job.count; i++ {
+					start, end := chunkRange(i, chunkSize, fileSize)
+					var sum string
+					if outFile != nil {
+						var err error
+						sum, err = hashRange(outFile, start, end)
+						if err != nil {
+							slog.Warn("Não foi possível calcular o hash do chunk", "inicio", start, "erro", err)
+						}
+					}
+					if err := state.markDone(i, sum); err != nil {
+						slog.Warn("Não foi possível gravar o estado do download", "erro", err)
+					}
+				}
+				e := d.event(eventChunkDone, progress.started)
+				e.Range = fmt.Sprintf("%d-%d", job.start, job.end)
+				cfg.Events.emit(e)
+			}
+		}()
 	}
 
 	wg.Wait()
-	log.Printf("Download concluído! Arquivo salvo como %s\n", fileName)
+
+	d.policy.logLimits()
+	d.mirrors.logStats()
+	d.chunkStats.write(os.Stderr)
+
+	if missing := len(state.Done) - state.doneCount(); missing > 0 {
+		if cfg.Usage.exceeded() {
+			return "", fileSize, fmt.Errorf("%w: %d chunks ficaram para a próxima execução", errDataCap, missing)
+		}
+		if d.sizeChanged.Load() {
+			return "", fileSize, errSizeChanged
+		}
+		if d.remoteChanged.Load() {
+			// Os chunks marcados como baixados são de outra versão do arquivo
+			state.remove()
+			return "", fileSize, errRemoteChanged
+		}
+		return "", fileSize, &chunksFailedError{missing: missing, errs: failures}
+	}
+
+	// Todos os chunks terminaram, mas um que tenha gravado menos bytes do que
+	// a faixa deixaria um buraco de zeros no arquivo. O fluxo único já confere
+	// o tamanho da resposta.
+	if info.AcceptRanges {
+		if written := d.written.Load(); written != fileSize {
+			// O estado diz que tudo foi baixado: não serve para retomar
+			state.remove()
+			return "", fileSize, fmt.Errorf("arquivo incompleto: %d de %d bytes gravados", written, fileSize)
+		}
+	}
+	state.remove()
+
+	if fileSize == unknownSize {
+		fileSize = d.written.Load()
+		slog.Info("Tamanho do arquivo", "bytes", fileSize)
+	}
+
+	if cfg.Checksum != "" {
+		if err := d.verifyChecksum(); err != nil {
+			return "", fileSize, err
+		}
+	}
+
+	if cfg.HashURL != "" {
+		if err := d.verifyRemoteHash(ctx); err != nil {
+			return "", fileSize, err
+		}
+	}
+
+	if cfg.ChecksumOutput != "" {
+		if err := d.writeChecksumOutput(); err != nil {
+			return "", fileSize, err
+		}
+	}
+
+	if cfg.Extract {
+		outFile.Close()
+		if cfg.Output, err = extractFile(cfg.Output, cfg.Force); err != nil {
+			// O download em si terminou: o arquivo compactado é mantido
+			return cfg.Output, fileSize, err
+		}
+	}
+
+	// Antes do -xattr, que grava o mtime junto com o checksum
+	if cfg.PreserveTimestamp {
+		preserveTimestamp(cfg.Output, info.LastModified)
+	}
+
+	if cfg.Xattr {
+		d.storeProvenance(cfg.Output)
+	}
+
+	slog.Info("Download concluído!", "arquivo", cfg.Output, "bytes", fileSize)
+	return cfg.Output, fileSize, nil
+}
+
+// Flag -header repetível no formato "Chave: Valor"
+type headerFlag http.Header
+
+func (h headerFlag) String() string {
+	return ""
+}
+
+func (h headerFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, ":")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return fmt.Errorf("cabeçalho inválido %q, use \"Chave: Valor\"", value)
+	}
+	http.Header(h).Add(key, strings.TrimSpace(val))
+	return nil
+}
+
+func runWithTimeout(ctx context.Context, cfg Config) (size int64, skipped bool, err error) {
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+
+	size, skipped, err = runDownload(ctx, cfg)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return size, false, fmt.Errorf("tempo limite de %s esgotado: %w", cfg.Timeout, err)
+	}
+	return size, skipped, err
+}
+
+// Flag repetível que também aceita valores separados por vírgula
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// Opções de teste que não aparecem na ajuda
+var hiddenFlags = map[string]bool{
+	"simulate-slow":   true,
+	"simulate-jitter": true,
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Uso: %s [opções] <url> <threads> <limiteMB>\n", os.Args[0])
+	fmt.Fprintf(out, "     %s [opções] -input <arquivo> <threads> <limiteMB>\n", os.Args[0])
+	flag.VisitAll(func(f *flag.Flag) {
+		if hiddenFlags[f.Name] {
+			return
+		}
+		name, usage := flag.UnquoteUsage(f)
+		if name != "" {
+			name = " " + name
+		}
+		fmt.Fprintf(out, "  -%s%s\n    \t%s\n", f.Name, name, usage)
+	})
 }
 
 func main() {
-	if len(os.Args) < 4 {
-		fmt.Printf("Uso: %s <url> <threads> <limiteMB>\n", os.Args[0])
+	var cfg Config
+	flag.StringVar(&cfg.Output, "output", "", "arquivo de destino (padrão: nome extraído da URL), - para a saída padrão ou s3://bucket/chave")
+	flag.BoolVar(&cfg.Force, "force", false, "sobrescreve o arquivo de destino se ele já existir")
+	flag.BoolVar(&cfg.Force, "overwrite", false, "o mesmo que -force")
+	flag.Var((*stringList)(&cfg.Mirrors), "mirror", "espelho com o mesmo arquivo, usado em rodízio nos chunks (pode repetir ou separar por vírgulas)")
+	flag.BoolVar(&cfg.ProbeMirrors, "probe-mirrors", false, "mede a velocidade dos espelhos (256KB de cada) e distribui os chunks na proporção")
+	flag.StringVar(&cfg.FallbackURL, "fallback-url", "", "URL alternativa com o mesmo arquivo, usada se a principal falhar")
+	flag.Var((*stringList)(&cfg.AllowedHosts), "allow-host", "host permitido para a URL final, aceita *.dominio (pode repetir)")
+	flag.BoolVar(&cfg.Preallocate, "preallocate", false, "reserva o espaço em disco com fallocate antes do download (Linux)")
+	flag.StringVar(&cfg.Checksum, "checksum", "", "checksum esperado do arquivo (SHA-256, ou o algoritmo de -algo), verificado ao final")
+	flag.StringVar(&cfg.ChecksumOutput, "checksum-output", "", "grava o checksum do arquivo baixado (no algoritmo de -algo) neste arquivo, no formato do sha256sum")
+	flag.StringVar(&cfg.Algo, "algo", defaultAlgo, "algoritmo de -checksum e -verify: md5, sha1, sha256 ou sha512")
+	flag.StringVar(&cfg.HashURL, "hash-url", "", "URL do SHA-256 publicado pelo servidor, com {url} e {name} (ex.: {url}.sha256)")
+	flag.StringVar(&cfg.ChecksumURL, "checksum-url", "", "URL do arquivo .sha256 ou .md5 com o checksum esperado, ou auto para tentar <url>.sha256 e <url>.md5")
+	cfg.HostOverrides = map[string]HostOverride{}
+	flag.Var(hostOverrideFlag{overrides: cfg.HostOverrides}, "host-threads", "threads para um host, no formato host=N; aceita *.dominio (pode repetir)")
+	flag.Var(hostOverrideFlag{overrides: cfg.HostOverrides, limit: true}, "host-limit", "limite de MB/s para um host, no formato host=N (pode repetir)")
+	flag.BoolVar(&cfg.Stats, "stats", false, "mostra ao final a faixa, os bytes, a duração e a velocidade de cada chunk")
+	flag.BoolVar(&cfg.VerifyResume, "verify-resume", false, "ao retomar, relê os chunks já baixados e baixa de novo os que não batem com o hash gravado no .part")
+	flag.BoolVar(&cfg.CleanupOnError, "cleanup-on-error", true, "apaga o arquivo parcial se o download falhar sem poder ser retomado (use =false para mantê-lo)")
+	flag.BoolVar(&cfg.OverwriteIfNewer, "overwrite-if-newer", false, "baixa só se o arquivo remoto for mais novo (Last-Modified) ou de tamanho diferente do local, como o wget -N; implica -preserve-timestamp")
+	flag.BoolVar(&cfg.PreserveTimestamp, "preserve-timestamp", false, "usa o Last-Modified do servidor como data de modificação do arquivo")
+	flag.BoolVar(&cfg.Xattr, "xattr", false, "grava a URL de origem e o SHA-256 nos atributos estendidos do arquivo (Linux)")
+	verify := flag.String("verify", "", "confere o checksum de um arquivo já baixado (com -checksum e -algo) e sai")
+	flag.BoolVar(&cfg.Extract, "extract", false, "descompacta o arquivo baixado (gzip, bzip2, zstd, xz)")
+	flag.Var((*priorityFlag)(&cfg.Priorities), "priority", "peso de uma faixa de bytes no formato inicio-fim=peso; faixas mais pesadas são baixadas primeiro (pode repetir)")
+	flag.BoolVar(&cfg.AutoThreads, "auto-threads", false, "escolhe as threads pelo tamanho do arquivo (1 a cada 32MB), usando <threads> como máximo")
+	flag.DurationVar(&cfg.Timeout, "timeout", 0, "tempo máximo do download inteiro (ex.: 10m), 0 para nenhum")
+	flag.DurationVar(&cfg.IdleTimeout, "idle-timeout", 0, "aborta e tenta de novo um chunk que fica esse tempo sem receber bytes")
+	dataCap := flag.Int64("data-cap", 0, "total de MB a receber na execução (somando benchmark, -input e -manifest); ao atingir, nenhum chunk novo começa e o download falha com o .part mantido")
+	flag.Int64Var(&cfg.LimitAfterMB, "limit-after", 0, "baixa os primeiros N MB de cada arquivo sem limite de banda e só depois aplica o <limiteMB>")
+	flag.Int64Var(&cfg.BurstMB, "burst", 0, "rajada do limite de banda em MB, acumulada enquanto a banda não é usada (0 = o próprio limite)")
+	flag.IntVar(&cfg.BufferSize, "buffer-size", defaultBufferSize, "tamanho do buffer de leitura de cada chunk, em bytes")
+	flag.Int64Var(&cfg.RangeStart, "range-start", 0, "baixa só a partir deste byte do arquivo remoto (com -range-end, uma janela do arquivo)")
+	flag.Int64Var(&cfg.RangeEnd, "range-end", 0, "último byte do arquivo remoto a baixar, inclusive (0 = até o fim)")
+	flag.Int64Var(&cfg.MinChunk, "min-chunk", defaultMinChunkSize, "tamanho mínimo de cada chunk, em bytes; com um arquivo pequeno as threads são reduzidas para não passar disso")
+	flag.StringVar(&cfg.Trailing, "trailing", trailingWarn, "bytes enviados além da faixa pedida: discard, warn ou error")
+	retryStatus := flag.String("retry-status", "", "códigos HTTP que geram nova tentativa, separados por vírgula (ex.: 429,500,502,503,504)")
+	flag.IntVar(&cfg.MaxConcurrentRetries, "max-concurrent-retries", 0, "máximo de chunks em nova tentativa ao mesmo tempo, 0 para sem limite")
+	flag.DurationVar(&cfg.RequestTimeout, "request-timeout", 0, "tempo máximo de cada requisição, incluindo a leitura do chunk")
+	flag.IntVar(&cfg.MaxIdleConns, "max-idle-conns", 0, "conexões ociosas mantidas por host para reuso (0 = número de threads)")
+	maxPerHost := flag.Int("max-per-host", 0, "transferências simultâneas por host, somando todos os arquivos e chunks (0 = sem limite)")
+	control := flag.Bool("control", false, "lê comandos da entrada padrão durante o download: pause, resume, status, limit <MB/s> e burst <MB>")
+	flag.IntVar(&cfg.MaxConnsPerHost, "max-conns-per-host", 0, "conexões abertas por host ao mesmo tempo; chunks além disso esperam uma conexão livre (0 = sem limite)")
+	flag.IntVar(&cfg.MaxRedirects, "max-redirects", defaultMaxRedirects, "redirecionamentos seguidos em cada requisição; 0 não segue nenhum")
+	flag.BoolVar(&cfg.SameHostRedirects, "same-host-redirects", false, "recusa redirecionamentos para um host diferente do da URL pedida")
+	flag.BoolVar(&cfg.DNSCache, "dns-cache", false, "resolve cada host uma vez e reaproveita o endereço nas conexões de todos os chunks (por 5 minutos)")
+	prefer := flag.String("prefer", preferAuto, "família de endereços das conexões: ip4, ip6 ou auto")
+	flag.BoolVar(&cfg.HTTP1, "http1", false, "força HTTP/1.1, com uma conexão TCP por chunk em vez de multiplexar numa conexão HTTP/2")
+	flag.DurationVar(&cfg.ConnectStagger, "connect-stagger", 0, "intervalo mínimo entre a abertura de novas conexões (ex.: 50ms)")
+	flag.DurationVar(&cfg.Spread, "spread", 0, "intervalo entre o início de cada thread de chunks, para não disparar todas as requisições juntas (ex.: 100ms)")
+	flag.DurationVar(&cfg.ConnectCooldown, "connect-cooldown", 0, "espera extra antes de tentar de novo um chunk após erro de conexão (ex.: 5s)")
+	flag.IntVar(&cfg.MaxAttempts, "max-attempts", maxChunkAttempts, "tentativas de cada chunk antes de desistir, somando todos os espelhos")
+	flag.IntVar(&cfg.TriesPerMirror, "tries-per-mirror", 1, "tentativas de cada chunk no mesmo espelho antes de passar para o próximo")
+	flag.IntVar(&cfg.ProbeAttempts, "probe-attempts", defaultProbeAttempts, "tentativas da consulta inicial do tamanho (HEAD) antes de desistir; 404, 401 e outros erros permanentes não são repetidos")
+	ioClass := flag.String("io-class", "", "prioridade de IO em disco no Linux: idle ou best-effort")
+	manifest := flag.String("manifest", "", "manifesto \"<sha256>  <arquivo>\" (arquivo ou URL); baixa cada arquivo a partir da <url> base")
+	input := flag.String("input", "", "arquivo com uma URL por linha (# para comentários); baixa cada uma uma vez")
+	flag.IntVar(&cfg.MaxConcurrentFiles, "max-concurrent-files", 1, "arquivos de -input ou -manifest baixados ao mesmo tempo")
+	historyPath := flag.String("history", "", "arquivo JSONL onde cada download é registrado")
+	warmup := flag.Int("warmup", defaultWarmupRuns, "execuções iniciais do benchmark reportadas como aquecimento, separadas das demais")
+	csvPath := flag.String("csv", "", "arquivo CSV com a duração, os bytes e a velocidade de cada execução do benchmark")
+	cfg.Header = http.Header{}
+	flag.Var(headerFlag(cfg.Header), "header", "cabeçalho HTTP extra no formato \"Chave: Valor\" (pode repetir)")
+	proxy := flag.String("proxy", "", "proxy para as requisições: http://, https:// ou socks5:// (padrão: HTTP_PROXY/HTTPS_PROXY)")
+	flag.BoolVar(&cfg.Insecure, "insecure", false, "não verifica o certificado TLS do servidor (inseguro)")
+	caCert := flag.String("cacert", "", "arquivo PEM com as CAs aceitas, no lugar das do sistema")
+	flag.StringVar(&cfg.UserAgent, "user-agent", defaultUserAgent, "User-Agent enviado nas requisições")
+	flag.StringVar(&cfg.Username, "user", "", "usuário para autenticação HTTP Basic")
+	flag.StringVar(&cfg.Password, "password", "", "senha para autenticação HTTP Basic")
+	flag.StringVar(&cfg.BearerToken, "bearer", "", "token enviado como \"Authorization: Bearer <token>\"")
+	flag.StringVar(&cfg.SSHKey, "ssh-key", "", "chave privada SSH para URLs sftp:// (requer compilar com -tags sftp)")
+	flag.StringVar(&cfg.SSHKnownHosts, "ssh-known-hosts", "", "known_hosts que confere a chave do servidor SFTP (padrão: ~/.ssh/known_hosts)")
+	flag.BoolVar(&cfg.SSHInsecureHostKey, "ssh-insecure-host-key", false, "não confere a chave do servidor SFTP no known_hosts (inseguro)")
+	logLevel := flag.String("log-level", "info", "nível de log: debug, info, warn ou error")
+	quiet := flag.Bool("quiet", false, "mostra apenas erros")
+	trace := flag.Bool("trace", false, "exporta spans OpenTelemetry (requer compilar com -tags otel)")
+	jsonOutput := flag.Bool("json", false, "emite eventos em JSON (um por linha) na saída padrão em vez dos logs")
+	dryRun := flag.Bool("dry-run", false, "mostra a URL final, o tamanho e os chunks que seriam baixados, sem baixar nada")
+	configPath := flag.String("config", "", "arquivo JSON ou YAML com as opções e os argumentos (url, threads, limit); a linha de comando tem prioridade")
+	status := flag.String("status", "", "mostra o progresso do download em andamento para o arquivo informado e sai")
+	listHistory := flag.Bool("history-list", false, "lista o histórico de -history e sai")
+	flag.DurationVar(&cfg.SimulateDelay, "simulate-slow", 0, "atraso artificial por leitura (testes)")
+	flag.DurationVar(&cfg.SimulateJitter, "simulate-jitter", 0, "variação aleatória do atraso de -simulate-slow (testes)")
+	flag.Usage = usage
+
+	flag.Parse()
+
+	var fileConfig configValues
+	if *configPath != "" {
+		values, err := loadConfigFile(*configPath)
+		if err != nil {
+			fatal(err.Error())
+		}
+		if err := applyConfigFile(flag.CommandLine, values); err != nil {
+			fatal(err.Error())
+		}
+		fileConfig = values
+	}
+
+	level, err := parseLogLevel(*logLevel)
+	if err != nil {
+		fatal(err.Error())
+	}
+	if *quiet {
+		level = slog.LevelError
+	}
+	setupLogger(level, *jsonOutput)
+
+	if *historyPath != "" {
+		cfg.History = OpenHistory(*historyPath)
+	}
+
+	if *status != "" {
+		if err := printStatus(*status); err != nil {
+			fatal(err.Error())
+		}
+		return
+	}
+
+	cfg.Algo = strings.ToLower(cfg.Algo)
+	if err := checkDigest(cfg.algo(), cfg.Checksum); err != nil {
+		fatal(err.Error())
+	}
+	if err := checkWindow(cfg.RangeStart, cfg.RangeEnd); err != nil {
+		fatal(err.Error())
+	}
+
+	if *verify != "" {
+		if err := verifyFile(*verify, cfg.algo(), cfg.Checksum); err != nil {
+			fatal(err.Error())
+		}
+		return
+	}
+
+	if *listHistory {
+		if cfg.History == nil {
+			fatal("-history-list requer -history")
+		}
+		if err := printHistory(cfg.History); err != nil {
+			fatal("Erro lendo histórico", "erro", err)
+		}
+		return
+	}
+
+	if cfg.Proxy, err = parseProxy(*proxy); err != nil {
+		fatal(err.Error())
+	}
+	if cfg.RootCAs, err = loadCertPool(*caCert); err != nil {
+		fatal(err.Error())
+	}
+	if cfg.Prefer, err = parsePrefer(*prefer); err != nil {
+		fatal(err.Error())
+	}
+	if cfg.Insecure {
+		slog.Warn("ATENÇÃO: -insecure desativa a verificação dos certificados TLS; a conexão pode ser interceptada sem aviso")
+	}
+	if cfg.SSHInsecureHostKey {
+		slog.Warn("ATENÇÃO: -ssh-insecure-host-key aceita qualquer chave do servidor SFTP; a conexão pode ser interceptada sem aviso")
+	}
+	if cfg.Username != "" && cfg.BearerToken != "" {
+		fatal("Use -user/-password ou -bearer, não ambos")
+	}
+
+	if !validTrailingMode(cfg.Trailing) {
+		fatal("Valor inválido para -trailing", "valor", cfg.Trailing)
+	}
+
+	retryCodes, err := parseStatusList(*retryStatus)
+	if err != nil {
+		fatal(err.Error())
+	}
+	cfg.RetryStatus = retryCodes
+
+	class, err := parseIOClass(*ioClass)
+	if err != nil {
+		fatal(err.Error())
+	}
+	if err := setIOPriority(class); err != nil {
+		slog.Warn("Não foi possível ajustar a prioridade de IO", "erro", err)
+	}
+
+	// Com -input as URLs vêm do arquivo e só restam <threads> <limiteMB>
+	args := flag.Args()
+	if len(args) == 0 && fileConfig != nil {
+		args = fileConfig.positional(*input == "")
+	}
+	if *input == "" {
+		if len(args) < 3 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		cfg.URL, args = args[0], args[1:]
+	} else if len(args) < 2 {
+		flag.Usage()
 		os.Exit(1)
 	}
 
-	url := os.Args[1]
+	if args[0] == "auto" {
+		cfg.AutoThreads = true
+	} else {
+		threads, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil || threads <= 0 {
+			fatal("Número de threads inválido", "valor", args[0])
+		}
+		cfg.Threads = threads
+	}
+	cfg.Client = newHTTPClient(cfg)
+
+	limitMB, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || limitMB < 0 {
+		fatal("Limite de MB/s inválido", "valor", args[1])
+	}
+	cfg.LimitMB = limitMB
+
+	if *input != "" && cfg.Output != "" {
+		fatal("-output não pode ser usado com -input; cada arquivo recebe o nome da sua URL")
+	}
+	if (*input != "" || *manifest != "") && cfg.ChecksumOutput != "" {
+		fatal("-checksum-output grava o checksum de um único arquivo e não pode ser usado com -input ou -manifest")
+	}
+	if cfg.Output == "" {
+		cfg.Output = getFileName(cfg.URL)
+	}
+
+	if *jsonOutput {
+		if cfg.Output == "-" {
+			fatal("-json não pode ser usado com -output -, os dois escrevem na saída padrão")
+		}
+		cfg.Events = newEventLog(os.Stdout)
+	}
+
+	if isSFTP(cfg.URL) && openSFTP == nil {
+		fatal("Suporte a SFTP não compilado; use go build -tags sftp")
+	}
 
-	threads, err := strconv.ParseInt(os.Args[2], 10, 64)
-	if err != nil || threads <= 0 {
-		log.Fatalln("Número de threads inválido:", os.Args[2])
+	if *trace {
+		if setupTracing == nil {
+			fatal("Suporte a OpenTelemetry não compilado; use go build -tags otel")
+		}
+		tracer, shutdown, err := setupTracing(context.Background())
+		if err != nil {
+			fatal("Erro configurando OpenTelemetry", "erro", err)
+		}
+		cfg.Tracer = tracer
+		defer shutdown(context.Background())
 	}
 
-	limitMB, err := strconv.ParseInt(os.Args[3], 10, 64)
-	if err != nil || limitMB <= 0 {
-		log.Fatalln("Limite de MB/s inválido:", os.Args[3])
+	if *dataCap < 0 {
+		fatal("Valor inválido para -data-cap", "valor", *dataCap)
 	}
+	cfg.Usage = NewDataUsage(*dataCap * 1024 * 1024)
 
-	var total time.Duration
+	if *maxPerHost < 0 {
+		fatal("Valor inválido para -max-per-host", "valor", *maxPerHost)
+	}
+	if *maxPerHost > 0 {
+		cfg.HostLimiter = NewHostLimiter(*maxPerHost)
+	}
+
+	// Com vários arquivos o limite de banda vale para o total, não para cada
+	// um: todos os chunks de todos os arquivos passam pelo mesmo limitador
+	if *manifest != "" || *input != "" {
+		if cfg.LimitMB > 0 {
+			cfg.RateLimiter = cfg.newRateLimiter(cfg.LimitMB)
+		}
+		shareHostLimits(cfg)
+	}
+
+	if *control {
+		cfg.Pause = NewPauseControl()
+		// O limite de banda precisa existir, mesmo zerado, para que limit
+		// e burst mudem o limitador que os chunks usam
+		if cfg.RateLimiter == nil {
+			cfg.RateLimiter = cfg.newRateLimiter(cfg.LimitMB)
+		}
+		c := newController(cfg)
+		cfg.Hooks = c.status.hooks()
+		go c.serve(os.Stdin)
+	}
+
+	// Ctrl+C e SIGTERM cancelam os downloads em andamento, que gravam o
+	// estado final no .status em vez de deixá-lo como running
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *dryRun {
+		if err := runDryRun(ctx, cfg); err != nil {
+			fatal("Erro", "erro", err)
+		}
+		return
+	}
+
+	if *manifest != "" {
+		err := runManifest(ctx, cfg, *manifest)
+		logDataUsage(cfg.Usage)
+		if err != nil {
+			fatal("Erro", "erro", err)
+		}
+		return
+	}
+
+	if *input != "" {
+		err := runURLList(ctx, cfg, *input)
+		logDataUsage(cfg.Usage)
+		if err != nil {
+			fatal("Erro", "erro", err)
+		}
+		return
+	}
+
+	if strings.HasPrefix(cfg.Output, s3Scheme) {
+		err := runToS3(ctx, cfg)
+		logDataUsage(cfg.Usage)
+		if err != nil {
+			fatal("Erro", "erro", err)
+		}
+		return
+	}
+
+	if cfg.Output == "-" {
+		err := runToStdout(ctx, cfg)
+		logDataUsage(cfg.Usage)
+		if err != nil {
+			fatal("Erro", "erro", err)
+		}
+		return
+	}
+
+	// No espelhamento o arquivo local é o resultado: baixa uma vez e o mantém,
+	// em vez de apagá-lo entre as execuções do benchmark. Com -extract também:
+	// o arquivo descompactado da primeira execução faria as seguintes
+	// falharem por ele já existir.
+	if cfg.mirroring() || cfg.Extract {
+		_, skipped, err := runWithTimeout(ctx, cfg)
+		logDataUsage(cfg.Usage)
+		if err != nil {
+			fatal("Erro", "erro", err)
+		}
+		if skipped {
+			slog.Info("Nada a baixar", "arquivo", cfg.Output)
+		}
+		return
+	}
+
+	// As execuções compartilham cfg.Client e, com ele, o pool de conexões:
+	// depois do aquecimento o tempo medido é o da transferência, sem DNS,
+	// TCP e TLS
+	var results []runResult
 	const runs = 30
+	if *warmup < 0 || *warmup >= runs {
+		fatal("Valor inválido para -warmup", "valor", *warmup, "maximo", runs-1)
+	}
 
 	for i := 0; i < runs; i++ {
 		start := time.Now()
-		log.Printf("Execução %d/%d\n", i+1, runs)
-		runDownload(url, threads, limitMB)
+		slog.Info("Execução", "numero", i+1, "total", runs, "aquecimento", i < *warmup)
+		size, skipped, err := runWithTimeout(ctx, cfg)
 		duration := time.Since(start)
-		log.Printf("Tempo execução %d: %s\n", i+1, duration)
-		total += duration
+		if err != nil {
+			slog.Error("Erro", "erro", err)
+		}
+		slog.Info("Tempo execução", "numero", i+1, "duracao", duration)
+		results = append(results, runResult{Duration: duration, Bytes: size, Err: err})
 
-		// Remove o arquivo para próxima execução
-		os.Remove(getFileName(url))
+		// Remove o arquivo para próxima execução, só se foi esta que o gravou
+		if err == nil && !skipped {
+			os.Remove(cfg.Output)
+		}
+		if errors.Is(err, errDataCap) {
+			slog.Warn("Limite de dados atingido, encerrando o benchmark", "execucoes", i+1)
+			break
+		}
+		if ctx.Err() != nil {
+			slog.Warn("Interrompido, encerrando o benchmark", "execucoes", i+1)
+			break
+		}
 	}
 
-	log.Printf("Tempo médio das %d execuções: %s\n", runs, total/time.Duration(runs))
+	logBenchmarkStats(results, *warmup)
+	logDataUsage(cfg.Usage)
+
+	if *csvPath != "" {
+		if err := writeBenchmarkCSV(*csvPath, results, *warmup); err != nil {
+			fatal("Erro gravando resultados", "arquivo", *csvPath, "erro", err)
+		}
+		slog.Info("Resultados gravados", "arquivo", *csvPath)
+	}
 }
 
 //a
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Os logs do download só atrapalham a saída dos testes
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// Validadores enviados pelo rangeServer
+const testETag = `"v1"`
+
+var testModified = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// Bytes pseudoaleatórios, para que um trecho gravado no offset errado não
+// passe despercebido
+func testData(n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(data)
+	return data
+}
+
+// Faixa pedida em "Range: bytes=a-b" ou "bytes=a-"; ok falso sem Range ou
+// com um formato que o servidor de teste não atende
+func requestedRange(header string, size int64) (start, end int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	startStr, endStr, _ := strings.Cut(spec, "-")
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	end = size - 1
+	if endStr != "" {
+		if end, err = strconv.ParseInt(endStr, 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	return start, min(end, size-1), true
+}
+
+// Responde como um servidor de arquivos estáticos: HEAD e GET com o arquivo
+// inteiro, ou 206 com Content-Range para um GET com Range
+func serveRange(w http.ResponseWriter, r *http.Request, data []byte) {
+	size := int64(len(data))
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	start, end, ok := requestedRange(r.Header.Get("Range"), size)
+	if !ok {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		if r.Method != http.MethodHead {
+			w.Write(data)
+		}
+		return
+	}
+	if start > end {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	if r.Method != http.MethodHead {
+		w.Write(data[start : end+1])
+	}
+}
+
+// Servidor de teste que atende faixas de um buffer fixo, com ETag e
+// Last-Modified, e registra as requisições recebidas
+type rangeServer struct {
+	*httptest.Server
+	data []byte
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func newRangeServer(t testing.TB, data []byte) *rangeServer {
+	s := &rangeServer{data: data}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.record(r)
+		w.Header().Set("ETag", testETag)
+		w.Header().Set("Last-Modified", testModified.Format(http.TimeFormat))
+		serveRange(w, r, s.data)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Guarda "MÉTODO faixa", com a faixa vazia sem Range
+func (s *rangeServer) record(r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, strings.TrimSpace(r.Method+" "+strings.TrimPrefix(r.Header.Get("Range"), "bytes=")))
+}
+
+func (s *rangeServer) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *rangeServer) fileURL() string {
+	return s.URL + "/arquivo.bin"
+}
+
+// Config de um download de url para um diretório temporário, sem o tamanho
+// mínimo de chunk para que arquivos pequenos também usem várias threads
+func testConfig(t testing.TB, url string) Config {
+	return Config{
+		URL:      url,
+		Threads:  4,
+		MinChunk: 1,
+		Output:   filepath.Join(t.TempDir(), "arquivo.bin"),
+	}
+}
+
+// Requisições GET registradas pelo rangeServer
+func countRanged(requests []string) int {
+	n := 0
+	for _, r := range requests {
+		if strings.HasPrefix(r, "GET ") {
+			n++
+		}
+	}
+	return n
+}
+
+func checkFile(t *testing.T, path string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s tem %d bytes diferentes do original (%d bytes)", path, len(got), len(want))
+	}
+}
+
+func TestGetFileSize(t *testing.T) {
+	data := testData(12345)
+	srv := newRangeServer(t, data)
+
+	info, err := getFileSize(context.Background(), testConfig(t, srv.fileURL()), srv.fileURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len(data)) {
+		t.Errorf("Size = %d, esperado %d", info.Size, len(data))
+	}
+	if !info.AcceptRanges {
+		t.Error("AcceptRanges falso com Accept-Ranges: bytes")
+	}
+	if info.ETag != testETag {
+		t.Errorf("ETag = %q, esperado %q", info.ETag, testETag)
+	}
+	if !info.LastModified.Equal(testModified) {
+		t.Errorf("LastModified = %s, esperado %s", info.LastModified, testModified)
+	}
+	if info.URL != srv.fileURL() {
+		t.Errorf("URL = %q, esperada %q", info.URL, srv.fileURL())
+	}
+	if got := srv.Requests(); len(got) != 1 || got[0] != "HEAD" {
+		t.Errorf("requisições %q, esperado só o HEAD", got)
+	}
+}
+
+func TestDownloadChunk(t *testing.T) {
+	data := testData(10000)
+	srv := newRangeServer(t, data)
+	cfg := testConfig(t, srv.fileURL())
+
+	f, err := os.Create(cfg.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Truncate(int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	size := int64(len(data))
+	d := &download{
+		ctx:        ctx,
+		cancel:     cancel,
+		cfg:        cfg,
+		url:        srv.fileURL(),
+		size:       size,
+		remoteSize: size,
+		file:       f,
+		policy:     newServerPolicy(remoteInfo{}),
+		mirrors:    newMirrorSet([]string{srv.fileURL()}),
+	}
+
+	n, err := d.downloadChunk(ctx, srv.fileURL(), 2500, 4999)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2500 {
+		t.Errorf("downloadChunk gravou %d bytes, esperados 2500", n)
+	}
+
+	// Só a faixa pedida é gravada; o resto do arquivo continua zerado
+	want := make([]byte, len(data))
+	copy(want[2500:5000], data[2500:5000])
+	checkFile(t, cfg.Output, want)
+	if got := srv.Requests(); len(got) != 1 || got[0] != "GET 2500-4999" {
+		t.Errorf("requisições %q, esperado GET 2500-4999", got)
+	}
+}
+
+func TestRunDownload(t *testing.T) {
+	data := testData(1<<20 + 123)
+	srv := newRangeServer(t, data)
+	cfg := testConfig(t, srv.fileURL())
+
+	size, skipped, err := runDownload(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(data)) {
+		t.Errorf("runDownload retornou %d bytes, esperado %d", size, len(data))
+	}
+	if skipped {
+		t.Error("download sem arquivo local marcado como pulado")
+	}
+	checkFile(t, cfg.Output, data)
+
+	// Um download concluído não deixa o estado nem o progresso para trás
+	for _, path := range []string{partPath(cfg.Output), statusPath(cfg.Output)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s ficou depois do download", path)
+		}
+	}
+
+	if ranged := countRanged(srv.Requests()); ranged != int(cfg.Threads) {
+		t.Errorf("%d requisições de faixa, esperadas %d", ranged, cfg.Threads)
+	}
+}
+
+// Tamanhos na divisa do plano: divisível pelas threads, um byte a mais e
+// menor que o número de threads. Nenhum deve gerar faixa vazia, sobreposta
+// ou chunk além das threads.
+func TestChunkPlanBoundaries(t *testing.T) {
+	const threads, chunk = 4, 2500
+	for _, size := range []int64{threads * chunk, threads*chunk + 1, threads*chunk - 1, threads, threads + 1, 1} {
+		t.Run(strconv.FormatInt(size, 10), func(t *testing.T) {
+			cfg := Config{Threads: threads, MinChunk: 1}
+			info := remoteInfo{Size: size, AcceptRanges: true}
+			chunkSize := planChunkSize(cfg, &info)
+			chunks := chunkCount(size, chunkSize)
+			if chunks > threads {
+				t.Errorf("%d chunks para %d threads", chunks, threads)
+			}
+			if err := checkChunkPlan(chunks, chunkSize, size); err != nil {
+				t.Fatal(err)
+			}
+			if _, end := chunkRange(chunks-1, chunkSize, size); end != size-1 {
+				t.Errorf("último chunk termina em %d, esperado %d", end, size-1)
+			}
+
+			data := testData(int(size))
+			srv := newRangeServer(t, data)
+			dcfg := testConfig(t, srv.fileURL())
+			dcfg.Threads = threads
+			if _, _, err := runDownload(context.Background(), dcfg); err != nil {
+				t.Fatal(err)
+			}
+			checkFile(t, dcfg.Output, data)
+
+			// As faixas pedidas cobrem o arquivo uma vez só
+			covered := make([]int, size)
+			ranged := 0
+			for _, r := range srv.Requests() {
+				spec, ok := strings.CutPrefix(r, "GET ")
+				if !ok {
+					continue
+				}
+				ranged++
+				start, end, ok := requestedRange("bytes="+spec, size)
+				if !ok || start > end {
+					t.Fatalf("faixa vazia ou inválida: %q", r)
+				}
+				for i := start; i <= end; i++ {
+					covered[i]++
+				}
+			}
+			if int64(ranged) != chunks {
+				t.Errorf("%d requisições de faixa, esperadas %d", ranged, chunks)
+			}
+			for i, n := range covered {
+				if n != 1 {
+					t.Fatalf("byte %d pedido %d vezes", i, n)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckChunkPlanRejects(t *testing.T) {
+	tests := []struct {
+		chunks, chunkSize, size int64
+	}{
+		// Um chunk vazio além do fim
+		{5, 2500, 10000},
+		// O último byte fica de fora
+		{4, 2500, 10001},
+		{3, 2500, 10000},
+		{4, 0, 10000},
+		{1, 1, 0},
+	}
+	for _, tt := range tests {
+		if err := checkChunkPlan(tt.chunks, tt.chunkSize, tt.size); err == nil {
+			t.Errorf("%d chunks de %d bytes para %d bytes aceito", tt.chunks, tt.chunkSize, tt.size)
+		}
+	}
+	if err := checkChunkPlan(4, 2500, 10000); err != nil {
+		t.Errorf("plano exato recusado: %v", err)
+	}
+}
+
+// Um arquivo vazio (Content-Length: 0) é criado sem pedir faixas
+func TestZeroLengthFile(t *testing.T) {
+	srv := newRangeServer(t, nil)
+	empty := sha256.Sum256(nil)
+
+	cfg := testConfig(t, srv.fileURL())
+	cfg.Checksum = hex.EncodeToString(empty[:])
+	size, _, err := runDownload(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 0 {
+		t.Errorf("runDownload retornou %d bytes, esperado 0", size)
+	}
+	checkFile(t, cfg.Output, nil)
+	if n := countRanged(srv.Requests()); n != 0 {
+		t.Errorf("%d GETs para um arquivo vazio", n)
+	}
+	for _, path := range []string{partPath(cfg.Output), statusPath(cfg.Output)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s criado para um arquivo vazio", path)
+		}
+	}
+
+	// Um arquivo antigo só é trocado pelo vazio com -force
+	if err := os.WriteFile(cfg.Output, []byte("antigo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Checksum = ""
+	if _, _, err := runDownload(context.Background(), cfg); err == nil {
+		t.Error("arquivo existente sobrescrito sem -force")
+	}
+	cfg.Force = true
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, nil)
+
+	cfg.Checksum = strings.Repeat("0", 64)
+	if _, _, err := runDownload(context.Background(), cfg); err == nil {
+		t.Error("checksum errado aceito para um arquivo vazio")
+	}
+}
+
+// Com mais threads que bytes, o tamanho mínimo de chunk reduz as threads:
+// nada de uma requisição por byte
+func TestSmallFileManyThreads(t *testing.T) {
+	tests := []struct {
+		minChunk int64
+		chunks   int
+	}{
+		// Padrão de 1MB: um chunk só
+		{0, 1},
+		{4, 3},
+		{1, 10},
+	}
+	for _, tt := range tests {
+		data := testData(10)
+		srv := newRangeServer(t, data)
+		cfg := testConfig(t, srv.fileURL())
+		cfg.Threads = 64
+		cfg.MinChunk = tt.minChunk
+
+		if _, _, err := runDownload(context.Background(), cfg); err != nil {
+			t.Fatal(err)
+		}
+		checkFile(t, cfg.Output, data)
+		if n := countRanged(srv.Requests()); n != tt.chunks {
+			t.Errorf("chunk mínimo %d: %d requisições de faixa para 10 bytes, esperadas %d", tt.minChunk, n, tt.chunks)
+		}
+	}
+}
+
+// Download de 32MB com 8 threads e cada tamanho de -buffer-size, sem limite
+// de banda: go test -bench BufferSize
+func BenchmarkBufferSize(b *testing.B) {
+	srv := newRangeServer(b, testData(32<<20))
+	for _, size := range []int{16 << 10, 64 << 10, defaultBufferSize, 1 << 20} {
+		b.Run(strconv.Itoa(size>>10)+"KB", func(b *testing.B) {
+			cfg := testConfig(b, srv.fileURL())
+			cfg.Threads = 8
+			cfg.BufferSize = size
+			cfg.Client = newHTTPClient(cfg)
+			b.SetBytes(int64(len(srv.data)))
+			for b.Loop() {
+				os.Remove(cfg.Output)
+				if _, _, err := runDownload(context.Background(), cfg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// Gravação de 32MB em blocos de 16KB, o tamanho das leituras com limite de
+// banda, com e sem o buffer de 1MB do sectionWriter: go test -bench SectionWriter
+func BenchmarkSectionWriter(b *testing.B) {
+	block := testData(16 << 10)
+	const total = 32 << 20
+	for _, bufSize := range []int{0, writeBufferSize} {
+		name := "sem-buffer"
+		if bufSize > 0 {
+			name = strconv.Itoa(bufSize>>10) + "KB"
+		}
+		b.Run(name, func(b *testing.B) {
+			file, err := os.Create(filepath.Join(b.TempDir(), "arquivo.bin"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer file.Close()
+			b.SetBytes(total)
+			for b.Loop() {
+				sw := &sectionWriter{file: file, buf: make([]byte, 0, bufSize)}
+				for range total / len(block) {
+					if _, err := sw.Write(block); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if err := sw.flush(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Linha de um manifesto no formato do sha256sum: "<sha256>  <arquivo>"
+type manifestEntry struct {
+	Checksum string
+	Name     string
+}
+
+// O nome é tudo o que vem depois do primeiro trecho de espaços, então pode
+// ter espaços no meio e no fim
+func parseManifest(r io.Reader) ([]manifestEntry, error) {
+	var entries []manifestEntry
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimLeft(strings.TrimSuffix(scanner.Text(), "\r"), " \t")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		i := strings.IndexAny(text, " \t")
+		if i < 0 {
+			return nil, fmt.Errorf("manifesto linha %d: formato inválido %q", line, text)
+		}
+		sum := strings.ToLower(text[:i])
+		// "*" antes do nome indica modo binário no sha256sum
+		name := strings.TrimPrefix(strings.TrimLeft(text[i:], " \t"), "*")
+		if name == "" {
+			return nil, fmt.Errorf("manifesto linha %d: formato inválido %q", line, text)
+		}
+		if err := checkDigest(defaultAlgo, sum); err != nil {
+			return nil, fmt.Errorf("manifesto linha %d: %w", line, err)
+		}
+
+		clean := path.Clean(name)
+		if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("manifesto linha %d: caminho inválido %q", line, name)
+		}
+
+		entries = append(entries, manifestEntry{Checksum: sum, Name: clean})
+	}
+	return entries, scanner.Err()
+}
+
+// O manifesto pode ser um arquivo local ou uma URL
+func openManifest(ctx context.Context, cfg Config, src string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		return os.Open(src)
+	}
+
+	req, err := newRequest(ctx, cfg, "GET", src)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cfg.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("erro baixando manifesto: %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func manifestURL(base, name string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u.ResolveReference(&url.URL{Path: name}).String(), nil
+}
+
+// Baixa todos os arquivos do manifesto a partir da URL base, salvando cada
+// um com o nome do manifesto e verificando o SHA-256 listado. Até
+// cfg.MaxConcurrentFiles arquivos são baixados ao mesmo tempo.
+func runManifest(ctx context.Context, cfg Config, src string) error {
+	f, err := openManifest(ctx, cfg, src)
+	if err != nil {
+		return err
+	}
+	entries, err := parseManifest(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Manifesto carregado", "arquivos", len(entries))
+
+	var (
+		mu     sync.Mutex
+		failed []string
+	)
+	fail := func(name string, err error) {
+		slog.Error("Erro baixando arquivo do manifesto", "arquivo", name, "erro", err)
+		mu.Lock()
+		failed = append(failed, name)
+		mu.Unlock()
+	}
+	// Um arquivo que não pode começar não interrompe os outros, nem os que
+	// já estão sendo baixados
+	pool := newFilePool(cfg.MaxConcurrentFiles)
+	for _, entry := range entries {
+		fileCfg := cfg
+		fileCfg.Checksum = entry.Checksum
+		fileCfg.Algo = defaultAlgo
+		fileCfg.Output = filepath.FromSlash(entry.Name)
+		if fileCfg.URL, err = manifestURL(cfg.URL, entry.Name); err != nil {
+			fail(entry.Name, err)
+			continue
+		}
+
+		if dir := filepath.Dir(fileCfg.Output); dir != "." {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				fail(entry.Name, err)
+				continue
+			}
+		}
+
+		pool.Go(func() {
+			if _, _, err := runWithTimeout(ctx, fileCfg); err != nil {
+				fail(entry.Name, err)
+			}
+		})
+	}
+	pool.Wait()
+
+	slog.Info("Manifesto concluído", "baixados", len(entries)-len(failed), "arquivos", len(entries))
+	if len(failed) > 0 {
+		return fmt.Errorf("falha em %d arquivos: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
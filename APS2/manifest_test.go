@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestParseManifest(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	tests := []struct {
+		name  string
+		input string
+		want  []manifestEntry
+		ok    bool
+	}{
+		{"dois espaços", sum + "  arquivo.bin\n", []manifestEntry{{sum, "arquivo.bin"}}, true},
+		{"modo binário", sum + " *arquivo.bin\n", []manifestEntry{{sum, "arquivo.bin"}}, true},
+		{"nome com espaços", sum + "  meu arquivo  final.iso\n", []manifestEntry{{sum, "meu arquivo  final.iso"}}, true},
+		{"tabulação e CRLF", sum + "\tdir/arquivo.bin\r\n", []manifestEntry{{sum, "dir/arquivo.bin"}}, true},
+		{"maiúsculas", strings.ToUpper(sum) + "  a\n", []manifestEntry{{sum, "a"}}, true},
+		{"comentários e linhas vazias", "# SHA256SUMS\n\n   \n" + sum + "  a\n", []manifestEntry{{sum, "a"}}, true},
+		{"sem nome", sum + "\n", nil, false},
+		{"só espaços depois do hash", sum + "   \n", nil, false},
+		{"hash curto", sum[:62] + "  a\n", nil, false},
+		{"hash não hexadecimal", strings.Repeat("zz", 32) + "  a\n", nil, false},
+		{"caminho absoluto", sum + "  /etc/passwd\n", nil, false},
+		{"fora da pasta", sum + "  ../a\n", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := parseManifest(strings.NewReader(tt.input))
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: erro %v, esperado ok=%v", tt.name, err, tt.ok)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		if len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+			t.Errorf("%s: %+v, esperado %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Todos os arquivos são tentados e esperados; o erro lista só os que
+// falharam
+func TestRunManifest(t *testing.T) {
+	files := map[string][]byte{
+		"/release/um.bin":          testData(3000),
+		"/release/com espaço.bin":  testData(4000),
+		"/release/sub/tres.bin":    testData(5000),
+		"/release/checksum-errado": testData(100),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", testETag)
+		serveRange(w, r, data)
+	}))
+	defer srv.Close()
+
+	manifest := strings.Join([]string{
+		// A pasta não pode ser criada: falha antes do download começar
+		strings.Repeat("2", 64) + "  bloqueio/x.bin",
+		sha256Hex(files["/release/um.bin"]) + "  um.bin",
+		sha256Hex(files["/release/com espaço.bin"]) + " *com espaço.bin",
+		sha256Hex(files["/release/sub/tres.bin"]) + "  sub/tres.bin",
+		strings.Repeat("0", 64) + "  checksum-errado",
+		strings.Repeat("1", 64) + "  nao-existe.bin",
+	}, "\n")
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if err := os.WriteFile("SHA256SUMS", []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("bloqueio", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig(t, srv.URL+"/release/")
+	cfg.Output = ""
+	err := runManifest(context.Background(), cfg, "SHA256SUMS")
+	if err == nil {
+		t.Fatal("manifesto com arquivos inválidos terminou sem erro")
+	}
+	for _, name := range []string{"bloqueio/x.bin", "checksum-errado", "nao-existe.bin"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("erro %q não cita %s", err, name)
+		}
+	}
+	for _, name := range []string{"um.bin", "com espaço.bin", "sub/tres.bin"} {
+		checkFile(t, filepath.Join(dir, filepath.FromSlash(name)), files["/release/"+name])
+	}
+}
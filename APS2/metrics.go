@@ -0,0 +1,93 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Métricas agregadas dos downloads que usam o mesmo Metrics em
+// Config.Metrics, para quem embute o downloader num servidor. Os valores são
+// lidos na hora da coleta dos mesmos contadores atômicos do progresso; a
+// exportação para o Prometheus fica em metrics_prometheus.go e só é
+// compilada com -tags prometheus.
+type Metrics struct {
+	mu sync.Mutex
+	// Downloads em andamento e o que já tinham gravado ao começar (bytes de
+	// uma retomada não contam como baixados)
+	active map[*download]int64
+	// Bytes dos downloads já encerrados
+	finished int64
+	// Maior total já informado, para o contador nunca diminuir quando um
+	// fluxo único recomeça do zero
+	reported int64
+
+	lastBytes int64
+	lastAt    time.Time
+
+	retries atomic.Int64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{active: map[*download]int64{}, lastAt: time.Now()}
+}
+
+// Valores de uma coleta
+type metricsSnapshot struct {
+	BytesDownloaded int64
+	ActiveDownloads int
+	ActiveChunks    int64
+	Retries         int64
+	// Velocidade somada de todos os downloads desde a coleta anterior, em
+	// bytes por segundo
+	Rate float64
+}
+
+func (m *Metrics) start(d *download) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.active[d] = d.written.Load()
+	m.mu.Unlock()
+}
+
+func (m *Metrics) finish(d *download) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	if base, ok := m.active[d]; ok {
+		m.finished += max(d.written.Load()-base, 0)
+		delete(m.active, d)
+	}
+	m.mu.Unlock()
+}
+
+func (m *Metrics) retry() {
+	if m == nil {
+		return
+	}
+	m.retries.Add(1)
+}
+
+func (m *Metrics) snapshot() metricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := metricsSnapshot{ActiveDownloads: len(m.active), Retries: m.retries.Load()}
+	bytes := m.finished
+	for d, base := range m.active {
+		bytes += max(d.written.Load()-base, 0)
+		s.ActiveChunks += int64(d.active.Load())
+	}
+	m.reported = max(m.reported, bytes)
+	s.BytesDownloaded = m.reported
+
+	now := time.Now()
+	if elapsed := now.Sub(m.lastAt).Seconds(); elapsed > 0 {
+		s.Rate = float64(s.BytesDownloaded-m.lastBytes) / elapsed
+	}
+	m.lastBytes, m.lastAt = s.BytesDownloaded, now
+	return s
+}
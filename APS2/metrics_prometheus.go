@@ -0,0 +1,49 @@
+//go:build prometheus
+
+package main
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Cria um Metrics e registra seus coletores no registry. Basta colocar o
+// Metrics retornado em Config.Metrics dos downloads que devem ser medidos.
+func RegisterMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	m := NewMetrics()
+	if err := reg.Register(metricsCollector{m}); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var (
+	bytesDesc = prometheus.NewDesc("aps2_downloaded_bytes_total",
+		"Bytes baixados, sem contar os de retomadas", nil, nil)
+	activeDownloadsDesc = prometheus.NewDesc("aps2_active_downloads",
+		"Downloads em andamento", nil, nil)
+	activeChunksDesc = prometheus.NewDesc("aps2_active_chunks",
+		"Chunks baixando neste momento", nil, nil)
+	retriesDesc = prometheus.NewDesc("aps2_chunk_retries_total",
+		"Novas tentativas de chunks que falharam", nil, nil)
+	rateDesc = prometheus.NewDesc("aps2_download_rate_bytes",
+		"Velocidade somada dos downloads desde a coleta anterior, em bytes por segundo", nil, nil)
+)
+
+type metricsCollector struct {
+	m *Metrics
+}
+
+func (c metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- bytesDesc
+	ch <- activeDownloadsDesc
+	ch <- activeChunksDesc
+	ch <- retriesDesc
+	ch <- rateDesc
+}
+
+func (c metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.m.snapshot()
+	ch <- prometheus.MustNewConstMetric(bytesDesc, prometheus.CounterValue, float64(s.BytesDownloaded))
+	ch <- prometheus.MustNewConstMetric(activeDownloadsDesc, prometheus.GaugeValue, float64(s.ActiveDownloads))
+	ch <- prometheus.MustNewConstMetric(activeChunksDesc, prometheus.GaugeValue, float64(s.ActiveChunks))
+	ch <- prometheus.MustNewConstMetric(retriesDesc, prometheus.CounterValue, float64(s.Retries))
+	ch <- prometheus.MustNewConstMetric(rateDesc, prometheus.GaugeValue, s.Rate)
+}
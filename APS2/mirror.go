@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Espelhos que servem o mesmo arquivo. Cada requisição de faixa usa o
+// próximo em rodízio ponderado pelo peso de cada um (a velocidade medida com
+// -probe-mirrors, ou 1), e um espelho que falha passa a ser evitado enquanto
+// houver outro com menos falhas.
+type mirrorSet struct {
+	mu       sync.Mutex
+	urls     []string
+	failures []int
+	weights  []float64
+	// Crédito acumulado de cada espelho no rodízio ponderado
+	current []float64
+}
+
+func newMirrorSet(urls []string) *mirrorSet {
+	s := &mirrorSet{
+		urls:     urls,
+		failures: make([]int, len(urls)),
+		weights:  make([]float64, len(urls)),
+		current:  make([]float64, len(urls)),
+	}
+	for i := range s.weights {
+		s.weights[i] = 1
+	}
+	return s
+}
+
+// Próximo espelho entre os que têm menos falhas. Rodízio ponderado suave:
+// cada espelho acumula o seu peso e o de maior crédito é escolhido e paga o
+// total, o que distribui as faixas na proporção dos pesos sem rajadas.
+func (s *mirrorSet) pick() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	best := s.failures[0]
+	for _, f := range s.failures {
+		best = min(best, f)
+	}
+
+	chosen := -1
+	var total float64
+	for i := range s.urls {
+		if s.failures[i] != best {
+			continue
+		}
+		s.current[i] += s.weights[i]
+		total += s.weights[i]
+		if chosen < 0 || s.current[i] > s.current[chosen] {
+			chosen = i
+		}
+	}
+	s.current[chosen] -= total
+	return s.urls[chosen]
+}
+
+// Pesos medidos por -probe-mirrors, na mesma ordem dos espelhos
+func (s *mirrorSet) setWeights(weights []float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copy(s.weights, weights)
+}
+
+func (s *mirrorSet) fail(url string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, u := range s.urls {
+		if u == url {
+			s.failures[i]++
+			if len(s.urls) > 1 {
+				slog.Warn("Espelho falhou, usando os demais", "url", url, "falhas", s.failures[i])
+			}
+			return
+		}
+	}
+}
+
+func (s *mirrorSet) logStats() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.urls) < 2 {
+		return
+	}
+	for i, u := range s.urls {
+		slog.Info("Espelho", "url", u, "falhas", s.failures[i], "peso", s.weights[i])
+	}
+}
+
+// Tamanho baixado de cada espelho na medição de -probe-mirrors
+const mirrorProbeSize = 256 * 1024
+
+// Baixa o início do arquivo de todos os espelhos ao mesmo tempo e retorna a
+// velocidade de cada um em MB/s, para usar como peso no rodízio. Um espelho
+// que falha na medição recebe um peso mínimo, sem ser descartado.
+func measureMirrors(ctx context.Context, cfg Config, urls []string, size int64) []float64 {
+	const minWeight = 0.01
+
+	end := min(int64(mirrorProbeSize), size) - 1
+	speeds := make([]float64, len(urls))
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			speed, err := measureMirror(ctx, cfg, u, end)
+			if err != nil {
+				slog.Warn("Falha medindo espelho", "url", u, "erro", err)
+				speed = minWeight
+			}
+			speeds[i] = max(speed, minWeight)
+		}()
+	}
+	wg.Wait()
+
+	for i, u := range urls {
+		slog.Info("Velocidade do espelho", "url", u, "mbps", math.Round(speeds[i]*100)/100)
+	}
+	return speeds
+}
+
+func measureMirror(ctx context.Context, cfg Config, url string, end int64) (float64, error) {
+	req, err := newRequest(ctx, cfg, "GET", url)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", end))
+
+	started := time.Now()
+	resp, err := cfg.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("resposta inesperada: %s", resp.Status)
+	}
+
+	n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, end+1))
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(started).Seconds()
+	if elapsed <= 0 {
+		elapsed = 1e-6
+	}
+	return float64(n) / (1024 * 1024) / elapsed, nil
+}
+
+// Consulta source e os espelhos de -mirror. O primeiro que responder define
+// o arquivo; os demais só são usados se servirem o mesmo arquivo (tamanho e
+// ETag) e aceitarem Range.
+func probeMirrors(ctx context.Context, cfg Config, source string) (remoteInfo, []string, error) {
+	candidates := append([]string{source}, cfg.Mirrors...)
+
+	var info remoteInfo
+	var errs []error
+	first := -1
+	for i, u := range candidates {
+		var err error
+		if info, err = getFileSizeRetry(ctx, cfg, u); err == nil {
+			first = i
+			break
+		}
+		if len(candidates) > 1 {
+			slog.Warn("Espelho não respondeu", "url", u, "erro", err)
+		}
+		errs = append(errs, err)
+	}
+	if first < 0 {
+		return remoteInfo{}, nil, errors.Join(errs...)
+	}
+	if info.NotModified {
+		return info, nil, nil
+	}
+
+	urls := []string{info.URL}
+	for _, u := range candidates[first+1:] {
+		mi, err := getFileSize(ctx, cfg, u)
+		if err == nil {
+			err = checkAllowedHost(mi.URL, cfg.AllowedHosts)
+		}
+		if err == nil {
+			err = checkSameContent(info, mi)
+		}
+		if err == nil && !mi.AcceptRanges {
+			err = errors.New("não aceita Range")
+		}
+		if err != nil {
+			slog.Warn("Espelho ignorado", "url", u, "erro", err)
+			continue
+		}
+		urls = append(urls, mi.URL)
+	}
+	if len(urls) > 1 {
+		slog.Info("Espelhos confirmados", "espelhos", len(urls))
+	}
+	return info, urls, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// A segunda execução encontra o arquivo com o tamanho e a data do servidor:
+// nada é baixado e o arquivo continua lá
+func TestOverwriteIfNewerSkipsUpToDate(t *testing.T) {
+	data := testData(5000)
+	srv := newRangeServer(t, data)
+	cfg := testConfig(t, srv.fileURL())
+	cfg.OverwriteIfNewer = true
+
+	if _, skipped, err := runDownload(context.Background(), cfg); err != nil || skipped {
+		t.Fatalf("primeira execução: skipped %v, erro %v", skipped, err)
+	}
+	fi, err := os.Stat(cfg.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.ModTime().Equal(testModified) {
+		t.Fatalf("mtime %s, esperado o Last-Modified %s", fi.ModTime(), testModified)
+	}
+	before := countRanged(srv.Requests())
+
+	size, skipped, err := runDownload(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !skipped {
+		t.Error("arquivo atualizado não foi marcado como pulado")
+	}
+	if size != int64(len(data)) {
+		t.Errorf("tamanho %d, esperado %d", size, len(data))
+	}
+	if n := countRanged(srv.Requests()) - before; n != 0 {
+		t.Errorf("%d requisições de faixa num download pulado", n)
+	}
+	checkFile(t, cfg.Output, data)
+}
+
+// Um remoto mais novo que o arquivo local é baixado de novo, sem -force
+func TestOverwriteIfNewerDownloadsNewer(t *testing.T) {
+	data := testData(5000)
+	srv := newRangeServer(t, data)
+	cfg := testConfig(t, srv.fileURL())
+	cfg.OverwriteIfNewer = true
+
+	if err := os.WriteFile(cfg.Output, make([]byte, len(data)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := testModified.Add(-time.Hour)
+	if err := os.Chtimes(cfg.Output, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	_, skipped, err := runDownload(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped {
+		t.Error("arquivo desatualizado marcado como pulado")
+	}
+	checkFile(t, cfg.Output, data)
+}
+
+// Com 304 o download é pulado sem comparar tamanho nem data, e o arquivo
+// local, mesmo diferente do remoto, não é tocado
+func TestNotModifiedSkips(t *testing.T) {
+	data := testData(5000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Modified-Since") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		serveRange(w, r, data)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(t, srv.URL+"/arquivo.bin")
+	cfg.OverwriteIfNewer = true
+	local := []byte("cópia local")
+	if err := os.WriteFile(cfg.Output, local, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	size, skipped, err := runDownload(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !skipped {
+		t.Error("304 não foi marcado como pulado")
+	}
+	if size != int64(len(local)) {
+		t.Errorf("tamanho %d, esperado o do arquivo local %d", size, len(local))
+	}
+	checkFile(t, cfg.Output, local)
+}
+
+func TestMirroring(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want bool
+	}{
+		{"sem condição", Config{}, false},
+		{"overwrite-if-newer", Config{OverwriteIfNewer: true}, true},
+		{"If-Modified-Since", Config{Header: http.Header{"If-Modified-Since": {testModified.Format(http.TimeFormat)}}}, true},
+		{"If-None-Match", Config{Header: http.Header{"If-None-Match": {testETag}}}, true},
+		{"outro cabeçalho", Config{Header: http.Header{"Authorization": {"x"}}}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.mirroring(); got != tt.want {
+			t.Errorf("%s: mirroring() = %v, esperado %v", tt.name, got, tt.want)
+		}
+	}
+}
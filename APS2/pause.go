@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// Pausa e retoma um download em andamento, para quem usa o pacote como
+// biblioteca (ex.: um gerenciador de downloads com interface). Pausado,
+// nenhum chunk lê bytes novos, mas as conexões e o estado são mantidos. Um
+// PauseControl pode ser compartilhado por vários downloads.
+type PauseControl struct {
+	mu sync.Mutex
+	// Fechado ao retomar; nil quando não está pausado
+	resumed chan struct{}
+}
+
+func NewPauseControl() *PauseControl {
+	return &PauseControl{}
+}
+
+// Pausa as leituras de todos os chunks. Uma leitura já em andamento termina
+// antes de parar.
+func (p *PauseControl) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resumed == nil {
+		p.resumed = make(chan struct{})
+	}
+}
+
+// Retoma as leituras pausadas
+func (p *PauseControl) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resumed != nil {
+		close(p.resumed)
+		p.resumed = nil
+	}
+}
+
+func (p *PauseControl) Paused() bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.resumed != nil
+}
+
+// Bloqueia enquanto estiver pausado, ou até o contexto ser cancelado
+func (p *PauseControl) wait(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	resumed := p.resumed
+	p.mu.Unlock()
+	if resumed == nil {
+		return nil
+	}
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Leitor que para antes de cada leitura enquanto o download está pausado
+type pausableReader struct {
+	ctx   context.Context
+	r     io.Reader
+	pause *PauseControl
+}
+
+func (r *pausableReader) Read(p []byte) (int, error) {
+	if err := r.pause.wait(r.ctx); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
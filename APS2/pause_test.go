@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type downloadResult struct {
+	size int64
+	err  error
+}
+
+func startDownload(cfg Config) <-chan downloadResult {
+	done := make(chan downloadResult, 1)
+	go func() {
+		size, _, err := runDownload(context.Background(), cfg)
+		done <- downloadResult{size, err}
+	}()
+	return done
+}
+
+// Pausado, nenhum byte é lido; uma pausa mais longa que o -request-timeout
+// não derruba as requisições, que continuam ao retomar sem novas tentativas
+func TestPauseLongerThanRequestTimeout(t *testing.T) {
+	data := testData(1 << 20)
+	srv := newRangeServer(t, data)
+	cfg := testConfig(t, srv.fileURL())
+	cfg.RequestTimeout = 100 * time.Millisecond
+	cfg.Usage = NewDataUsage(0)
+	cfg.Pause = NewPauseControl()
+	cfg.Pause.Pause()
+
+	done := startDownload(cfg)
+	time.Sleep(4 * cfg.RequestTimeout)
+	select {
+	case r := <-done:
+		t.Fatalf("download terminou pausado: %v", r.err)
+	default:
+	}
+	if used := cfg.Usage.Used(); used != 0 {
+		t.Fatalf("%d bytes lidos com o download pausado", used)
+	}
+
+	cfg.Pause.Resume()
+	r := <-done
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	checkFile(t, cfg.Output, data)
+	if n := countRanged(srv.Requests()); n != int(cfg.Threads) {
+		t.Errorf("%d requisições de faixa, esperadas %d: a pausa gerou novas tentativas", n, cfg.Threads)
+	}
+}
+
+// Sem pausa o -request-timeout continua valendo para as faixas: uma
+// resposta que para no meio é cortada e o chunk continua de onde parou
+func TestRequestTimeoutExpires(t *testing.T) {
+	data := testData(10000)
+	var mu sync.Mutex
+	seen := map[string]int{}
+	// Último byte das faixas que já pararam uma vez: a nova tentativa
+	// continua a faixa e recebe a resposta inteira
+	stalled := map[string]bool{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rng := r.Header.Get("Range")
+		_, last, _ := strings.Cut(rng, "-")
+		mu.Lock()
+		seen[rng]++
+		first := !stalled[last]
+		stalled[last] = true
+		mu.Unlock()
+		if r.Method != http.MethodGet || rng == "" || !first {
+			serveRange(w, r, data)
+			return
+		}
+
+		start, end, _ := requestedRange(rng, int64(len(data)))
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[start : start+100])
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(t, srv.URL+"/arquivo.bin")
+	cfg.RequestTimeout = 100 * time.Millisecond
+	began := time.Now()
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+	if elapsed := time.Since(began); elapsed >= 5*time.Second {
+		t.Errorf("download levou %s: o tempo limite não cortou as respostas paradas", elapsed)
+	}
+	for _, c := range faultChunks {
+		retry := fmt.Sprintf("bytes=%d-%d", c[0]+100, c[1])
+		if seen[retry] != 1 {
+			t.Errorf("faixa %s pedida %d vezes, esperada 1", retry, seen[retry])
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"log/slog"
+	"strconv"
+	"sync"
+)
+
+// Limites do servidor inferidos durante o download: tamanho máximo de faixa
+// e número de conexões simultâneas. Zero significa sem limite conhecido.
+type serverPolicy struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	maxRange  int64
+	maxConns  int
+	active    int
+	throttled int
+}
+
+// Cabeçalhos não padronizados usados por alguns servidores para anunciar
+// os limites aceitos
+const (
+	headerMaxRange = "X-Max-Range-Size"
+	headerMaxConns = "X-Max-Connections"
+)
+
+func newServerPolicy(info remoteInfo) *serverPolicy {
+	p := &serverPolicy{}
+	p.cond = sync.NewCond(&p.mu)
+
+	if v, err := strconv.ParseInt(info.Header.Get(headerMaxRange), 10, 64); err == nil && v > 0 {
+		p.maxRange = v
+	}
+	if v, err := strconv.Atoi(info.Header.Get(headerMaxConns)); err == nil && v > 0 {
+		p.maxConns = v
+	}
+	return p
+}
+
+func (p *serverPolicy) maxRangeSize() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.maxRange
+}
+
+// Aguarda até haver uma conexão livre dentro do limite do servidor
+func (p *serverPolicy) acquire() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for p.maxConns > 0 && p.active >= p.maxConns {
+		p.cond.Wait()
+	}
+	p.active++
+}
+
+func (p *serverPolicy) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.active--
+	p.cond.Broadcast()
+}
+
+// O servidor entregou uma faixa menor do que a pedida
+func (p *serverPolicy) observeRangeLimit(size int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.maxRange == 0 || size < p.maxRange {
+		p.maxRange = size
+		slog.Info("Servidor limita o tamanho das faixas", "bytes", size)
+	}
+}
+
+// Um 416 para uma faixa válida indica que ela é grande demais: as próximas
+// requisições usam metade do tamanho
+func (p *serverPolicy) observeRangeRejected(size int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	half := size / 2
+	if half < 1 {
+		return
+	}
+	if p.maxRange == 0 || half < p.maxRange {
+		p.maxRange = half
+		slog.Warn("Servidor recusou a faixa, reduzindo", "bytes", size, "novo", half)
+	}
+}
+
+// 429 repetidos indicam conexões demais: reduz o limite para uma a menos
+// do que as ativas no momento
+func (p *serverPolicy) observeThrottle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.throttled++
+	if p.throttled < 2 {
+		return
+	}
+
+	limit := p.active - 1
+	if p.maxConns > 0 && limit >= p.maxConns {
+		limit = p.maxConns - 1
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	if p.maxConns == 0 || limit < p.maxConns {
+		p.maxConns = limit
+		slog.Warn("Servidor limitando requisições, reduzindo conexões simultâneas", "conexoes", limit)
+	}
+}
+
+func (p *serverPolicy) logLimits() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.maxRange == 0 && p.maxConns == 0 {
+		return
+	}
+	slog.Info("Limites do servidor (0 = sem limite)", "faixaMaxima", p.maxRange, "conexoesMaximas", p.maxConns)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Servidor com limite de faixa e de conexões, que registra o tamanho de
+// cada faixa pedida e o pico de requisições simultâneas
+type policyServer struct {
+	*httptest.Server
+	data []byte
+
+	mu     sync.Mutex
+	sizes  []int64
+	active int
+	peak   int
+}
+
+func newPolicyServer(t *testing.T, data []byte, handle func(w http.ResponseWriter, r *http.Request, size int64) bool) *policyServer {
+	s := &policyServer{data: data}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start, end, ranged := requestedRange(r.Header.Get("Range"), int64(len(data)))
+		if ranged && r.Method == http.MethodGet {
+			s.mu.Lock()
+			s.sizes = append(s.sizes, end-start+1)
+			s.active++
+			s.peak = max(s.peak, s.active)
+			s.mu.Unlock()
+			defer func() {
+				s.mu.Lock()
+				s.active--
+				s.mu.Unlock()
+			}()
+			time.Sleep(5 * time.Millisecond)
+			if handle != nil && handle(w, r, end-start+1) {
+				return
+			}
+		}
+		if handle != nil && r.Method == http.MethodHead {
+			handle(w, r, 0)
+		}
+		serveRange(w, r, data)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Faixas pedidas com mais de limit bytes
+func (s *policyServer) over(limit int64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, size := range s.sizes {
+		if size > limit {
+			n++
+		}
+	}
+	return n
+}
+
+// Um servidor que entrega no máximo 1000 bytes por resposta: depois da
+// primeira faixa cortada as seguintes já são pedidas com esse tamanho
+func TestPolicyShortRanges(t *testing.T) {
+	const limit = 1000
+	data := testData(10000)
+	srv := newPolicyServer(t, data, func(w http.ResponseWriter, r *http.Request, size int64) bool {
+		if size <= limit {
+			return false
+		}
+		// Responde só o começo da faixa pedida
+		start, _, _ := requestedRange(r.Header.Get("Range"), int64(len(data)))
+		r.Header.Set("Range", "bytes="+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(start+limit-1, 10))
+		return false
+	})
+	cfg := testConfig(t, srv.URL+"/arquivo.bin")
+
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+	// Só as primeiras faixas, pedidas antes de o limite ser conhecido
+	if n := srv.over(limit); n > int(cfg.Threads) {
+		t.Errorf("%d faixas acima de %d bytes depois de o limite ser observado", n-int(cfg.Threads), limit)
+	}
+}
+
+// Limites anunciados no HEAD valem desde a primeira faixa
+func TestPolicyHeaders(t *testing.T) {
+	data := testData(10000)
+	srv := newPolicyServer(t, data, func(w http.ResponseWriter, r *http.Request, size int64) bool {
+		if r.Method == http.MethodHead {
+			w.Header().Set(headerMaxRange, "1000")
+			w.Header().Set(headerMaxConns, "1")
+		}
+		return false
+	})
+	cfg := testConfig(t, srv.URL+"/arquivo.bin")
+
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+	if n := srv.over(1000); n > 0 {
+		t.Errorf("%d faixas acima do %s anunciado", n, headerMaxRange)
+	}
+	srv.mu.Lock()
+	peak := srv.peak
+	srv.mu.Unlock()
+	if peak > 1 {
+		t.Errorf("%d faixas simultâneas com %s: 1", peak, headerMaxConns)
+	}
+}
+
+// Um 416 para uma faixa válida reduz o tamanho das faixas pela metade até
+// o servidor aceitar
+func TestPolicyRejectedRanges(t *testing.T) {
+	const limit = 1500
+	data := testData(10000)
+	srv := newPolicyServer(t, data, func(w http.ResponseWriter, r *http.Request, size int64) bool {
+		if size <= limit {
+			return false
+		}
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return true
+	})
+	cfg := testConfig(t, srv.URL+"/arquivo.bin")
+
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+	if n := srv.over(limit); n > int(cfg.Threads) {
+		t.Errorf("%d faixas recusadas, esperadas só as %d primeiras", n, cfg.Threads)
+	}
+}
+
+// 429 repetidos reduzem as conexões simultâneas até o servidor parar de
+// recusar
+func TestPolicyThrottle(t *testing.T) {
+	const conns = 2
+	data := testData(10000)
+	var mu sync.Mutex
+	active, throttled := 0, 0
+	srv := newPolicyServer(t, data, func(w http.ResponseWriter, r *http.Request, size int64) bool {
+		mu.Lock()
+		active++
+		busy := active > conns
+		if busy {
+			throttled++
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			active--
+			mu.Unlock()
+		}()
+		if busy {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+		return false
+	})
+	cfg := testConfig(t, srv.URL+"/arquivo.bin")
+	cfg.MinChunk = 1000
+
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+	// Sem reduzir as conexões, cada nova tentativa imediata volta a
+	// encontrar o servidor ocupado
+	if throttled > int(cfg.Threads) {
+		t.Errorf("%d respostas 429 para %d chunks: as conexões não foram reduzidas", throttled, cfg.Threads)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import "sync"
+
+// Limita quantos arquivos são baixados ao mesmo tempo com -input e
+// -manifest. Cada arquivo continua com suas próprias threads; o limite só
+// evita que dezenas de downloads abram centenas de conexões juntos.
+type filePool struct {
+	slots chan struct{}
+	wg    sync.WaitGroup
+}
+
+func newFilePool(max int) *filePool {
+	if max < 1 {
+		max = 1
+	}
+	return &filePool{slots: make(chan struct{}, max)}
+}
+
+// Espera uma vaga e executa fn em uma goroutine
+func (p *filePool) Go(fn func()) {
+	p.slots <- struct{}{}
+	p.wg.Add(1)
+	go func() {
+		defer func() {
+			<-p.slots
+			p.wg.Done()
+		}()
+		fn()
+	}()
+}
+
+func (p *filePool) Wait() {
+	p.wg.Wait()
+}
@@ -0,0 +1,22 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"syscall"
+)
+
+// Reserva os blocos do arquivo de verdade com fallocate, para que falta de
+// espaço apareça agora e não no meio do download. Sistemas de arquivos sem
+// suporte caem no Truncate.
+func preallocate(f *os.File, size int64) error {
+	err := syscall.Fallocate(int(f.Fd()), 0, 0, size)
+	if errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.ENOSYS) {
+		slog.Debug("fallocate não suportado neste sistema de arquivos, usando Truncate")
+		return f.Truncate(size)
+	}
+	return err
+}
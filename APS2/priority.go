@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Com -priority o arquivo é dividido em mais chunks do que threads, para que
+// as faixas prioritárias sejam baixadas antes do restante
+const priorityChunksPerThread = 8
+
+// Peso de uma faixa de bytes: faixas com peso maior são baixadas primeiro.
+// Faixas sem peso informado têm peso zero.
+type rangePriority struct {
+	Start  int64
+	End    int64
+	Weight int
+}
+
+// Chunks ainda não baixados, na fila dos workers: count chunks seguidos a
+// partir de index, pedidos como uma faixa só
+type chunkJob struct {
+	index int64
+	count int64
+	start int64
+	end   int64
+}
+
+// Peso de um chunk: o maior peso entre as faixas que ele toca
+func chunkWeight(priorities []rangePriority, start, end int64) int {
+	weight := 0
+	for _, p := range priorities {
+		if p.Start <= end && p.End >= start && p.Weight > weight {
+			weight = p.Weight
+		}
+	}
+	return weight
+}
+
+// Ordena os chunks pelo peso, do maior para o menor; com o mesmo peso
+// mantém a ordem do arquivo
+func prioritizeChunks(jobs []chunkJob, priorities []rangePriority) {
+	slices.SortStableFunc(jobs, func(a, b chunkJob) int {
+		return chunkWeight(priorities, b.start, b.end) - chunkWeight(priorities, a.start, a.end)
+	})
+}
+
+// Flag -priority repetível no formato "inicio-fim=peso"
+type priorityFlag []rangePriority
+
+func (f *priorityFlag) String() string {
+	return ""
+}
+
+func (f *priorityFlag) Set(value string) error {
+	spec, weightStr, ok1 := strings.Cut(value, "=")
+	startStr, endStr, ok2 := strings.Cut(spec, "-")
+	start, err1 := strconv.ParseInt(strings.TrimSpace(startStr), 10, 64)
+	end, err2 := strconv.ParseInt(strings.TrimSpace(endStr), 10, 64)
+	weight, err3 := strconv.Atoi(strings.TrimSpace(weightStr))
+	if !ok1 || !ok2 || err1 != nil || err2 != nil || err3 != nil || start < 0 || end < start {
+		return fmt.Errorf("prioridade inválida %q, use inicio-fim=peso", value)
+	}
+	*f = append(*f, rangePriority{Start: start, End: end, Weight: weight})
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestPriorityFlag(t *testing.T) {
+	var f priorityFlag
+	for _, v := range []string{"0-1023=10", " 2048 - 4095 = 5"} {
+		if err := f.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := priorityFlag{{0, 1023, 10}, {2048, 4095, 5}}
+	if !slices.Equal(f, want) {
+		t.Errorf("prioridades %v, esperado %v", f, want)
+	}
+	for _, v := range []string{"0-1023", "1023=5", "10-5=1", "-1-5=1", "0-10=x"} {
+		if err := f.Set(v); err == nil {
+			t.Errorf("-priority %q aceito", v)
+		}
+	}
+}
+
+func TestPrioritizeChunks(t *testing.T) {
+	priorities := []rangePriority{
+		{Start: 300, End: 350, Weight: 10},
+		{Start: 150, End: 199, Weight: 5},
+		// Sobreposta com a de peso 10: vale o maior peso
+		{Start: 340, End: 399, Weight: 1},
+	}
+	var jobs []chunkJob
+	for i := range int64(5) {
+		jobs = append(jobs, chunkJob{index: i, count: 1, start: i * 100, end: i*100 + 99})
+	}
+	prioritizeChunks(jobs, priorities)
+
+	var order []int64
+	for _, j := range jobs {
+		order = append(order, j.index)
+	}
+	// Mesmo peso mantém a ordem do arquivo
+	if want := []int64{3, 1, 0, 2, 4}; !slices.Equal(order, want) {
+		t.Errorf("ordem %v, esperada %v", order, want)
+	}
+}
+
+// As faixas com peso são pedidas antes do resto do arquivo, da mais pesada
+// para a mais leve; o restante segue a ordem do arquivo
+func TestPriorityDownload(t *testing.T) {
+	data := testData(10000)
+	srv := newRangeServer(t, data)
+	cfg := testConfig(t, srv.fileURL())
+	// Uma thread só, para a ordem dos pedidos ser a da fila: 8 chunks de
+	// 1250 bytes
+	cfg.Threads = 1
+	cfg.Priorities = []rangePriority{
+		{Start: 7500, End: 9999, Weight: 10},
+		{Start: 2500, End: 3000, Weight: 5},
+	}
+
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+
+	var ranges []string
+	for _, r := range srv.Requests() {
+		if countRanged([]string{r}) == 1 {
+			ranges = append(ranges, r)
+		}
+	}
+	want := []string{
+		"GET 7500-8749", "GET 8750-9999", "GET 2500-3749",
+		"GET 0-1249", "GET 1250-2499", "GET 3750-4999", "GET 5000-6249", "GET 6250-7499",
+	}
+	if !slices.Equal(ranges, want) {
+		t.Errorf("faixas pedidas %q, esperadas %q", ranges, want)
+	}
+}
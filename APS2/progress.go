@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	statusRunning = "running"
+	statusFailed  = "failed"
+	// Um download em andamento que parou de atualizar o status: a execução
+	// foi morta sem chegar a gravar o estado final
+	statusStale = "stale"
+)
+
+// Intervalo entre as gravações do status. Sem atualização por
+// staleIntervals intervalos o download é considerado abandonado.
+const (
+	statusInterval = time.Second
+	staleIntervals = 5
+)
+
+// Progresso de um download, gravado periodicamente em <destino>.status para
+// que outra execução (-status) possa consultá-lo
+type downloadStatus struct {
+	URL          string    `json:"url"`
+	Output       string    `json:"output"`
+	State        string    `json:"state"`
+	Error        string    `json:"error,omitempty"`
+	TotalBytes   int64     `json:"totalBytes"`
+	BytesDone    int64     `json:"bytesDone"`
+	Percent      float64   `json:"percent"`
+	Speed        float64   `json:"speed"`
+	ETA          float64   `json:"eta"`
+	ActiveChunks int32     `json:"activeChunks"`
+	StartedAt    time.Time `json:"startedAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+func statusPath(fileName string) string {
+	return fileName + ".status"
+}
+
+// Estado do download como visto em now: running sem atualização recente
+// vira stale
+func (s downloadStatus) stateAt(now time.Time) string {
+	if s.State == statusRunning && now.Sub(s.UpdatedAt) > staleIntervals*statusInterval {
+		return statusStale
+	}
+	return s.State
+}
+
+type progressReporter struct {
+	d       *download
+	total   int64
+	initial int64
+	started time.Time
+	path    string
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// Começa a gravar o progresso a cada statusInterval. initial são os bytes já
+// baixados em uma execução anterior, que não contam para a velocidade.
+func startProgress(d *download, total, initial int64) *progressReporter {
+	p := &progressReporter{
+		d:       d,
+		total:   total,
+		initial: initial,
+		started: time.Now(),
+		path:    statusPath(d.cfg.Output),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if d.cfg.Sink != nil {
+		// Sem arquivo local não há .status; -status não acompanha o download
+		p.path = ""
+	}
+	d.written.Store(initial)
+
+	go func() {
+		defer close(p.stopped)
+		ticker := time.NewTicker(statusInterval)
+		defer ticker.Stop()
+
+		p.write(statusRunning, nil)
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				p.write(statusRunning, nil)
+				d.cfg.Events.emit(d.event(eventProgress, p.started))
+				d.cfg.Hooks.progress(d.written.Load(), total)
+			}
+		}
+	}()
+	return p
+}
+
+func (p *progressReporter) snapshot(state string, err error) downloadStatus {
+	now := time.Now()
+	done := p.d.written.Load()
+
+	s := downloadStatus{
+		URL:          p.d.cfg.URL,
+		Output:       p.d.cfg.Output,
+		State:        state,
+		TotalBytes:   p.total,
+		BytesDone:    done,
+		ActiveChunks: p.d.active.Load(),
+		StartedAt:    p.started,
+		UpdatedAt:    now,
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	if p.total > 0 {
+		s.Percent = float64(done) * 100 / float64(p.total)
+	}
+	if elapsed := now.Sub(p.started).Seconds(); elapsed > 0 {
+		s.Speed = float64(done-p.initial) / elapsed
+	}
+	if s.Speed > 0 && p.total > 0 {
+		s.ETA = float64(p.total-done) / s.Speed
+	}
+	return s
+}
+
+func (p *progressReporter) write(state string, err error) {
+	if p.path == "" {
+		return
+	}
+	data, jerr := json.Marshal(p.snapshot(state, err))
+	if jerr != nil {
+		return
+	}
+	writeStatusFile(p.path, data)
+}
+
+// Grava o status por um temporário de nome único e o renomeia, para que
+// quem lê nunca veja um JSON pela metade, mesmo com duas execuções
+// gravando o mesmo arquivo
+func writeStatusFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Encerra o relatório; em caso de sucesso o arquivo de status é removido
+func (p *progressReporter) stop(err error) {
+	close(p.done)
+	<-p.stopped
+	p.d.cfg.Hooks.progress(p.d.written.Load(), p.total)
+
+	if err != nil {
+		p.write(statusFailed, err)
+		return
+	}
+	if p.path != "" {
+		os.Remove(p.path)
+	}
+}
+
+// Consulta o progresso de um download iniciado por outra execução
+func printStatus(fileName string) error {
+	data, err := os.ReadFile(statusPath(fileName))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("nenhum download em andamento para %s", fileName)
+	}
+	if err != nil {
+		return err
+	}
+
+	var s downloadStatus
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	fmt.Printf("Arquivo:  %s\n", s.Output)
+	fmt.Printf("URL:      %s\n", s.URL)
+	state := s.stateAt(time.Now())
+	if state == statusStale {
+		fmt.Printf("Estado:   %s (sem atualização desde %s; a execução provavelmente foi interrompida)\n", state, s.UpdatedAt.Format(time.RFC3339))
+	} else {
+		fmt.Printf("Estado:   %s\n", state)
+	}
+	if s.Error != "" {
+		fmt.Printf("Erro:     %s\n", s.Error)
+	}
+	fmt.Printf("Progresso: %.1f%% (%d de %d bytes)\n", s.Percent, s.BytesDone, s.TotalBytes)
+	fmt.Printf("Velocidade: %.2f MB/s, restante: %s\n", s.Speed/1024/1024, time.Duration(s.ETA*float64(time.Second)).Round(time.Second))
+	fmt.Printf("Chunks ativos: %d\n", s.ActiveChunks)
+	fmt.Printf("Atualizado em: %s\n", s.UpdatedAt.Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStatusStale(t *testing.T) {
+	now := time.Now()
+	limit := staleIntervals * statusInterval
+	tests := []struct {
+		state   string
+		updated time.Time
+		want    string
+	}{
+		{statusRunning, now, statusRunning},
+		{statusRunning, now.Add(-limit), statusRunning},
+		{statusRunning, now.Add(-limit - time.Second), statusStale},
+		// Um estado final não envelhece
+		{statusFailed, now.Add(-time.Hour), statusFailed},
+	}
+	for _, tt := range tests {
+		s := downloadStatus{State: tt.state, UpdatedAt: tt.updated}
+		if got := s.stateAt(now); got != tt.want {
+			t.Errorf("%s atualizado há %s: estado %s, esperado %s", tt.state, now.Sub(tt.updated), got, tt.want)
+		}
+	}
+}
+
+// Duas execuções gravando o mesmo .status nunca deixam um JSON pela metade
+// nem temporários para trás
+func TestStatusConcurrentWrites(t *testing.T) {
+	dir := t.TempDir()
+	path := statusPath(filepath.Join(dir, "arquivo.bin"))
+
+	const writers, writes = 4, 50
+	payloads := make([][]byte, writers)
+	for i := range payloads {
+		// Tamanhos diferentes: um temporário compartilhado misturaria o
+		// começo de um com o fim de outro
+		s := downloadStatus{URL: fmt.Sprintf("http://servidor/%d/%s", i, bytes.Repeat([]byte{'x'}, 100000*(i+1))), State: statusRunning}
+		payloads[i], _ = json.Marshal(s)
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(readErr)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			data, err := os.ReadFile(path)
+			if os.IsNotExist(err) {
+				continue
+			}
+			var s downloadStatus
+			if err == nil {
+				err = json.Unmarshal(data, &s)
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range writes {
+				if err := writeStatusFile(path, payloads[i]); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	if err := <-readErr; err != nil {
+		t.Fatalf("status lido durante as gravações: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.ContainsFunc(payloads, func(p []byte) bool { return bytes.Equal(p, data) }) {
+		t.Error("status final não é nenhuma das gravações")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("%d arquivos no diretório, esperado só o .status", len(entries))
+	}
+}
+
+// Um download cancelado (Ctrl+C) grava failed no lugar de running
+func TestStatusFailedOnCancel(t *testing.T) {
+	srv := newRangeServer(t, testData(1<<20))
+	cfg := testConfig(t, srv.fileURL())
+	cfg.Pause = NewPauseControl()
+	cfg.Pause.Pause()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := runDownload(ctx, cfg)
+		done <- err
+	}()
+
+	readStatus := func() downloadStatus {
+		var s downloadStatus
+		if data, err := os.ReadFile(statusPath(cfg.Output)); err == nil {
+			json.Unmarshal(data, &s)
+		}
+		return s
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for readStatus().State != statusRunning {
+		if time.Now().After(deadline) {
+			t.Fatal("status running não foi gravado")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err == nil {
+		t.Fatal("download cancelado terminou sem erro")
+	}
+	if s := readStatus(); s.State != statusFailed || s.Error == "" {
+		t.Errorf("status depois do cancelamento: %s (erro %q), esperado failed", s.State, s.Error)
+	}
+}
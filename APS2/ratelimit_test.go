@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Sem limite no momento a leitura não é fatiada em rateLimitChunk
+func TestRateLimitedReaderUnlimited(t *testing.T) {
+	data := testData(4 * rateLimitChunk)
+	r := &rateLimitedReader{r: bytes.NewReader(data), rl: NewRateLimiter(0)}
+	n, err := r.Read(make([]byte, len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(data) {
+		t.Errorf("leitura de %d bytes sem limite, esperada %d", n, len(data))
+	}
+
+	r.rl.SetRate(1024 * 1024)
+	r.r = bytes.NewReader(data)
+	if n, _ := r.Read(make([]byte, len(data))); n != rateLimitChunk {
+		t.Errorf("leitura de %d bytes com limite, esperada %d", n, rateLimitChunk)
+	}
+}
+
+// SetRate no meio do download vale na hora para os chunks em andamento
+func TestSetRateMidDownload(t *testing.T) {
+	const (
+		rate  = 256 * 1024
+		burst = 32 * 1024
+	)
+	data := testData(8 << 20)
+	srv := newRangeServer(t, data)
+	cfg := testConfig(t, srv.fileURL())
+	cfg.Usage = NewDataUsage(0)
+	cfg.RateLimiter = NewRateLimiterBurst(rate, burst)
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := runDownload(context.Background(), cfg)
+		done <- err
+	}()
+
+	// Com 256KB/s o arquivo levaria 32s; em meio segundo passam a rajada,
+	// a taxa e no máximo uma leitura a mais por chunk
+	const window = 500 * time.Millisecond
+	time.Sleep(window)
+	limit := burst + rate*int64(window/time.Millisecond)/1000 + cfg.Threads*rateLimitChunk
+	if used := cfg.Usage.Used(); used > limit*3/2 {
+		t.Fatalf("%d bytes em %s com limite de %d B/s, esperado no máximo ~%d", used, window, rate, limit)
+	}
+
+	cfg.RateLimiter.SetRate(0)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("download não terminou depois de remover o limite (%d de %d bytes)", cfg.Usage.Used(), len(data))
+	}
+	checkFile(t, cfg.Output, data)
+}
+
+// Dois downloads simultâneos com o mesmo limitador somam no máximo a taxa
+// dele, como os arquivos de -input e -manifest
+func TestSharedRateLimit(t *testing.T) {
+	const (
+		rate  = 1024 * 1024
+		burst = 64 * 1024
+		size  = 512 * 1024
+	)
+	rl := NewRateLimiterBurst(rate, burst)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range 2 {
+		data := testData(size)
+		srv := newRangeServer(t, data)
+		cfg := testConfig(t, srv.fileURL())
+		cfg.RateLimiter = rl
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := runDownload(context.Background(), cfg); err != nil {
+				t.Error(err)
+				return
+			}
+			checkFile(t, cfg.Output, data)
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	// Cada um sozinho levaria meio segundo; juntos, o total passa pela
+	// mesma taxa
+	total := int64(2 * size)
+	if minimum := time.Duration(total-burst) * time.Second / rate; elapsed < minimum*9/10 {
+		t.Errorf("%d bytes em %s: %.0f B/s somados, acima do limite de %d B/s", total, elapsed, float64(total)/elapsed.Seconds(), rate)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Padrão de -max-redirects, o mesmo limite do cliente padrão do Go
+const defaultMaxRedirects = 10
+
+// Política de redirecionamento do cliente: registra cada salto em debug,
+// limita a quantidade e recusa loops. Num salto para outro host as
+// credenciais são removidas ou, com -same-host-redirects, o salto é recusado.
+func redirectPolicy(cfg Config) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		prev := via[len(via)-1]
+		status := ""
+		if req.Response != nil {
+			status = req.Response.Status
+		}
+		slog.Debug("Redirecionamento", "de", prev.URL.Redacted(), "para", req.URL.Redacted(), "status", status, "salto", len(via))
+
+		if cfg.MaxRedirects <= 0 {
+			return fmt.Errorf("redirecionamento para %s não permitido (-max-redirects 0)", req.URL.Redacted())
+		}
+		if len(via) > cfg.MaxRedirects {
+			return fmt.Errorf("mais de %d redirecionamentos (-max-redirects)", cfg.MaxRedirects)
+		}
+
+		for _, r := range via {
+			if r.URL.String() == req.URL.String() {
+				return errors.New("loop de redirecionamento: " + redirectChain(via, req))
+			}
+		}
+
+		if !strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+			if cfg.SameHostRedirects {
+				return fmt.Errorf("redirecionamento para outro host não permitido (-same-host-redirects): %s", redirectChain(via, req))
+			}
+			stripCredentials(req, cfg)
+		}
+		return nil
+	}
+}
+
+// Remove as credenciais de um salto para outro host. O Go já tira o
+// Authorization e os cookies, mas só quando o destino não é subdomínio da
+// origem, e copia os cabeçalhos de -header, que podem levar um token.
+func stripCredentials(req *http.Request, cfg Config) {
+	removed := []string{}
+	for _, key := range []string{"Authorization", "Proxy-Authorization", "Cookie"} {
+		if req.Header.Get(key) != "" {
+			req.Header.Del(key)
+			removed = append(removed, key)
+		}
+	}
+	for key := range cfg.Header {
+		switch key = http.CanonicalHeaderKey(key); key {
+		case "User-Agent", "Range", "Host":
+			continue
+		}
+		if req.Header.Get(key) != "" {
+			req.Header.Del(key)
+			removed = append(removed, key)
+		}
+	}
+	if len(removed) > 0 {
+		slog.Debug("Cabeçalhos removidos no redirecionamento para outro host", "host", req.URL.Host, "cabecalhos", removed)
+	}
+}
+
+// Depois de um redirecionamento para outro host, as faixas e sondagens vão
+// direto à URL final; com redirectedHost definido, newRequest tira delas as
+// mesmas credenciais que stripCredentials tira do salto.
+func (c Config) redirectedFrom(requested, final string) Config {
+	from, err := url.Parse(requested)
+	if err != nil {
+		return c
+	}
+	to, err := url.Parse(final)
+	if err != nil || from.Host == "" || strings.EqualFold(from.Host, to.Host) {
+		return c
+	}
+	c.redirectedHost = to.Host
+	return c
+}
+
+// Sequência de URLs de um redirecionamento, para as mensagens de erro
+func redirectChain(via []*http.Request, next *http.Request) string {
+	urls := make([]string, 0, len(via)+1)
+	for _, r := range via {
+		urls = append(urls, r.URL.Redacted())
+	}
+	return strings.Join(append(urls, next.URL.Redacted()), " -> ")
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Servidor com o arquivo em /arquivo.bin, redirecionamentos encadeados em
+// /r/N (N saltos até o arquivo) e um loop entre /a e /b
+func newRedirectServer(t *testing.T, data []byte) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case r.URL.Path == "/b":
+			http.Redirect(w, r, "/a", http.StatusFound)
+		case strings.HasPrefix(r.URL.Path, "/r/"):
+			n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/r/"))
+			next := "/arquivo.bin"
+			if n > 1 {
+				next = fmt.Sprintf("/r/%d", n-1)
+			}
+			http.Redirect(w, r, next, http.StatusFound)
+		default:
+			serveRange(w, r, data)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), paths...)
+	}
+}
+
+// Só a consulta de tamanho, sem novas tentativas: os erros de
+// redirecionamento aparecem nela
+func redirectConfig(t *testing.T, url string) Config {
+	cfg := testConfig(t, url)
+	cfg.MaxRedirects = defaultMaxRedirects
+	cfg.ProbeAttempts = 1
+	cfg.Client = newHTTPClient(cfg)
+	return cfg
+}
+
+func TestMaxRedirects(t *testing.T) {
+	data := testData(10000)
+	srv, _ := newRedirectServer(t, data)
+	tests := []struct {
+		hops, max int
+		err       string
+	}{
+		{3, 3, ""},
+		{4, 3, "mais de 3 redirecionamentos"},
+		{1, 0, "-max-redirects 0"},
+		{defaultMaxRedirects, defaultMaxRedirects, ""},
+	}
+	for _, tt := range tests {
+		cfg := redirectConfig(t, fmt.Sprintf("%s/r/%d", srv.URL, tt.hops))
+		cfg.MaxRedirects = tt.max
+		cfg.Client = newHTTPClient(cfg)
+
+		_, _, err := runDownload(context.Background(), cfg)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%d saltos com -max-redirects %d: %v", tt.hops, tt.max, err)
+				continue
+			}
+			checkFile(t, cfg.Output, data)
+		} else if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%d saltos com -max-redirects %d: erro %v, esperado %q", tt.hops, tt.max, err, tt.err)
+		}
+	}
+}
+
+// Um loop falha assim que volta a uma URL visitada, sem esperar o limite
+func TestRedirectLoop(t *testing.T) {
+	srv, paths := newRedirectServer(t, nil)
+	cfg := redirectConfig(t, srv.URL+"/a")
+
+	_, _, err := runDownload(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "loop de redirecionamento") {
+		t.Fatalf("erro %v, esperado loop de redirecionamento", err)
+	}
+	if !strings.Contains(err.Error(), "/a -> "+srv.URL+"/b -> "+srv.URL+"/a") {
+		t.Errorf("erro %q sem a sequência de URLs", err)
+	}
+	// HEAD e GET de sondagem, cada um passando por /a e /b
+	if n := len(paths()); n > 4 {
+		t.Errorf("%d requisições no loop, esperadas no máximo 4", n)
+	}
+}
+
+// Com -same-host-redirects um salto para outro host é recusado antes de
+// qualquer requisição a ele; no mesmo host o redirecionamento é seguido
+func TestSameHostRedirects(t *testing.T) {
+	data := testData(10000)
+	target, targetPaths := newRedirectServer(t, data)
+	origin := httptest.NewServer(http.RedirectHandler(target.URL+"/arquivo.bin", http.StatusFound))
+	defer origin.Close()
+
+	cfg := redirectConfig(t, origin.URL+"/arquivo.bin")
+	cfg.SameHostRedirects = true
+	cfg.Client = newHTTPClient(cfg)
+	_, _, err := runDownload(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "outro host não permitido") {
+		t.Fatalf("erro %v, esperado redirecionamento para outro host recusado", err)
+	}
+	if n := len(targetPaths()); n != 0 {
+		t.Errorf("%d requisições ao host recusado", n)
+	}
+
+	cfg = redirectConfig(t, target.URL+"/r/2")
+	cfg.SameHostRedirects = true
+	cfg.Client = newHTTPClient(cfg)
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+}
+
+// Cabeçalhos de uma requisição recebida pelo servidor de credenciais
+type credRequest struct {
+	host, path, auth, cookie, token, agent string
+}
+
+// Um único servidor atendendo origem.test e cdn.origem.test: o cliente
+// conecta ao servidor qualquer que seja o host, e /inicio redireciona para
+// o destino informado. O Go manteria as credenciais no subdomínio.
+func newCredentialServer(t *testing.T, data []byte, target string) (*httptest.Server, func() []credRequest) {
+	var mu sync.Mutex
+	var reqs []credRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		reqs = append(reqs, credRequest{
+			host:   r.Host,
+			path:   r.URL.Path,
+			auth:   r.Header.Get("Authorization"),
+			cookie: r.Header.Get("Cookie"),
+			token:  r.Header.Get("X-Token"),
+			agent:  r.Header.Get("User-Agent"),
+		})
+		mu.Unlock()
+		if r.URL.Path == "/inicio" {
+			http.Redirect(w, r, target, http.StatusFound)
+			return
+		}
+		serveRange(w, r, data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []credRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]credRequest(nil), reqs...)
+	}
+}
+
+func credentialConfig(t *testing.T, srv *httptest.Server) Config {
+	cfg := redirectConfig(t, "http://origem.test/inicio")
+	cfg.BearerToken = "segredo"
+	cfg.Header = http.Header{"Cookie": {"sessao=1"}, "X-Token": {"abc"}}
+	client := newHTTPClient(cfg)
+	transport := client.Transport.(*http.Transport)
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, srv.Listener.Addr().String())
+	}
+	cfg.Client = client
+	return cfg
+}
+
+// Num redirecionamento para outro host nem o salto nem as requisições
+// seguintes ao destino (sondagem e chunks) levam Authorization, Cookie ou
+// os cabeçalhos de -header; o User-Agent é mantido
+func TestCrossHostRedirectStripsCredentials(t *testing.T) {
+	data := testData(20000)
+	srv, reqs := newCredentialServer(t, data, "http://cdn.origem.test/arquivo.bin")
+	cfg := credentialConfig(t, srv)
+
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+
+	var origin, target int
+	for _, r := range reqs() {
+		switch r.host {
+		case "origem.test":
+			origin++
+			if r.auth != "Bearer segredo" || r.cookie != "sessao=1" || r.token != "abc" {
+				t.Errorf("requisição à origem sem as credenciais: %+v", r)
+			}
+		case "cdn.origem.test":
+			target++
+			if r.auth != "" || r.cookie != "" || r.token != "" {
+				t.Errorf("credenciais enviadas ao outro host: %+v", r)
+			}
+			if r.agent != defaultUserAgent {
+				t.Errorf("User-Agent %q no outro host", r.agent)
+			}
+		default:
+			t.Errorf("requisição a host inesperado: %+v", r)
+		}
+	}
+	// Os chunks também vão ao destino, não só o salto do HEAD
+	if origin == 0 || target <= int(cfg.Threads) {
+		t.Errorf("%d requisições à origem e %d ao destino", origin, target)
+	}
+}
+
+// No mesmo host as credenciais seguem em todas as requisições
+func TestSameHostRedirectKeepsCredentials(t *testing.T) {
+	data := testData(20000)
+	srv, reqs := newCredentialServer(t, data, "/arquivo.bin")
+	cfg := credentialConfig(t, srv)
+
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+
+	got := reqs()
+	for _, r := range got {
+		if r.host != "origem.test" || r.auth != "Bearer segredo" || r.cookie != "sessao=1" || r.token != "abc" {
+			t.Errorf("requisição sem as credenciais: %+v", r)
+		}
+	}
+	if len(got) <= int(cfg.Threads) {
+		t.Errorf("só %d requisições", len(got))
+	}
+}
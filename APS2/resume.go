@@ -0,0 +1,346 @@
+package main
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Estado de um download em andamento, gravado ao lado do arquivo de
+// destino para permitir retomar downloads interrompidos
+type partState struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag"`
+	LastModified string `json:"lastModified,omitempty"`
+	Size         int64  `json:"size"`
+	ChunkSize    int64  `json:"chunkSize"`
+	Done         []bool `json:"done"`
+	// SHA-256 de cada chunk concluído, como estava em disco ao terminar;
+	// conferido ao retomar com -verify-resume
+	Hashes []string `json:"hashes,omitempty"`
+	// Bytes do início do arquivo gravados no fluxo único, de onde o download
+	// continua com "Range: bytes=N-"
+	Streamed int64 `json:"streamed,omitempty"`
+	// Posição no arquivo remoto do primeiro byte baixado (-range-start)
+	Offset int64 `json:"offset,omitempty"`
+
+	mu   sync.Mutex
+	path string
+	// Carregado de uma execução anterior
+	resumed bool
+}
+
+func partPath(fileName string) string {
+	return fileName + ".part"
+}
+
+func newPartState(path, url string, info remoteInfo, chunkSize, chunks int64) *partState {
+	return &partState{
+		URL:          url,
+		ETag:         info.ETag,
+		LastModified: info.Header.Get("Last-Modified"),
+		Size:         info.Size,
+		ChunkSize:    chunkSize,
+		Done:         make([]bool, chunks),
+		path:         path,
+	}
+}
+
+// Validador para o If-Range das faixas ao retomar. ETags fracos não são
+// aceitos em If-Range, aí vale o Last-Modified.
+func (s *partState) ifRange() string {
+	if s.ETag != "" && !strings.HasPrefix(s.ETag, "W/") {
+		return s.ETag
+	}
+	return s.LastModified
+}
+
+func loadPartState(path string) (*partState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &partState{path: path}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Só é possível retomar se o arquivo remoto for o mesmo (mesmo validador e
+// tamanho) e a divisão em chunks fizer sentido. O erro diz o que não confere.
+func (s *partState) validate(url string, info remoteInfo, offset int64) error {
+	switch {
+	case s.URL != url:
+		return fmt.Errorf("estado é de outra URL (%s)", s.URL)
+	case s.Offset != offset:
+		return fmt.Errorf("estado é de outra faixa do arquivo (a partir do byte %d)", s.Offset)
+	}
+	if err := s.checkValidator(info); err != nil {
+		return err
+	}
+	switch {
+	case s.Size != info.Size:
+		return fmt.Errorf("tamanho mudou de %d para %d bytes", s.Size, info.Size)
+	case s.ChunkSize <= 0 || int64(len(s.Done)) != chunkCount(s.Size, s.ChunkSize):
+		return fmt.Errorf("divisão em chunks inválida (%d chunks de %d bytes)", len(s.Done), s.ChunkSize)
+	}
+	return nil
+}
+
+// Confere que o arquivo remoto é o mesmo do .part: pelo ETag quando algum
+// dos lados tem um, senão pelo Last-Modified, que também serve de If-Range.
+// Servidores de arquivos estáticos sem ETag (e o FTP e o SFTP, que só têm a
+// data) podem ser retomados assim.
+func (s *partState) checkValidator(info remoteInfo) error {
+	lastModified := info.Header.Get("Last-Modified")
+	switch {
+	case s.ETag != "" || info.ETag != "":
+		if s.ETag != info.ETag {
+			return fmt.Errorf("ETag mudou de %q para %q", s.ETag, info.ETag)
+		}
+	case s.LastModified == "" || lastModified == "":
+		return fmt.Errorf("servidor não informou ETag nem Last-Modified para confirmar que o arquivo remoto é o mesmo")
+	case s.LastModified != lastModified:
+		return fmt.Errorf("Last-Modified mudou de %s para %s", s.LastModified, lastModified)
+	}
+	return nil
+}
+
+// Desmarca os chunks concluídos que terminam além do tamanho atual do
+// arquivo em disco (ex.: arquivo truncado por fora), para que sejam baixados
+// de novo. Retorna quantos foram desmarcados.
+func (s *partState) repair(fileSize int64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for i, done := range s.Done {
+		end := min(int64(i+1)*s.ChunkSize, s.Size)
+		if done && end > fileSize {
+			s.Done[i] = false
+			n++
+		}
+	}
+	if s.Streamed > fileSize {
+		s.Streamed = 0
+		n++
+	}
+	return n
+}
+
+// Abre o arquivo de um download anterior para continuar, corrigindo o estado
+// se o arquivo em disco não tiver os bytes que ele indica
+func resumeOutput(path string, state *partState, fileSize int64, verify bool) (*os.File, *partState, error) {
+	outFile, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("erro abrindo arquivo para retomar: %w", err)
+	}
+
+	if repaired := state.repair(fileSize); repaired > 0 {
+		slog.Warn("Arquivo menor do que o estado indica, chunks serão baixados de novo", "chunks", repaired, "bytes", fileSize, "esperado", state.Size)
+		if err := state.save(); err != nil {
+			slog.Warn("Não foi possível gravar o estado do download", "erro", err)
+		}
+	}
+	if fileSize != state.Size {
+		if err := outFile.Truncate(state.Size); err != nil {
+			outFile.Close()
+			return nil, nil, fmt.Errorf("erro ajustando tamanho do arquivo: %w", err)
+		}
+	}
+
+	if verify {
+		bad, unchecked, err := state.verifyChunks(outFile)
+		if err != nil {
+			outFile.Close()
+			return nil, nil, fmt.Errorf("erro conferindo chunks baixados: %w", err)
+		}
+		if unchecked > 0 {
+			slog.Warn("Estado sem hash para alguns chunks, mantidos sem conferência", "chunks", unchecked)
+		}
+		if bad > 0 {
+			slog.Warn("Chunks corrompidos em disco, serão baixados de novo", "chunks", bad)
+			if err := state.save(); err != nil {
+				slog.Warn("Não foi possível gravar o estado do download", "erro", err)
+			}
+		}
+	}
+
+	slog.Info("Retomando download", "chunksBaixados", state.doneCount(), "chunks", len(state.Done))
+	state.resumed = true
+	return outFile, state, nil
+}
+
+// Ao retomar com menos threads do que chunks pendentes, junta chunks
+// pendentes vizinhos em faixas maiores, com no máximo o necessário para
+// dividir o que falta entre as threads. Evita uma requisição por chunk
+// pequeno quando a execução anterior usou mais threads. Os chunks continuam
+// marcados um a um no estado. Os chunks são ordenados antes de juntar, e
+// um chunk já coberto pelo anterior é absorvido, para que nenhuma faixa
+// seja pedida duas vezes.
+func mergeJobs(jobs []chunkJob, threads int64) []chunkJob {
+	n := int64(len(jobs))
+	if threads <= 0 || n <= threads {
+		return jobs
+	}
+	per := (n + threads - 1) / threads
+
+	sorted := slices.Clone(jobs)
+	slices.SortFunc(sorted, func(a, b chunkJob) int {
+		return cmp.Compare(a.index, b.index)
+	})
+
+	var merged []chunkJob
+	for _, job := range sorted {
+		if len(merged) > 0 {
+			last := &merged[len(merged)-1]
+			next := last.index + last.count
+			if job.index < next || job.index == next && last.count < per {
+				if job.index+job.count > next {
+					last.end = job.end
+					last.count = job.index + job.count - last.index
+				}
+				continue
+			}
+		}
+		merged = append(merged, job)
+	}
+	return merged
+}
+
+// Marca o chunk i como concluído, com o SHA-256 dos seus bytes em disco
+// (vazio quando não calculado)
+func (s *partState) markDone(i int64, sum string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Done[i] = true
+	if len(s.Hashes) != len(s.Done) {
+		s.Hashes = make([]string, len(s.Done))
+	}
+	s.Hashes[i] = sum
+	return s.saveLocked()
+}
+
+// SHA-256 dos bytes start-end do arquivo
+func hashRange(f *os.File, start, end int64) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, start, end-start+1)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Relê do disco cada chunk marcado como concluído e desmarca os que não
+// batem com o hash gravado, para que sejam baixados de novo. Chunks sem hash
+// (estado de uma versão anterior) são mantidos e contados em unchecked.
+func (s *partState) verifyChunks(f *os.File) (bad, unchecked int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, done := range s.Done {
+		if !done {
+			continue
+		}
+		if i >= len(s.Hashes) || s.Hashes[i] == "" {
+			unchecked++
+			continue
+		}
+		start, end := chunkRange(int64(i), s.ChunkSize, s.Size)
+		sum, err := hashRange(f, start, end)
+		if err != nil {
+			return bad, unchecked, err
+		}
+		if sum != s.Hashes[i] {
+			slog.Debug("Chunk não confere com o estado", "inicio", start, "fim", end)
+			s.Done[i] = false
+			s.Hashes[i] = ""
+			bad++
+		}
+	}
+	return bad, unchecked, nil
+}
+
+func (s *partState) setStreamed(n int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Streamed = n
+	return s.saveLocked()
+}
+
+func (s *partState) isDone(i int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Done[i]
+}
+
+func (s *partState) doneCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, done := range s.Done {
+		if done {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *partState) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.saveLocked()
+}
+
+// Grava em um arquivo temporário e renomeia, para nunca deixar o estado
+// pela metade se o processo for interrompido
+func (s *partState) saveLocked() error {
+	// Sem caminho (Config.Sink) o estado fica só em memória
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *partState) remove() {
+	if s.path != "" {
+		os.Remove(s.path)
+	}
+}
+
+// Apaga o arquivo parcial de um download que falhou de vez. Fica mantido se
+// o estado tem chunks concluídos, que uma nova execução aproveita.
+func cleanupPartial(output string) {
+	if state, err := loadPartState(partPath(output)); err == nil && (state.doneCount() > 0 || state.Streamed > 0) {
+		slog.Info("Arquivo parcial mantido para retomar", "arquivo", output, "chunks", state.doneCount(), "total", len(state.Done), "bytes", state.Streamed)
+		return
+	}
+
+	os.Remove(partPath(output))
+	if err := os.Remove(output); err == nil {
+		slog.Info("Arquivo parcial removido", "arquivo", output)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPartStateValidate(t *testing.T) {
+	modified := testModified.Format(http.TimeFormat)
+	later := testModified.Add(time.Hour).Format(http.TimeFormat)
+	state := func(etag, lastModified string) *partState {
+		return &partState{URL: "u", ETag: etag, LastModified: lastModified, Size: 100, ChunkSize: 25, Done: make([]bool, 4)}
+	}
+	remote := func(etag, lastModified string) remoteInfo {
+		info := remoteInfo{Size: 100, ETag: etag, Header: http.Header{}}
+		if lastModified != "" {
+			info.Header.Set("Last-Modified", lastModified)
+		}
+		return info
+	}
+
+	tests := []struct {
+		name   string
+		state  *partState
+		remote remoteInfo
+		ok     bool
+	}{
+		{"mesmo ETag", state(testETag, ""), remote(testETag, ""), true},
+		{"ETag diferente", state(testETag, modified), remote(`"v2"`, modified), false},
+		{"ETag só no servidor", state("", modified), remote(testETag, modified), false},
+		{"ETag só no .part", state(testETag, modified), remote("", modified), false},
+		{"mesmo Last-Modified sem ETag", state("", modified), remote("", modified), true},
+		{"Last-Modified diferente", state("", modified), remote("", later), false},
+		{"sem validador", state("", ""), remote("", ""), false},
+		{"Last-Modified só no .part", state("", modified), remote("", ""), false},
+	}
+	for _, tt := range tests {
+		err := tt.state.validate("u", tt.remote, 0)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: validate() = %v, esperado ok=%v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestIfRangeFallsBackToLastModified(t *testing.T) {
+	modified := testModified.Format(http.TimeFormat)
+	tests := []struct{ etag, want string }{
+		{testETag, testETag},
+		{`W/"fraco"`, modified},
+		{"", modified},
+	}
+	for _, tt := range tests {
+		s := &partState{ETag: tt.etag, LastModified: modified}
+		if got := s.ifRange(); got != tt.want {
+			t.Errorf("ETag %q: ifRange() = %q, esperado %q", tt.etag, got, tt.want)
+		}
+	}
+}
+
+// Um servidor sem ETag, só com Last-Modified: a retomada pede apenas os
+// chunks pendentes, com o Last-Modified no If-Range
+func TestResumeWithoutETag(t *testing.T) {
+	data := testData(10000)
+	modified := testModified.Format(http.TimeFormat)
+	var mu sync.Mutex
+	ifRange := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rng := r.Header.Get("Range"); rng != "" && r.Method == http.MethodGet {
+			mu.Lock()
+			ifRange[rng] = r.Header.Get("If-Range")
+			mu.Unlock()
+		}
+		w.Header().Set("Last-Modified", modified)
+		serveRange(w, r, data)
+	}))
+	defer srv.Close()
+	cfg := testConfig(t, srv.URL+"/arquivo.bin")
+
+	// Download interrompido com os dois primeiros chunks concluídos
+	partial := make([]byte, len(data))
+	copy(partial, data[:5000])
+	if err := os.WriteFile(cfg.Output, partial, 0644); err != nil {
+		t.Fatal(err)
+	}
+	info := remoteInfo{Size: int64(len(data)), Header: http.Header{"Last-Modified": {modified}}}
+	state := newPartState(partPath(cfg.Output), cfg.URL, info, 2500, 4)
+	state.Done[0], state.Done[1] = true, true
+	if err := state.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+
+	for _, rng := range []string{"bytes=5000-7499", "bytes=7500-9999"} {
+		got, ok := ifRange[rng]
+		if !ok {
+			t.Errorf("chunk pendente %s não foi pedido", rng)
+		} else if got != modified {
+			t.Errorf("If-Range de %s = %q, esperado o Last-Modified %q", rng, got, modified)
+		}
+	}
+	for _, rng := range []string{"bytes=0-2499", "bytes=2500-4999"} {
+		if _, ok := ifRange[rng]; ok {
+			t.Errorf("chunk concluído %s foi pedido de novo", rng)
+		}
+	}
+}
+
+func TestMergeJobs(t *testing.T) {
+	// Chunks de 100 bytes; job(i, n) cobre os chunks i a i+n-1
+	job := func(i, n int64) chunkJob {
+		return chunkJob{index: i, count: n, start: i * 100, end: (i+n)*100 - 1}
+	}
+	jobs := func(indexes ...int64) []chunkJob {
+		var js []chunkJob
+		for _, i := range indexes {
+			js = append(js, job(i, 1))
+		}
+		return js
+	}
+
+	tests := []struct {
+		name    string
+		jobs    []chunkJob
+		threads int64
+		want    []chunkJob
+	}{
+		{"vizinhos", jobs(0, 1, 2, 3, 4, 5), 2, []chunkJob{job(0, 3), job(3, 3)}},
+		{"com lacunas", jobs(0, 1, 3, 4, 5, 7), 3, []chunkJob{job(0, 2), job(3, 2), job(5, 1), job(7, 1)}},
+		{"fora de ordem", jobs(5, 0, 4, 1, 3, 2), 2, []chunkJob{job(0, 3), job(3, 3)}},
+		{"sobrepostos", []chunkJob{job(0, 1), job(1, 1), job(1, 2), job(2, 1), job(3, 1)}, 2, []chunkJob{job(0, 3), job(3, 1)}},
+		{"repetidos", jobs(0, 0, 1, 1, 2, 2), 2, []chunkJob{job(0, 3)}},
+		{"menos que as threads", jobs(3, 1), 4, jobs(3, 1)},
+	}
+	for _, tt := range tests {
+		got := mergeJobs(tt.jobs, tt.threads)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: mergeJobs() = %v, esperado %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPartStateRepair(t *testing.T) {
+	state := &partState{Size: 10000, ChunkSize: 2500, Done: []bool{true, true, true, false}}
+	if n := state.repair(4000); n != 2 {
+		t.Errorf("repair(4000) desmarcou %d chunks, esperados 2", n)
+	}
+	if want := []bool{true, false, false, false}; !slices.Equal(state.Done, want) {
+		t.Errorf("chunks %v, esperado %v", state.Done, want)
+	}
+	if n := state.repair(10000); n != 0 {
+		t.Errorf("repair com o arquivo inteiro desmarcou %d chunks", n)
+	}
+
+	streamed := &partState{Size: unknownSize, Streamed: 5000, Done: []bool{false}}
+	if n := streamed.repair(3000); n != 1 || streamed.Streamed != 0 {
+		t.Errorf("fluxo de 5000 bytes num arquivo de 3000: repair() = %d, Streamed %d", n, streamed.Streamed)
+	}
+}
+
+// Prepara um download interrompido com os dois primeiros chunks concluídos
+// em disco, deixa prep estragar o arquivo ou o estado e retoma. Retorna as
+// faixas pedidas na retomada.
+func resumeInconsistent(t *testing.T, prep func(cfg Config, state *partState)) []string {
+	t.Helper()
+	data := testData(10000)
+	srv := newRangeServer(t, data)
+	cfg := testConfig(t, srv.fileURL())
+
+	partial := make([]byte, len(data))
+	copy(partial, data[:5000])
+	if err := os.WriteFile(cfg.Output, partial, 0644); err != nil {
+		t.Fatal(err)
+	}
+	info := remoteInfo{Size: int64(len(data)), ETag: testETag, Header: http.Header{"Last-Modified": {testModified.Format(http.TimeFormat)}}}
+	state := newPartState(partPath(cfg.Output), cfg.URL, info, 2500, 4)
+	state.Done[0], state.Done[1] = true, true
+	prep(cfg, state)
+	if err := state.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+	if _, err := os.Stat(partPath(cfg.Output)); !os.IsNotExist(err) {
+		t.Error(".part mantido depois do download completo")
+	}
+
+	var ranges []string
+	for _, r := range srv.Requests() {
+		if countRanged([]string{r}) == 1 {
+			ranges = append(ranges, r)
+		}
+	}
+	slices.Sort(ranges)
+	return ranges
+}
+
+var allChunks = []string{"GET 0-2499", "GET 2500-4999", "GET 5000-7499", "GET 7500-9999"}
+
+// Estado e arquivo consistentes: só os chunks pendentes são pedidos
+func TestResumeConsistent(t *testing.T) {
+	got := resumeInconsistent(t, func(Config, *partState) {})
+	if want := allChunks[2:]; !slices.Equal(got, want) {
+		t.Errorf("faixas %q, esperadas só as pendentes %q", got, want)
+	}
+}
+
+// Arquivo truncado por fora, menor do que os chunks concluídos: o estado é
+// corrigido e só o que falta no disco é baixado de novo
+func TestResumeFileTruncated(t *testing.T) {
+	got := resumeInconsistent(t, func(cfg Config, _ *partState) {
+		if err := os.Truncate(cfg.Output, 3000); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if want := allChunks[1:]; !slices.Equal(got, want) {
+		t.Errorf("faixas %q, esperadas %q", got, want)
+	}
+}
+
+// Estado que não confere com o servidor ou com ele mesmo: o download
+// recomeça do zero em vez de misturar conteúdos
+func TestResumeStateMismatch(t *testing.T) {
+	tests := []struct {
+		name string
+		prep func(cfg Config, state *partState)
+	}{
+		{"outro ETag", func(_ Config, s *partState) { s.ETag = `"v2"` }},
+		{"outro tamanho", func(_ Config, s *partState) { s.Size = 12000; s.Done = append(s.Done, false) }},
+		{"outra URL", func(_ Config, s *partState) { s.URL = "http://outro.net/arquivo.bin" }},
+		{"outra faixa", func(_ Config, s *partState) { s.Offset = 100 }},
+		{"chunks inválidos", func(_ Config, s *partState) { s.Done = s.Done[:3] }},
+		{"chunk zerado", func(_ Config, s *partState) { s.ChunkSize = 0 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resumeInconsistent(t, tt.prep); !slices.Equal(got, allChunks) {
+				t.Errorf("faixas %q, esperado recomeçar com %q", got, allChunks)
+			}
+		})
+	}
+}
+
+// Um .part ilegível também recomeça do zero
+func TestResumeCorruptState(t *testing.T) {
+	got := resumeInconsistent(t, func(cfg Config, s *partState) {
+		// Grava lixo depois que o estado é salvo pelo helper
+		s.path = ""
+		if err := os.WriteFile(partPath(cfg.Output), []byte("{não é json"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if !slices.Equal(got, allChunks) {
+		t.Errorf("faixas %q, esperado recomeçar com %q", got, allChunks)
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	maxChunkAttempts = 5
+	baseRetryDelay   = 500 * time.Millisecond
+	maxRetryDelay    = 10 * time.Second
+)
+
+// Erro de uma resposta HTTP com status inesperado
+type statusError struct {
+	code int
+	msg  string
+	// Espera pedida pelo servidor no Retry-After de um 429 ou 503; só vale
+	// com hasRetryAfter, já que "Retry-After: 0" pede nova tentativa imediata
+	retryAfter    time.Duration
+	hasRetryAfter bool
+}
+
+func newStatusError(resp *http.Response, format string, args ...any) *statusError {
+	e := &statusError{code: resp.StatusCode, msg: fmt.Sprintf(format, args...)}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		e.retryAfter, e.hasRetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return e
+}
+
+func (e *statusError) Error() string {
+	return e.msg
+}
+
+// Maior espera aceita de um Retry-After, para que um valor absurdo não
+// trave o download
+const maxRetryAfter = 5 * time.Minute
+
+// Lê o Retry-After em segundos ou como data HTTP. Uma data no passado vira
+// espera zero; ausente ou inválido retorna false.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	var wait time.Duration
+	if secs, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+		wait = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		wait = t.Sub(now)
+	} else {
+		return 0, false
+	}
+	return min(max(wait, 0), maxRetryAfter), true
+}
+
+// Lê uma lista de códigos HTTP separados por vírgula
+func parseStatusList(s string) ([]int, error) {
+	var codes []int
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		code, err := strconv.Atoi(field)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("código HTTP inválido: %q", field)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// Status que não muda com novas tentativas: erros do cliente como 404 ou
+// 401. 408 e 429 são passageiros, e o 416 é tratado reduzindo as faixas.
+func permanentStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusRequestedRangeNotSatisfiable:
+		return false
+	}
+	return code >= 400 && code < 500
+}
+
+// Erros de rede sempre geram nova tentativa. Respostas HTTP também, menos as
+// de status permanente; com -retry-status só os códigos da lista.
+func retryableError(err error, retryStatus []int) bool {
+	var se *statusError
+	if !errors.As(err, &se) {
+		return true
+	}
+	if len(retryStatus) > 0 {
+		return slices.Contains(retryStatus, se.code)
+	}
+	return !permanentStatus(se.code)
+}
+
+func (d *download) retryable(err error) bool {
+	if errors.Is(err, errSizeChanged) || errors.Is(err, errRemoteChanged) || errors.Is(err, errTrailingData) {
+		return false
+	}
+	return retryableError(err, d.cfg.RetryStatus)
+}
+
+func (cfg Config) chunkAttempts() int {
+	if cfg.MaxAttempts > 0 {
+		return cfg.MaxAttempts
+	}
+	return maxChunkAttempts
+}
+
+func (cfg Config) triesPerMirror() int {
+	return max(cfg.TriesPerMirror, 1)
+}
+
+// Espera exponencial entre tentativas: 500ms, 1s, 2s, ... até 10s
+func retryDelay(attempt int) time.Duration {
+	delay := baseRetryDelay << (attempt - 1)
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// Falha na conexão em si (recusada, resetada, queda no meio da leitura), e
+// não uma resposta HTTP do servidor
+func isConnError(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return false
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Espera antes da próxima tentativa. Erros de conexão somam o
+// -connect-cooldown à espera exponencial, para não insistir em um servidor
+// que está se recuperando; os outros chunks seguem normalmente. Quando o
+// servidor manda Retry-After, a espera é exatamente a pedida.
+func (cfg Config) retryWait(attempt int, err error) time.Duration {
+	var se *statusError
+	if errors.As(err, &se) && se.hasRetryAfter {
+		slog.Debug("Servidor pediu espera com Retry-After", "status", se.code, "espera", se.retryAfter)
+		return se.retryAfter
+	}
+
+	delay := retryDelay(attempt)
+	if cfg.ConnectCooldown > 0 && isConnError(err) {
+		delay += cfg.ConnectCooldown
+	}
+	return delay
+}
+
+// Tentativas padrão da consulta inicial do tamanho
+const defaultProbeAttempts = 3
+
+// getFileSize com nova tentativa e espera exponencial, como nos chunks. O
+// erro final informa quantas tentativas foram feitas.
+func getFileSizeRetry(ctx context.Context, cfg Config, url string) (remoteInfo, error) {
+	attempts := cfg.ProbeAttempts
+	if attempts <= 0 {
+		attempts = defaultProbeAttempts
+	}
+
+	for attempt := 1; ; attempt++ {
+		info, err := getFileSize(ctx, cfg, url)
+		if err == nil {
+			return info, nil
+		}
+		if attempt == attempts || ctx.Err() != nil || !retryableError(err, cfg.RetryStatus) {
+			return remoteInfo{}, fmt.Errorf("consulta do arquivo falhou (tentativas: %d): %w", attempt, err)
+		}
+
+		delay := cfg.retryWait(attempt, err)
+		slog.Warn("Consulta do arquivo falhou, tentando novamente", "url", url, "tentativa", attempt, "maximo", attempts, "erro", err, "espera", delay)
+		if err := sleepContext(ctx, delay); err != nil {
+			return remoteInfo{}, err
+		}
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Limita quantos chunks podem estar em nova tentativa ao mesmo tempo, para
+// que uma falha em massa não abra todas as conexões de uma vez na
+// recuperação. Sem limite o canal é nil e acquire não espera.
+type retryGate chan struct{}
+
+func newRetryGate(max int) retryGate {
+	if max <= 0 {
+		return nil
+	}
+	return make(retryGate, max)
+}
+
+func (g retryGate) acquire(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+	select {
+	case g <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (g retryGate) release() {
+	if g != nil {
+		<-g
+	}
+}
+
+// Tenta baixar o chunk algumas vezes, continuando a partir do último byte
+// gravado em vez de recomeçar a faixa inteira
+func (d *download) downloadChunkWithRetry(ctx context.Context, start, end int64) (err error) {
+	ctx, span := d.cfg.tracer().Start(ctx, "chunk")
+	span.SetAttr("range.start", start)
+	span.SetAttr("range.end", end)
+	defer func() { span.End(err) }()
+
+	began, from, got, attempts := time.Now(), start, int64(0), 0
+	d.cfg.Hooks.chunkStart(from, end)
+	defer func() {
+		d.chunkStats.add(chunkStat{start: from, end: end, bytes: got, duration: time.Since(began), attempts: attempts, err: err})
+		if err == nil {
+			d.cfg.Hooks.chunkDone(from, end, got, time.Since(began))
+		}
+	}()
+
+	// O espelho fica fixo por -tries-per-mirror tentativas; depois o
+	// rodízio escolhe outro, evitando os que falharam mais
+	maxAttempts := d.cfg.chunkAttempts()
+	url, tries := d.mirrors.pick(), 0
+	for attempt := 1; ; attempt++ {
+		attempts = attempt
+		if tries == d.cfg.triesPerMirror() {
+			url, tries = d.mirrors.pick(), 0
+		}
+		tries++
+		slog.Debug("Tentativa do chunk", "inicio", start, "fim", end, "tentativa", attempt, "espelho", url)
+		if attempt > 1 {
+			if d.cfg.Usage.exceeded() {
+				return errDataCap
+			}
+			d.cfg.Metrics.retry()
+			if err := d.retries.acquire(d.ctx); err != nil {
+				return err
+			}
+		}
+		actx, aspan := d.cfg.tracer().Start(ctx, "attempt")
+		aspan.SetAttr("attempt", attempt)
+		aspan.SetAttr("range.start", start)
+		n, err := d.downloadChunk(actx, url, start, end)
+		aspan.SetAttr("bytes", n)
+		aspan.End(err)
+		got += n
+		if attempt > 1 {
+			d.retries.release()
+		}
+		if err == nil {
+			return nil
+		}
+		start += n
+
+		if attempt == maxAttempts || d.ctx.Err() != nil || !d.retryable(err) {
+			return err
+		}
+
+		d.cfg.Hooks.retry(start, end, attempt, err)
+		delay := d.cfg.retryWait(attempt, err)
+		slog.Warn("Chunk falhou, tentando novamente", "inicio", start, "fim", end, "tentativa", attempt, "maximo", maxAttempts, "espelho", url, "erro", err, "espera", delay)
+		if err := sleepContext(d.ctx, delay); err != nil {
+			return err
+		}
+	}
+}
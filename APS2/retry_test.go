@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseStatusList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []int
+		ok   bool
+	}{
+		{"429,500,502,503,504", []int{429, 500, 502, 503, 504}, true},
+		{" 503 , 404,", []int{503, 404}, true},
+		{"", nil, true},
+		{"5xx", nil, false},
+		{"99", nil, false},
+		{"600", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := parseStatusList(tt.in)
+		if (err == nil) != tt.ok || !slices.Equal(got, tt.want) {
+			t.Errorf("parseStatusList(%q) = %v, %v; esperado %v, ok=%v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRetryableError(t *testing.T) {
+	status := func(code int) error {
+		return &statusError{code: code, msg: http.StatusText(code)}
+	}
+	netErr := errors.New("conexão resetada")
+	tests := []struct {
+		err   error
+		list  []int
+		retry bool
+	}{
+		{status(503), nil, true},
+		{status(429), nil, true},
+		{status(404), nil, false},
+		{status(403), nil, false},
+		{netErr, nil, true},
+		// Com a lista, só os códigos dela, mesmo os permanentes
+		{status(503), []int{500}, false},
+		{status(500), []int{500}, true},
+		{status(404), []int{404}, true},
+		// Erros de rede continuam sendo tentados de novo
+		{netErr, []int{500}, true},
+	}
+	for _, tt := range tests {
+		if got := retryableError(tt.err, tt.list); got != tt.retry {
+			t.Errorf("%v com -retry-status %v: nova tentativa %v, esperado %v", tt.err, tt.list, got, tt.retry)
+		}
+	}
+}
+
+// No download, um status fora de -retry-status encerra o chunk na primeira
+// resposta e um da lista é tentado de novo
+func TestRetryStatusDownload(t *testing.T) {
+	data := testData(10000)
+	tests := []struct {
+		name  string
+		f     faults
+		list  []int
+		ok    bool
+		tries int
+	}{
+		{"503 fora da lista", faults{fail: 1}, []int{500}, false, 1},
+		{"503 na lista", faults{fail: 1}, []int{503}, true, 2},
+		{"404 na lista", faults{status: http.StatusNotFound}, []int{404}, true, 2},
+		{"404 sem lista", faults{status: http.StatusNotFound}, nil, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFaultServer(t, data, tt.f)
+			cfg := testConfig(t, srv.fileURL())
+			cfg.RetryStatus = tt.list
+
+			_, _, err := runDownload(context.Background(), cfg)
+			if (err == nil) != tt.ok {
+				t.Fatalf("runDownload() = %v, esperado ok=%v", err, tt.ok)
+			}
+			for _, c := range faultChunks {
+				if n := srv.count(c[1]); n != tt.tries {
+					t.Errorf("faixa %d-%d pedida %d vezes, esperadas %d", c[0], c[1], n, tt.tries)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryGate(t *testing.T) {
+	var unlimited retryGate = newRetryGate(0)
+	for range 100 {
+		if err := unlimited.acquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	g := newRetryGate(1)
+	if err := g.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := g.acquire(ctx); err == nil {
+		t.Error("segunda vaga obtida com o limite de 1")
+	}
+	g.release()
+	if err := g.acquire(context.Background()); err != nil {
+		t.Errorf("vaga não liberada: %v", err)
+	}
+}
+
+// Todos os chunks falham juntos na primeira tentativa: as novas tentativas
+// simultâneas não passam de -max-concurrent-retries
+func TestMaxConcurrentRetries(t *testing.T) {
+	data := testData(10000)
+	tests := []struct {
+		limit int
+		peak  int
+	}{
+		{2, 2},
+		// Sem limite, os 8 chunks tentam de novo ao mesmo tempo
+		{0, 8},
+	}
+	for _, tt := range tests {
+		var mu sync.Mutex
+		seen := map[string]bool{}
+		active, peak := 0, 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rng := r.Header.Get("Range")
+			if rng == "" || r.Method != http.MethodGet {
+				serveRange(w, r, data)
+				return
+			}
+			mu.Lock()
+			retry := seen[rng]
+			seen[rng] = true
+			if retry {
+				active++
+				peak = max(peak, active)
+			}
+			mu.Unlock()
+			if !retry {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			// Lento o bastante para as novas tentativas se sobreporem
+			time.Sleep(200 * time.Millisecond)
+			serveRange(w, r, data)
+			mu.Lock()
+			active--
+			mu.Unlock()
+		}))
+		defer srv.Close()
+
+		cfg := testConfig(t, srv.URL+"/arquivo.bin")
+		cfg.Threads = 8
+		cfg.MaxConcurrentRetries = tt.limit
+		if _, _, err := runDownload(context.Background(), cfg); err != nil {
+			t.Fatal(err)
+		}
+		checkFile(t, cfg.Output, data)
+		mu.Lock()
+		if peak != tt.peak {
+			t.Errorf("limite %d: %d novas tentativas simultâneas, esperadas %d", tt.limit, peak, tt.peak)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestIsConnError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{fmt.Errorf("erro copiando chunk: %w", syscall.ECONNRESET), true},
+		{fmt.Errorf("erro copiando chunk: %w", io.ErrUnexpectedEOF), true},
+		{&statusError{code: http.StatusServiceUnavailable}, false},
+		{errors.New("servidor não retornou dados"), false},
+		{context.DeadlineExceeded, false},
+	}
+	for _, tt := range tests {
+		if got := isConnError(tt.err); got != tt.want {
+			t.Errorf("isConnError(%v) = %v, esperado %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryWaitCooldown(t *testing.T) {
+	const cooldown = 5 * time.Second
+	cfg := Config{ConnectCooldown: cooldown}
+	connErr := fmt.Errorf("erro copiando chunk: %w", io.ErrUnexpectedEOF)
+	tests := []struct {
+		err  error
+		want time.Duration
+	}{
+		{connErr, retryDelay(2) + cooldown},
+		{&statusError{code: http.StatusServiceUnavailable}, retryDelay(2)},
+		// Retry-After vale exatamente, mesmo com cooldown
+		{&statusError{code: http.StatusTooManyRequests, hasRetryAfter: true, retryAfter: time.Second}, time.Second},
+	}
+	for _, tt := range tests {
+		if got := cfg.retryWait(2, tt.err); got != tt.want {
+			t.Errorf("retryWait(%v) = %s, esperado %s", tt.err, got, tt.want)
+		}
+	}
+	if got := (Config{}).retryWait(2, connErr); got != retryDelay(2) {
+		t.Errorf("sem -connect-cooldown: %s, esperado %s", got, retryDelay(2))
+	}
+}
+
+// A conexão do primeiro chunk cai no meio do corpo: a nova tentativa dele
+// espera o cooldown, enquanto os outros chunks terminam sem esperar
+func TestConnectCooldownDownload(t *testing.T) {
+	const cooldown = 300 * time.Millisecond
+	data := testData(10000)
+	var mu sync.Mutex
+	var first []time.Time
+	var othersDone time.Time
+	dropped := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start, end, ranged := requestedRange(r.Header.Get("Range"), int64(len(data)))
+		if !ranged || r.Method != http.MethodGet {
+			serveRange(w, r, data)
+			return
+		}
+		// A nova tentativa continua do byte em que a conexão caiu
+		mu.Lock()
+		if start >= 2500 {
+			mu.Unlock()
+			serveRange(w, r, data)
+			mu.Lock()
+			othersDone = time.Now()
+			mu.Unlock()
+			return
+		}
+		first = append(first, time.Now())
+		drop := !dropped
+		dropped = true
+		mu.Unlock()
+		if drop {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+			w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(data[start : start+100])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		serveRange(w, r, data)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(t, srv.URL+"/arquivo.bin")
+	cfg.ConnectCooldown = cooldown
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(first) != 2 {
+		t.Fatalf("primeiro chunk pedido %d vezes, esperadas 2", len(first))
+	}
+	if wait := first[1].Sub(first[0]); wait < retryDelay(1)+cooldown {
+		t.Errorf("nova tentativa depois de %s, esperado pelo menos %s", wait, retryDelay(1)+cooldown)
+	}
+	if !othersDone.Before(first[1]) {
+		t.Error("os outros chunks esperaram o cooldown do primeiro")
+	}
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefixo de -output que envia o download para um bucket do S3
+const s3Scheme = "s3://"
+
+// Limites do upload multipart do S3: toda parte menos a última tem pelo
+// menos 5MB e um upload tem no máximo 10000 partes. Com tamanho
+// desconhecido as partes têm s3DefaultPartSize, o que cobre até 160GB.
+const (
+	s3MinPartSize     = 5 * 1024 * 1024
+	s3MaxParts        = 10000
+	s3DefaultPartSize = 16 * 1024 * 1024
+)
+
+// Tempo máximo de cada requisição ao S3, para um envio travado não prender
+// o chunk para sempre
+const s3RequestTimeout = 10 * time.Minute
+
+// Tamanho das partes para um arquivo de total bytes, arredondado para MB
+func s3PartSizeFor(total int64) int64 {
+	if total == unknownSize {
+		return s3DefaultPartSize
+	}
+	size := max(s3MinPartSize, (total+s3MaxParts-1)/s3MaxParts)
+	const mb = 1024 * 1024
+	return (size + mb - 1) / mb * mb
+}
+
+// Destino do S3 com as credenciais e a região das variáveis de ambiente
+// padrão da AWS (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+// AWS_SESSION_TOKEN, AWS_REGION ou AWS_DEFAULT_REGION). AWS_ENDPOINT_URL
+// aponta para outro serviço compatível, como o MinIO, com o bucket no
+// caminho da URL em vez do nome do host.
+type s3Target struct {
+	// Cliente do download, com o proxy, os certificados e o DNS
+	// configurados; nil usa http.DefaultClient
+	client       *http.Client
+	bucket, key  string
+	region       string
+	endpoint     *url.URL
+	pathStyle    bool
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+func parseS3Target(dest string) (s3Target, error) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(dest, s3Scheme), "/")
+	if bucket == "" || key == "" || strings.HasSuffix(key, "/") {
+		return s3Target{}, fmt.Errorf("destino do S3 inválido: %q (use s3://bucket/chave)", dest)
+	}
+
+	t := s3Target{
+		bucket:       bucket,
+		key:          key,
+		region:       firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if t.accessKey == "" || t.secretKey == "" {
+		return s3Target{}, errors.New("credenciais do S3 ausentes: defina AWS_ACCESS_KEY_ID e AWS_SECRET_ACCESS_KEY")
+	}
+	if t.region == "" {
+		t.region = "us-east-1"
+	}
+
+	endpoint := "https://" + bucket + ".s3." + t.region + ".amazonaws.com"
+	if custom := os.Getenv("AWS_ENDPOINT_URL"); custom != "" {
+		endpoint, t.pathStyle = strings.TrimRight(custom, "/"), true
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return s3Target{}, fmt.Errorf("AWS_ENDPOINT_URL inválido: %q", endpoint)
+	}
+	t.endpoint = u
+	return t, nil
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// URL do objeto com a query da operação
+func (t s3Target) objectURL(query url.Values) *url.URL {
+	u := *t.endpoint
+	u.Path = "/" + t.key
+	if t.pathStyle {
+		u.Path = strings.TrimRight(t.endpoint.Path, "/") + "/" + t.bucket + "/" + t.key
+	}
+	// A assinatura usa o caminho codificado como o S3 o recodifica, que
+	// escapa mais caracteres do que o net/url
+	u.RawPath = s3EscapePath(u.Path)
+	u.RawQuery = s3CanonicalQuery(query)
+	return &u
+}
+
+// Escapa tudo menos letras, dígitos, - _ . ~ e as barras
+func s3EscapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// Faz uma requisição assinada ao S3 e devolve o corpo da resposta
+func (t s3Target) do(ctx context.Context, method string, query url.Values, body []byte) (http.Header, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, s3RequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, t.objectURL(query).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	t.sign(req, body, time.Now())
+
+	client := t.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	// O CompleteMultipartUpload pode responder 200 com um erro no corpo
+	if resp.StatusCode/100 != 2 || bytes.Contains(data[:min(len(data), 256)], []byte("<Error>")) {
+		var e struct {
+			Code    string
+			Message string
+		}
+		xml.Unmarshal(data, &e)
+		if resp.StatusCode/100 == 2 {
+			resp.StatusCode = http.StatusInternalServerError
+		}
+		return nil, nil, newStatusError(resp, "S3 recusou %s %s: %s %s %s", method, query.Encode(), resp.Status, e.Code, e.Message)
+	}
+	return resp.Header, data, nil
+}
+
+// Assina com AWS Signature Version 4, cobrindo o host e todos os
+// cabeçalhos da requisição
+func (t s3Target) sign(req *http.Request, body []byte, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payload := sha256.Sum256(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payload[:]))
+	if t.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", t.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signed,
+		hex.EncodeToString(payload[:]),
+	}, "\n")
+	scope := day + "/" + t.region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + t.secretKey)
+	for _, part := range []string{day, t.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", t.accessKey, scope, signed, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// Query ordenada por chave, com espaços como %20 ("uploads" vira
+// "uploads=")
+func s3CanonicalQuery(query url.Values) string {
+	return strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+// Parte ainda em memória: os bytes chegam em ordem a partir do início da
+// parte, e filled é até onde já chegaram
+type s3Part struct {
+	buf    []byte
+	filled int64
+}
+
+// Config.Sink que envia o download para o S3 num upload multipart, sem
+// arquivo local. Os chunks começam sempre no início de uma parte (PartSize)
+// e cada parte é enviada pelo próprio chunk assim que seus bytes chegam,
+// então a memória usada é de uma parte por chunk em andamento. Complete
+// envia a última parte e fecha o upload; Abort descarta as partes enviadas.
+type S3Sink struct {
+	target   s3Target
+	uploadID string
+	// Contexto do download: cancelado, as partes deixam de ser enviadas
+	ctx context.Context
+
+	mu sync.Mutex
+	// Tamanho final, ou unknownSize até o fluxo único terminar
+	size     int64
+	partSize int64
+	// O tamanho das partes fica fixo depois da primeira escrita
+	started bool
+	parts   map[int64]*s3Part
+	etags   map[int64]string
+}
+
+// Abre o upload multipart para s3://bucket/chave. As partes são enviadas
+// por client (nil usa http.DefaultClient) enquanto ctx não for cancelado.
+func NewS3Sink(ctx context.Context, client *http.Client, dest string) (*S3Sink, error) {
+	target, err := parseS3Target(dest)
+	if err != nil {
+		return nil, err
+	}
+	target.client = client
+	_, body, err := target.do(ctx, http.MethodPost, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("erro iniciando upload para o S3: %w", err)
+	}
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(body, &result); err != nil || result.UploadID == "" {
+		return nil, fmt.Errorf("resposta inválida ao iniciar upload para o S3: %q", body)
+	}
+	slog.Debug("Upload multipart iniciado", "bucket", target.bucket, "chave", target.key, "upload", result.UploadID)
+
+	return &S3Sink{
+		target:   target,
+		uploadID: result.UploadID,
+		ctx:      ctx,
+		size:     unknownSize,
+		partSize: s3PartSizeFor(unknownSize),
+		parts:    map[int64]*s3Part{},
+		etags:    map[int64]string{},
+	}, nil
+}
+
+// Tamanho das partes para um arquivo de total bytes; o download alinha os
+// chunks a esse valor
+func (s *S3Sink) PartSize(total int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return s.partSize
+	}
+	return s3PartSizeFor(total)
+}
+
+// Bytes da parte index (a partir de zero)
+func (s *S3Sink) partLen(index int64) int64 {
+	if s.size == unknownSize {
+		return s.partSize
+	}
+	return min(s.partSize, s.size-index*s.partSize)
+}
+
+func (s *S3Sink) Truncate(size int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.size = size
+	if !s.started {
+		s.partSize = s3PartSizeFor(size)
+	}
+	// Um fluxo único que recomeça do zero descarta o que passou do novo
+	// tamanho; as partes já enviadas são substituídas ao serem enviadas de
+	// novo
+	for index, part := range s.parts {
+		if length := s.partLen(index); length <= 0 {
+			delete(s.parts, index)
+		} else if int64(len(part.buf)) > length {
+			part.buf = part.buf[:length]
+			part.filled = min(part.filled, length)
+		}
+	}
+	for index := range s.etags {
+		if s.partLen(index) <= 0 {
+			delete(s.etags, index)
+		}
+	}
+	return nil
+}
+
+// Copia p para as partes que cobre e envia as que ficarem completas. Se o
+// envio falha, os bytes daquela parte não contam como gravados: o chunk
+// tenta de novo a partir deles e a parte é enviada outra vez.
+func (s *S3Sink) WriteAt(p []byte, off int64) (int, error) {
+	written := 0
+	for written < len(p) {
+		pos := off + int64(written)
+		index := pos / s.partSize
+
+		s.mu.Lock()
+		s.started = true
+		length := s.partLen(index)
+		partStart := index * s.partSize
+		if length <= 0 || pos-partStart >= length {
+			s.mu.Unlock()
+			return written, fmt.Errorf("escrita em %d além do tamanho do destino (%d)", pos, s.size)
+		}
+		part := s.parts[index]
+		if part == nil {
+			part = &s3Part{buf: make([]byte, length)}
+			s.parts[index] = part
+		}
+		rel := pos - partStart
+		n := copy(part.buf[rel:], p[written:])
+		if rel <= part.filled {
+			part.filled = max(part.filled, rel+int64(n))
+		}
+		full := part.filled == length
+		if full {
+			delete(s.parts, index)
+		}
+		s.mu.Unlock()
+
+		if full {
+			if err := s.uploadPart(s.ctx, index, part.buf); err != nil {
+				s.mu.Lock()
+				part.filled = rel
+				s.parts[index] = part
+				s.mu.Unlock()
+				return written, err
+			}
+		}
+		written += n
+	}
+	return written, nil
+}
+
+func (s *S3Sink) uploadPart(ctx context.Context, index int64, data []byte) error {
+	number := index + 1
+	query := url.Values{"partNumber": {fmt.Sprint(number)}, "uploadId": {s.uploadID}}
+	header, _, err := s.target.do(ctx, http.MethodPut, query, data)
+	if err != nil {
+		return fmt.Errorf("erro enviando a parte %d para o S3: %w", number, err)
+	}
+	s.mu.Lock()
+	s.etags[index] = header.Get("ETag")
+	s.mu.Unlock()
+	slog.Debug("Parte enviada para o S3", "parte", number, "bytes", len(data))
+	return nil
+}
+
+// Envia a última parte, que com tamanho desconhecido só fica completa no
+// Truncate final, e fecha o upload
+func (s *S3Sink) Complete(ctx context.Context) error {
+	s.mu.Lock()
+	if s.size == unknownSize {
+		s.mu.Unlock()
+		return errors.New("tamanho final do destino desconhecido")
+	}
+	pending := map[int64]*s3Part{}
+	for index, part := range s.parts {
+		if part.filled != s.partLen(index) {
+			s.mu.Unlock()
+			return fmt.Errorf("parte %d incompleta: %d de %d bytes", index+1, part.filled, s.partLen(index))
+		}
+		pending[index] = part
+	}
+	// Um upload precisa de pelo menos uma parte, mesmo vazia
+	if s.size == 0 && len(s.etags) == 0 {
+		pending[0] = &s3Part{}
+	}
+	s.mu.Unlock()
+
+	for index, part := range pending {
+		if err := s.uploadPart(ctx, index, part.buf); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	count := max(1, (s.size+s.partSize-1)/s.partSize)
+	type completedPart struct {
+		PartNumber int64
+		ETag       string
+	}
+	var request struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}
+	for index := int64(0); index < count; index++ {
+		etag, ok := s.etags[index]
+		if !ok {
+			s.mu.Unlock()
+			return fmt.Errorf("parte %d não foi enviada", index+1)
+		}
+		request.Parts = append(request.Parts, completedPart{PartNumber: index + 1, ETag: etag})
+	}
+	s.mu.Unlock()
+
+	body, err := xml.Marshal(request)
+	if err != nil {
+		return err
+	}
+	if _, _, err := s.target.do(ctx, http.MethodPost, url.Values{"uploadId": {s.uploadID}}, body); err != nil {
+		return fmt.Errorf("erro concluindo upload para o S3: %w", err)
+	}
+	return nil
+}
+
+// Cancela o upload, para o S3 não guardar (e cobrar) as partes enviadas
+func (s *S3Sink) Abort(ctx context.Context) error {
+	if _, _, err := s.target.do(ctx, http.MethodDelete, url.Values{"uploadId": {s.uploadID}}, nil); err != nil {
+		return fmt.Errorf("erro cancelando upload para o S3: %w", err)
+	}
+	return nil
+}
+
+// Com -output s3://bucket/chave o arquivo vai direto para o S3, sem arquivo
+// local. Como no -output -, é baixado uma vez, sem o benchmark.
+func runToS3(ctx context.Context, cfg Config) error {
+	if err := cfg.checkLocalOnly(); err != nil {
+		return err
+	}
+	sink, err := NewS3Sink(ctx, cfg.httpClient(), cfg.Output)
+	if err != nil {
+		return err
+	}
+	cfg.Sink = sink
+
+	size, _, err := runWithTimeout(ctx, cfg)
+	if err == nil {
+		err = sink.Complete(ctx)
+	}
+	if err != nil {
+		// Cancela o upload mesmo depois de um Ctrl+C, que também cancelou ctx
+		if aerr := sink.Abort(context.WithoutCancel(ctx)); aerr != nil {
+			slog.Warn("Não foi possível cancelar o upload", "erro", aerr)
+		}
+		return err
+	}
+	slog.Info("Arquivo enviado para o S3", "destino", cfg.Output, "bytes", size)
+	return nil
+}
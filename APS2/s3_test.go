@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// S3 de teste com as quatro operações do upload multipart, no estilo de
+// caminho (AWS_ENDPOINT_URL)
+type fakeS3 struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	initiated bool
+	parts     map[int][]byte
+	object    []byte
+	completed bool
+	aborted   bool
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	s := &fakeS3{parts: map[int][]byte{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+
+	t.Setenv("AWS_ENDPOINT_URL", s.URL)
+	t.Setenv("AWS_ACCESS_KEY_ID", "teste")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "segredo")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_REGION", "sa-east-1")
+	return s
+}
+
+func (s *fakeS3) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/bucket/pasta/arquivo.bin" || r.Header.Get("Authorization") == "" {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	query := r.URL.Query()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.initiated = true
+		fmt.Fprint(w, "<InitiateMultipartUploadResult><UploadId>u1</UploadId></InitiateMultipartUploadResult>")
+	case r.Method == http.MethodPut && query.Get("uploadId") == "u1":
+		n, _ := strconv.Atoi(query.Get("partNumber"))
+		s.parts[n] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"p%d"`, n))
+	case r.Method == http.MethodPost && query.Get("uploadId") == "u1":
+		var req struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+		xml.Unmarshal(body, &req)
+		for i, p := range req.Parts {
+			if p.PartNumber != i+1 || p.ETag != fmt.Sprintf(`"p%d"`, p.PartNumber) {
+				http.Error(w, "<Error><Code>InvalidPart</Code></Error>", http.StatusBadRequest)
+				return
+			}
+			s.object = append(s.object, s.parts[p.PartNumber]...)
+		}
+		s.completed = true
+		fmt.Fprint(w, "<CompleteMultipartUploadResult/>")
+	case r.Method == http.MethodDelete && query.Get("uploadId") == "u1":
+		s.aborted = true
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "<Error><Code>InvalidRequest</Code></Error>", http.StatusBadRequest)
+	}
+}
+
+func (s *fakeS3) state() (initiated, completed, aborted bool, parts int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.initiated, s.completed, s.aborted, len(s.parts)
+}
+
+// Conta as requisições que passam pelo cliente configurado
+type countingTransport struct {
+	mu    sync.Mutex
+	hosts map[string]int
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.hosts[r.URL.Host]++
+	c.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func (c *countingTransport) count(rawURL string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, _ := url.Parse(rawURL)
+	return c.hosts[u.Host]
+}
+
+func TestS3Upload(t *testing.T) {
+	s3 := newFakeS3(t)
+	// Três partes de 5MB, a última menor
+	data := testData(11<<20 + 123)
+	srv := newRangeServer(t, data)
+	cfg := testConfig(t, srv.fileURL())
+	cfg.Output = "s3://bucket/pasta/arquivo.bin"
+	transport := &countingTransport{hosts: map[string]int{}}
+	cfg.Client = &http.Client{Transport: transport}
+
+	if err := runToS3(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, completed, aborted, parts := s3.state(); !completed || aborted || parts != 3 {
+		t.Fatalf("upload concluído %v, cancelado %v, %d partes; esperadas 3 partes concluídas", completed, aborted, parts)
+	}
+	if !bytes.Equal(s3.object, data) {
+		t.Fatalf("objeto com %d bytes diferentes do original (%d bytes)", len(s3.object), len(data))
+	}
+	// Iniciar, 3 partes e concluir, todas pelo cliente do download
+	if n := transport.count(s3.URL); n != 5 {
+		t.Errorf("%d requisições ao S3 pelo cliente configurado, esperadas 5", n)
+	}
+}
+
+func TestS3AbortOnFailure(t *testing.T) {
+	s3 := newFakeS3(t)
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	cfg := testConfig(t, srv.URL+"/arquivo.bin")
+	cfg.Output = "s3://bucket/pasta/arquivo.bin"
+
+	if err := runToS3(context.Background(), cfg); err == nil {
+		t.Fatal("download de um arquivo inexistente terminou sem erro")
+	}
+	if _, completed, aborted, _ := s3.state(); completed || !aborted {
+		t.Errorf("upload concluído %v, cancelado %v; esperado só cancelado", completed, aborted)
+	}
+}
+
+// Com Ctrl+C o contexto do download já está cancelado, mas o upload ainda
+// precisa ser cancelado no S3
+func TestS3AbortOnInterrupt(t *testing.T) {
+	s3 := newFakeS3(t)
+	srv := newRangeServer(t, testData(100000))
+	cfg := testConfig(t, srv.fileURL())
+	cfg.Output = "s3://bucket/pasta/arquivo.bin"
+	cfg.Pause = NewPauseControl()
+	cfg.Pause.Pause()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- runToS3(ctx, cfg) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for initiated, _, _, _ := s3.state(); !initiated; initiated, _, _, _ = s3.state() {
+		if time.Now().After(deadline) {
+			t.Fatal("upload não foi iniciado")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err == nil {
+		t.Fatal("download interrompido terminou sem erro")
+	}
+	if _, completed, aborted, _ := s3.state(); completed || !aborted {
+		t.Errorf("upload concluído %v, cancelado %v; esperado só cancelado", completed, aborted)
+	}
+}
+
+// Cancelado o download, uma parte completa não é mais enviada
+func TestS3SinkStopsWithContext(t *testing.T) {
+	s3 := newFakeS3(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	sink, err := NewS3Sink(ctx, nil, "s3://bucket/pasta/arquivo.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Truncate(s3MinPartSize)
+	cancel()
+
+	if _, err := sink.WriteAt(make([]byte, s3MinPartSize), 0); err == nil {
+		t.Error("parte enviada depois do cancelamento")
+	}
+	if _, _, _, parts := s3.state(); parts != 0 {
+		t.Errorf("%d partes recebidas depois do cancelamento", parts)
+	}
+}
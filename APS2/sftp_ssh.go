@@ -0,0 +1,138 @@
+//go:build sftp
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func init() {
+	openSFTP = openSFTPFile
+}
+
+type sftpRemote struct {
+	*sftp.File
+	client *sftp.Client
+	conn   *ssh.Client
+	stop   func() bool
+}
+
+func (r *sftpRemote) Close() error {
+	r.stop()
+	r.File.Close()
+	r.client.Close()
+	return r.conn.Close()
+}
+
+// Conecta com o usuário da URL, o de -user ou o do sistema, autenticando
+// pela chave de -ssh-key e pela senha da URL ou de -password. A chave do
+// servidor é conferida no known_hosts de -ssh-known-hosts, exceto com
+// -insecure. O caminho da URL é absoluto; /~/ no início é o diretório do
+// usuário, como no curl.
+func openSFTPFile(ctx context.Context, cfg Config, rawURL string) (sftpFile, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "22"
+	}
+	file := u.Path
+	if rel, ok := strings.CutPrefix(file, "/~/"); ok {
+		file = rel
+	}
+	if file == "" || strings.HasSuffix(file, "/") {
+		return nil, fmt.Errorf("URL SFTP sem arquivo: %s", rawURL)
+	}
+
+	user, pass := os.Getenv("USER"), cfg.Password
+	if u.User != nil {
+		user = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			pass = p
+		}
+	} else if cfg.Username != "" {
+		user = cfg.Username
+	}
+
+	var auth []ssh.AuthMethod
+	if cfg.SSHKey != "" {
+		key, err := os.ReadFile(cfg.SSHKey)
+		if err != nil {
+			return nil, fmt.Errorf("erro lendo -ssh-key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("chave SSH inválida em %s (chaves com senha não são suportadas): %w", cfg.SSHKey, err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if pass != "" {
+		auth = append(auth, ssh.Password(pass))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("nenhuma credencial SSH para %s: use -ssh-key ou -password", u.Host)
+	}
+
+	hostKey := ssh.InsecureIgnoreHostKey()
+	if !cfg.SSHInsecureHostKey {
+		path := cfg.SSHKnownHosts
+		if path == "" {
+			home, _ := os.UserHomeDir()
+			path = filepath.Join(home, ".ssh", "known_hosts")
+		}
+		if hostKey, err = knownhosts.New(path); err != nil {
+			return nil, fmt.Errorf("erro lendo known_hosts: %w", err)
+		}
+	}
+
+	addr := net.JoinHostPort(u.Hostname(), port)
+	var dialer net.Dialer
+	raw, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("erro conectando ao servidor SSH: %w", err)
+	}
+	stop := context.AfterFunc(ctx, func() { raw.Close() })
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(raw, addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKey,
+	})
+	if err != nil {
+		stop()
+		raw.Close()
+		return nil, fmt.Errorf("erro na conexão SSH: %w", err)
+	}
+	conn := ssh.NewClient(sshConn, chans, reqs)
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		stop()
+		conn.Close()
+		return nil, fmt.Errorf("servidor sem o subsistema SFTP: %w", err)
+	}
+	f, err := client.Open(file)
+	if err != nil {
+		stop()
+		client.Close()
+		conn.Close()
+		if os.IsNotExist(err) {
+			return nil, &statusError{code: http.StatusNotFound, msg: fmt.Sprintf("arquivo não encontrado por SFTP: %s", file)}
+		}
+		return nil, fmt.Errorf("erro abrindo %s por SFTP: %w", file, err)
+	}
+	return &sftpRemote{File: f, client: client, conn: conn, stop: stop}, nil
+}
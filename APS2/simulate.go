@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io"
+	"math/rand"
+	"time"
+)
+
+// Leitor que atrasa cada leitura, para simular um servidor lento ao testar
+// barras de progresso e timeouts sem depender da rede
+type slowReader struct {
+	r      io.Reader
+	delay  time.Duration
+	jitter time.Duration
+	rnd    *rand.Rand
+	sleep  func(time.Duration)
+}
+
+func newSlowReader(r io.Reader, delay, jitter time.Duration) *slowReader {
+	return &slowReader{
+		r:      r,
+		delay:  delay,
+		jitter: jitter,
+		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		sleep:  time.Sleep,
+	}
+}
+
+// Atraso da próxima leitura: delay ± jitter, nunca negativo
+func (s *slowReader) nextDelay() time.Duration {
+	d := s.delay
+	if s.jitter > 0 {
+		d += time.Duration(s.rnd.Int63n(int64(2*s.jitter)+1)) - s.jitter
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	s.sleep(s.nextDelay())
+	return s.r.Read(p)
+}
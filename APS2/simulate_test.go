@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// Leitor lento com relógio falso: guarda os atrasos em vez de dormir
+func fakeSlowReader(r io.Reader, delay, jitter time.Duration, seed int64) (*slowReader, *[]time.Duration) {
+	var slept []time.Duration
+	s := newSlowReader(r, delay, jitter)
+	s.rnd = rand.New(rand.NewSource(seed))
+	s.sleep = func(d time.Duration) { slept = append(slept, d) }
+	return s, &slept
+}
+
+func TestSlowReaderDelay(t *testing.T) {
+	data := testData(1000)
+	s, slept := fakeSlowReader(bytes.NewReader(data), 50*time.Millisecond, 0, 1)
+
+	got, err := io.ReadAll(io.LimitReader(s, int64(len(data))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("o leitor lento alterou os bytes")
+	}
+	if len(*slept) == 0 {
+		t.Fatal("nenhum atraso aplicado")
+	}
+	for i, d := range *slept {
+		if d != 50*time.Millisecond {
+			t.Errorf("leitura %d atrasada %s, esperado 50ms", i, d)
+		}
+	}
+}
+
+// Com jitter o atraso varia dentro de delay ± jitter, nunca negativo, e a
+// mesma semente repete a mesma sequência
+func TestSlowReaderJitter(t *testing.T) {
+	const delay, jitter = 10 * time.Millisecond, 30 * time.Millisecond
+	read := func() []time.Duration {
+		s, slept := fakeSlowReader(bytes.NewReader(testData(100)), delay, jitter, 42)
+		buf := make([]byte, 1)
+		for range 100 {
+			s.Read(buf)
+		}
+		return *slept
+	}
+
+	first := read()
+	varied := false
+	for i, d := range first {
+		if d < 0 || d > delay+jitter {
+			t.Errorf("leitura %d atrasada %s, fora de 0 a %s", i, d, delay+jitter)
+		}
+		varied = varied || d != first[0]
+	}
+	if !varied {
+		t.Error("jitter não variou o atraso")
+	}
+	second := read()
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("leitura %d: %s e %s com a mesma semente", i, first[i], second[i])
+		}
+	}
+}
+
+// No download o atraso entra em cada leitura do corpo
+func TestSimulateSlowDownload(t *testing.T) {
+	data := testData(10000)
+	srv := newRangeServer(t, data)
+	cfg := testConfig(t, srv.fileURL())
+	cfg.Threads = 1
+	cfg.BufferSize = 1000
+	cfg.SimulateDelay = 20 * time.Millisecond
+
+	began := time.Now()
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+	// Pelo menos uma leitura por buffer de 1000 bytes
+	if elapsed := time.Since(began); elapsed < 10*cfg.SimulateDelay {
+		t.Errorf("download levou %s, esperado pelo menos %s", elapsed, 10*cfg.SimulateDelay)
+	}
+}
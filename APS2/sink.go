@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Destino dos bytes de um download. Os chunks gravam ao mesmo tempo, cada um
+// na sua faixa, então WriteAt precisa aceitar chamadas concorrentes em
+// offsets diferentes, como o *os.File, que é o destino padrão. Truncate
+// ajusta o tamanho antes dos chunks começarem e quando um fluxo único
+// recomeça do zero.
+type RandomAccessWriter interface {
+	io.WriterAt
+	Truncate(size int64) error
+}
+
+// Destino que só aceita faixas em blocos de tamanho fixo, como as partes
+// de um upload multipart: os chunks passam a ter um múltiplo desse tamanho
+type partAligner interface {
+	PartSize(total int64) int64
+}
+
+// Com Config.Sink não há arquivo local: o estado fica só em memória, sem
+// .part nem .status, e o que depende de reler ou renomear o arquivo não
+// funciona
+func (cfg Config) checkSink() error {
+	if cfg.Sink == nil {
+		return nil
+	}
+	return cfg.checkLocalOnly()
+}
+
+// Recusa as opções que releem ou alteram o arquivo local
+func (cfg Config) checkLocalOnly() error {
+	options := []struct {
+		name string
+		set  bool
+	}{
+		{"Checksum", cfg.Checksum != ""},
+		{"ChecksumURL", cfg.ChecksumURL != ""},
+		{"ChecksumOutput", cfg.ChecksumOutput != ""},
+		{"HashURL", cfg.HashURL != ""},
+		{"Extract", cfg.Extract},
+		{"Xattr", cfg.Xattr},
+		{"PreserveTimestamp", cfg.PreserveTimestamp},
+		{"OverwriteIfNewer", cfg.OverwriteIfNewer},
+		{"VerifyResume", cfg.VerifyResume},
+	}
+	var unsupported []string
+	for _, o := range options {
+		if o.set {
+			unsupported = append(unsupported, o.name)
+		}
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("Config.Sink não funciona com %s (opções que precisam do arquivo local)", strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// Prepara o Sink como o openOutput prepara o arquivo: sempre do zero, com o
+// tamanho final quando conhecido
+func openSink(cfg Config, info remoteInfo, chunkSize int64) (*partState, error) {
+	chunks := int64(1)
+	if info.Size != unknownSize {
+		if err := cfg.Sink.Truncate(info.Size); err != nil {
+			return nil, fmt.Errorf("erro ajustando tamanho do destino: %w", err)
+		}
+		chunks = chunkCount(info.Size, chunkSize)
+	}
+	return newPartState("", cfg.URL, info, chunkSize, chunks), nil
+}
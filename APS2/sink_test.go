@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Destino em memória, como o de quem usa o código como biblioteca
+type memSink struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func (s *memSink) WriteAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if end := off + int64(len(p)); end > int64(len(s.data)) {
+		s.data = append(s.data, make([]byte, end-int64(len(s.data)))...)
+	}
+	return copy(s.data[off:], p), nil
+}
+
+func (s *memSink) Truncate(size int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if size <= int64(len(s.data)) {
+		s.data = s.data[:size]
+	} else {
+		s.data = append(s.data, make([]byte, size-int64(len(s.data)))...)
+	}
+	return nil
+}
+
+func (s *memSink) bytes() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]byte(nil), s.data...)
+}
+
+func checkSinkDownload(t *testing.T, cfg Config, sink *memSink, data []byte) {
+	t.Helper()
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := sink.bytes(); !bytes.Equal(got, data) {
+		t.Fatalf("destino com %d bytes diferentes do original (%d bytes)", len(got), len(data))
+	}
+	// Sem arquivo local não há destino, .part nem .status
+	for _, path := range []string{cfg.Output, partPath(cfg.Output), statusPath(cfg.Output)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s criado num download com Config.Sink", path)
+		}
+	}
+}
+
+func TestSinkChunks(t *testing.T) {
+	data := testData(1<<20 + 7)
+	srv := newRangeServer(t, data)
+	cfg := testConfig(t, srv.fileURL())
+	sink := &memSink{}
+	cfg.Sink = sink
+
+	checkSinkDownload(t, cfg, sink, data)
+}
+
+// Sem Range o corpo inteiro vai para o destino pelo fluxo único
+func TestSinkSingleStream(t *testing.T) {
+	data := testData(100000)
+	srv := newFaultServer(t, data, faults{noRanges: true})
+	cfg := testConfig(t, srv.fileURL())
+	sink := &memSink{}
+	cfg.Sink = sink
+
+	checkSinkDownload(t, cfg, sink, data)
+}
+
+func TestSinkRejectsLocalOptions(t *testing.T) {
+	srv := newRangeServer(t, testData(1000))
+	cfg := testConfig(t, srv.fileURL())
+	cfg.Sink = &memSink{}
+	cfg.Checksum = strings.Repeat("0", 64)
+	cfg.Extract = true
+
+	_, _, err := runDownload(context.Background(), cfg)
+	if err == nil {
+		t.Fatal("Config.Sink aceito com Checksum e Extract")
+	}
+	for _, name := range []string{"Checksum", "Extract"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("erro %q não cita %s", err, name)
+		}
+	}
+	if n := countRanged(srv.Requests()); n != 0 {
+		t.Errorf("%d requisições de faixa antes de recusar as opções", n)
+	}
+}
+
+type alignedSink struct {
+	memSink
+	part int64
+}
+
+func (s *alignedSink) PartSize(int64) int64 {
+	return s.part
+}
+
+// Um destino com partes de tamanho fixo recebe chunks múltiplos da parte
+func TestSinkPartAlignment(t *testing.T) {
+	cfg := Config{Threads: 4, MinChunk: 1, Sink: &alignedSink{part: 3000}}
+	info := remoteInfo{Size: 10000, AcceptRanges: true}
+	if got := planChunkSize(cfg, &info); got != 3000 {
+		t.Errorf("chunks de %d bytes, esperados 3000 (2500 arredondado para a parte)", got)
+	}
+}
+
+// Um arquivo vazio zera o destino
+func TestZeroLengthSink(t *testing.T) {
+	srv := newRangeServer(t, nil)
+	cfg := testConfig(t, srv.fileURL())
+	sink := &memSink{data: []byte("lixo")}
+	cfg.Sink = sink
+
+	checkSinkDownload(t, cfg, sink, nil)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+)
+
+var (
+	errSizeChanged   = errors.New("o tamanho do arquivo remoto mudou durante o download")
+	errRemoteChanged = errors.New("o arquivo remoto mudou desde o início do download")
+)
+
+// Um 416 em uma faixa que era válida costuma significar que o arquivo
+// encolheu. Consulta o tamanho de novo e, se mudou, cancela os demais chunks
+// para que o download recomece com o tamanho correto.
+func (d *download) remoteSizeChanged() bool {
+	d.sizeMu.Lock()
+	defer d.sizeMu.Unlock()
+
+	if d.sizeChanged.Load() {
+		return true
+	}
+
+	// Quem chama já ocupa uma vaga no host; esperar outra poderia travar
+	// com -max-per-host 1
+	cfg := d.cfg
+	cfg.HostLimiter = nil
+	info, err := getFileSize(d.ctx, cfg, d.url)
+	if err != nil || info.Size == d.remoteSize {
+		return false
+	}
+
+	slog.Warn("Arquivo remoto mudou de tamanho", "antes", d.remoteSize, "agora", info.Size)
+	d.sizeChanged.Store(true)
+	d.cancel()
+	return true
+}
+
+// Com If-Range o servidor responde 200 com o arquivo inteiro em vez de 206
+// quando o arquivo mudou desde o download interrompido: os chunks já
+// gravados são de outra versão e o download precisa recomeçar do zero
+func (d *download) markRemoteChanged() {
+	if d.remoteChanged.CompareAndSwap(false, true) {
+		slog.Warn("Arquivo remoto mudou desde o download interrompido", "ifRange", d.ifRange)
+		d.cancel()
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// Um arquivo que encolhe no meio do download: a faixa do fim recebe 416, o
+// tamanho é consultado de novo e o download recomeça com o tamanho novo
+func TestSizeShrinksMidDownload(t *testing.T) {
+	data := testData(10000)
+	const shrunk = 7500
+
+	var mu sync.Mutex
+	current := data
+	heads, rejected := 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if r.Method == http.MethodHead {
+			heads++
+		}
+		// O pedido da última faixa encontra o arquivo já menor
+		start, _, ranged := requestedRange(r.Header.Get("Range"), int64(len(current)))
+		if ranged && start >= shrunk {
+			current = data[:shrunk]
+			rejected++
+		}
+		body := current
+		mu.Unlock()
+		serveRange(w, r, body)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(t, srv.URL+"/arquivo.bin")
+	size, _, err := runDownload(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != shrunk {
+		t.Errorf("tamanho %d, esperado o novo %d", size, shrunk)
+	}
+	checkFile(t, cfg.Output, data[:shrunk])
+
+	mu.Lock()
+	defer mu.Unlock()
+	if rejected == 0 {
+		t.Fatal("nenhuma faixa recebeu 416")
+	}
+	// Consulta inicial, nova consulta depois do 416 e a do recomeço
+	if heads < 3 {
+		t.Errorf("%d consultas de tamanho, esperada nova consulta depois do 416 e no recomeço", heads)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Com -output - o arquivo é enviado para a saída padrão. Como os chunks
+// chegam fora de ordem, o download é feito em um arquivo temporário (em
+// TMPDIR) e copiado para a saída ao final. Um buffer de reordenação em
+// memória começaria a enviar antes, mas com um chunk lento poderia precisar
+// guardar quase o arquivo inteiro; o temporário só exige espaço em disco.
+func runToStdout(ctx context.Context, cfg Config) error {
+	tmp, err := os.CreateTemp("", "aps2-*.download")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	defer os.Remove(partPath(tmp.Name()))
+
+	// O checksum é gravado aqui, com "-" no lugar do nome do temporário,
+	// como faz o sha256sum ao ler da entrada padrão
+	checksumOutput := cfg.ChecksumOutput
+	cfg.Output = tmp.Name()
+	cfg.Force = true
+	cfg.ChecksumOutput = ""
+	if _, _, err := runWithTimeout(ctx, cfg); err != nil {
+		return err
+	}
+	if checksumOutput != "" {
+		sum, err := fileDigest(cfg.Output, cfg.algo())
+		if err != nil {
+			return err
+		}
+		if err := writeChecksumFile(checksumOutput, cfg.algo(), sum, "-"); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Open(cfg.Output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(os.Stdout, f); err != nil {
+		return fmt.Errorf("erro escrevendo na saída padrão: %w", err)
+	}
+	return nil
+}
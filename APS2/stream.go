@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Baixa o arquivo inteiro em uma única requisição, para servidores sem
+// suporte a Range. Como os bytes chegam em ordem, o hash é calculado durante
+// a cópia, sem precisar ler o arquivo de novo.
+func (d *download) downloadSingleStream(size int64) error {
+	// Para os Hooks o fluxo é um chunk só, do começo ao fim do arquivo
+	last := size - 1
+	if size == unknownSize {
+		last = unknownSize
+	}
+	began := time.Now()
+	d.cfg.Hooks.chunkStart(0, last)
+
+	for attempt := 1; ; attempt++ {
+		if d.cfg.Usage.exceeded() {
+			return errDataCap
+		}
+		ctx, span := d.cfg.tracer().Start(d.ctx, "attempt")
+		span.SetAttr("attempt", attempt)
+		err := d.fetchStream(ctx, size)
+		span.End(err)
+		if err == nil {
+			d.cfg.Hooks.chunkDone(0, last, d.written.Load(), time.Since(began))
+			return nil
+		}
+
+		// A próxima tentativa continua de d.streamOffset com "Range:
+		// bytes=N-" (REST no FTP). Recomeça do zero quando o tamanho é
+		// desconhecido ou o corpo veio descompactado (streamResumable), e
+		// também quando o servidor ignora o Range, o If-Range não confere ou
+		// o FTP recusa o REST.
+		if attempt == d.cfg.chunkAttempts() || d.ctx.Err() != nil || !d.retryable(err) {
+			return err
+		}
+
+		d.cfg.Hooks.retry(0, last, attempt, err)
+		delay := d.cfg.retryWait(attempt, err)
+		slog.Warn("Download falhou, tentando novamente", "tentativa", attempt, "maximo", d.cfg.chunkAttempts(), "erro", err, "espera", delay)
+		d.cfg.Metrics.retry()
+		if err := sleepContext(d.ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+func (d *download) fetchStream(ctx context.Context, size int64) error {
+	release, err := d.cfg.HostLimiter.acquire(ctx, d.url)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sw := newSectionWriter(d.file, d.streamOffset, &d.written)
+	wd := startWatchdog(d.cfg.IdleTimeout, d.cfg.RequestTimeout, sw.pos, d.cfg.Pause.Paused, cancel)
+	defer wd.stop()
+
+	d.active.Add(1)
+	defer d.active.Add(-1)
+
+	err = d.fetchStreamTo(ctx, sw, size)
+	if ferr := sw.flush(); ferr != nil && err == nil {
+		err = fmt.Errorf("erro gravando arquivo: %w", ferr)
+	}
+	if err != nil {
+		if d.streamResumable(size) {
+			// A próxima tentativa continua do último byte gravado
+			d.streamOffset = sw.flushed()
+		} else {
+			// A próxima tentativa recomeça do zero
+			d.written.Add(-sw.flushed())
+			d.streamOffset = 0
+		}
+		if wd.stalled.Load() {
+			return fmt.Errorf("download sem progresso por %s", d.cfg.IdleTimeout)
+		}
+		if wd.expired.Load() {
+			return fmt.Errorf("requisição passou do tempo limite de %s", d.cfg.RequestTimeout)
+		}
+	}
+	return err
+}
+
+// Só dá para continuar o fluxo único com o tamanho conhecido e os bytes
+// gravados exatamente como o servidor os enviou
+func (d *download) streamResumable(size int64) bool {
+	return size != unknownSize && !d.streamUncompressed
+}
+
+// Abre o fluxo único por HTTP, continuando de d.streamOffset quando dá.
+// uncompressed indica que o transporte descompactou o corpo.
+func (d *download) openHTTPStream(ctx context.Context, sw *sectionWriter, size int64) (body io.ReadCloser, uncompressed bool, err error) {
+	req, err := newRequest(ctx, d.cfg, "GET", d.url)
+	if err != nil {
+		return nil, false, fmt.Errorf("erro criando requisição: %w", err)
+	}
+	offset := d.streamOffset
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if d.streamIfRange != "" {
+			req.Header.Set("If-Range", d.streamIfRange)
+		}
+		slog.Info("Continuando o download", "bytes", offset, "total", size)
+	}
+
+	resp, err := d.cfg.httpClient().Do(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("erro no download: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		if offset > 0 {
+			// Range ignorado, ou If-Range não confere: o corpo é o arquivo
+			// inteiro e substitui o que foi gravado
+			slog.Warn("Servidor não continuou o download, recomeçando do zero", "bytes", offset)
+			d.written.Add(-offset)
+			d.streamOffset, offset = 0, 0
+			sw.seek(0)
+		}
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		crStart, _, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil || crStart != offset || total != size {
+			d.written.Add(-offset)
+			d.streamOffset = 0
+			sw.seek(0)
+			resp.Body.Close()
+			return nil, false, fmt.Errorf("Content-Range inesperado ao continuar o download: %q", resp.Header.Get("Content-Range"))
+		}
+	default:
+		if offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			d.written.Add(-offset)
+			d.streamOffset = 0
+			sw.seek(0)
+		}
+		resp.Body.Close()
+		return nil, false, newStatusError(resp, "resposta inesperada: %s", resp.Status)
+	}
+	return resp.Body, resp.Uncompressed, nil
+}
+
+func (d *download) fetchStreamTo(ctx context.Context, sw *sectionWriter, size int64) error {
+	var (
+		body         io.ReadCloser
+		uncompressed bool
+		err          error
+	)
+	if isFTP(d.url) {
+		body, err = d.openFTPStream(ctx, sw)
+	} else {
+		body, uncompressed, err = d.openHTTPStream(ctx, sw, size)
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	offset := d.streamOffset
+
+	h := newHash(d.cfg.algo())
+	if offset > 0 {
+		// O hash do arquivo começa pelos bytes que já estavam no disco. Só
+		// um arquivo local é retomado, nunca um Config.Sink.
+		prefix, ok := d.file.(io.ReaderAt)
+		if !ok {
+			return errors.New("destino não permite ler o início do arquivo")
+		}
+		if _, err := io.Copy(h, io.NewSectionReader(prefix, 0, offset)); err != nil {
+			return fmt.Errorf("erro lendo o início do arquivo: %w", err)
+		}
+	}
+
+	// O transporte do Go descompacta sozinho respostas gzip quando não há
+	// Range; aí o tamanho final não é o Content-Length informado. Sem
+	// tamanho conhecido o corpo também é lido até o fim.
+	if uncompressed || size == unknownSize {
+		d.streamUncompressed = uncompressed
+		n, err := d.copyBody(sw, io.TeeReader(body, h))
+		if err != nil {
+			return fmt.Errorf("erro copiando arquivo: %w", err)
+		}
+		if err := d.file.Truncate(n); err != nil {
+			return err
+		}
+		if uncompressed {
+			slog.Info("Conteúdo descompactado pelo transporte", "bytes", n)
+		}
+		d.streamDigest = hex.EncodeToString(h.Sum(nil))
+		return nil
+	}
+
+	n, err := d.copyBody(sw, io.TeeReader(io.LimitReader(body, size-offset), h))
+	if err != nil {
+		return fmt.Errorf("erro copiando arquivo: %w", err)
+	}
+	if n != size-offset {
+		return fmt.Errorf("recebidos %d de %d bytes", offset+n, size)
+	}
+	if err := d.checkTrailing(body, offset, size-1); err != nil {
+		return err
+	}
+
+	d.streamDigest = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
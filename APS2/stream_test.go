@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Fluxo único de srv para um arquivo temporário, sem passar pelo
+// runDownload, para conferir o digest calculado durante a cópia
+func streamDownload(t *testing.T, cfg Config, size int64) *download {
+	t.Helper()
+	f, err := os.Create(cfg.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	d := &download{
+		ctx:        ctx,
+		cancel:     cancel,
+		cfg:        cfg,
+		url:        cfg.URL,
+		size:       size,
+		remoteSize: size,
+		file:       f,
+		policy:     newServerPolicy(remoteInfo{}),
+		mirrors:    newMirrorSet([]string{cfg.URL}),
+	}
+	if err := d.fetchStream(ctx, size); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// O digest sai da própria cópia: mudar o arquivo depois não muda o
+// resultado, porque ele não é lido de novo
+func TestStreamDigest(t *testing.T) {
+	data := testData(100000)
+	srv := newFaultServer(t, data, faults{noRanges: true})
+
+	sha := sha256.Sum256(data)
+	sum := md5.Sum(data)
+	tests := []struct {
+		algo, want string
+	}{
+		{"", hex.EncodeToString(sha[:])},
+		{"md5", hex.EncodeToString(sum[:])},
+	}
+	for _, tt := range tests {
+		cfg := testConfig(t, srv.fileURL())
+		cfg.Algo = tt.algo
+		d := streamDownload(t, cfg, int64(len(data)))
+		checkFile(t, cfg.Output, data)
+
+		if err := os.WriteFile(cfg.Output, []byte("outro conteúdo"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := d.digest(cfg.algo())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: digest %s, esperado o do fluxo %s", cfg.algo(), got, tt.want)
+		}
+	}
+}
+
+// O digest do fluxo é comparado com -checksum: o certo passa, o errado
+// falha o download
+func TestStreamChecksum(t *testing.T) {
+	data := testData(100000)
+	srv := newFaultServer(t, data, faults{noRanges: true})
+	sum := sha256.Sum256(data)
+	good := hex.EncodeToString(sum[:])
+
+	cfg := testConfig(t, srv.fileURL())
+	cfg.Checksum = strings.ToUpper(good)
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+
+	cfg = testConfig(t, srv.fileURL())
+	cfg.Checksum = strings.Repeat("0", 64)
+	_, _, err := runDownload(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "checksum não confere") {
+		t.Fatalf("erro %v, esperado checksum não confere", err)
+	}
+	if !strings.Contains(err.Error(), good) {
+		t.Errorf("erro %q não mostra o digest obtido", err)
+	}
+}
+
+// Servidor sem Range nem Content-Length, que envia o corpo em pedaços com
+// Transfer-Encoding: chunked. Com drop, a primeira resposta cai no meio.
+func newChunkedServer(t *testing.T, data []byte, drop bool) (string, func() []string) {
+	var mu sync.Mutex
+	var requests []string
+	dropped := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, strings.TrimSpace(r.Method+" "+r.Header.Get("Range")))
+		cut := drop && !dropped && r.Method == http.MethodGet && r.Header.Get("Range") == ""
+		if cut {
+			dropped = true
+		}
+		mu.Unlock()
+		if r.Method == http.MethodHead {
+			return
+		}
+		for off := 0; off < len(data); off += 4096 {
+			if cut && off >= len(data)/2 {
+				panic(http.ErrAbortHandler)
+			}
+			w.Write(data[off:min(off+4096, len(data))])
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/arquivo.bin", func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), requests...)
+	}
+}
+
+// Sem tamanho informado, o arquivo cresce conforme o corpo chega e o tamanho
+// final é o que foi recebido
+func TestChunkedUnknownSize(t *testing.T) {
+	data := testData(100000)
+	url, requests := newChunkedServer(t, data, false)
+	cfg := testConfig(t, url)
+
+	size, _, err := runDownload(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(data)) {
+		t.Errorf("tamanho %d, esperado o recebido %d", size, len(data))
+	}
+	checkFile(t, cfg.Output, data)
+	// O GET de teste do Range é ignorado e o arquivo vem num único GET
+	if got := requests(); !slices.Equal(got, []string{"HEAD", "GET bytes=0-0", "GET"}) {
+		t.Errorf("requisições %q, esperados a consulta e um único GET sem faixa", got)
+	}
+}
+
+// Sem o tamanho não há como continuar de onde parou: a nova tentativa
+// recomeça do zero e o arquivo fica só com o conteúdo dela
+func TestChunkedUnknownSizeRetry(t *testing.T) {
+	data := testData(100000)
+	url, requests := newChunkedServer(t, data, true)
+	cfg := testConfig(t, url)
+
+	size, _, err := runDownload(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(data)) {
+		t.Errorf("tamanho %d, esperado %d", size, len(data))
+	}
+	checkFile(t, cfg.Output, data)
+	if got := requests(); !slices.Equal(got, []string{"HEAD", "GET bytes=0-0", "GET", "GET"}) {
+		t.Errorf("requisições %q, esperada uma nova tentativa sem faixa", got)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import "context"
+
+// Rastreamento opcional dos downloads. O programa só depende desta
+// interface; a implementação com OpenTelemetry fica em tracing_otel.go e só
+// é compilada com -tags otel.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+type Span interface {
+	SetAttr(key string, value any)
+	End(err error)
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttr(key string, value any) {}
+func (noopSpan) End(err error)                 {}
+
+func (c Config) tracer() Tracer {
+	if c.Tracer != nil {
+		return c.Tracer
+	}
+	return noopTracer{}
+}
+
+// Configura o exportador a partir das variáveis OTEL_* do ambiente e devolve
+// a função que descarrega os spans pendentes. Nil quando compilado sem
+// suporte a OpenTelemetry.
+var setupTracing func(ctx context.Context) (Tracer, func(context.Context) error, error)
@@ -0,0 +1,66 @@
+//go:build otel
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func init() {
+	setupTracing = func(ctx context.Context) (Tracer, func(context.Context) error, error) {
+		exp, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp))
+		return NewOtelTracer(tp), tp.Shutdown, nil
+	}
+}
+
+// Adapta um TracerProvider do OpenTelemetry para o Tracer do programa
+func NewOtelTracer(tp trace.TracerProvider) Tracer {
+	return otelTracer{tp.Tracer("aps2")}
+}
+
+type otelTracer struct {
+	t trace.Tracer
+}
+
+func (o otelTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	ctx, span := o.t.Start(ctx, name)
+	return ctx, otelSpan{span}
+}
+
+type otelSpan struct {
+	s trace.Span
+}
+
+func (o otelSpan) SetAttr(key string, value any) {
+	switch v := value.(type) {
+	case string:
+		o.s.SetAttributes(attribute.String(key, v))
+	case int:
+		o.s.SetAttributes(attribute.Int(key, v))
+	case int64:
+		o.s.SetAttributes(attribute.Int64(key, v))
+	case bool:
+		o.s.SetAttributes(attribute.Bool(key, v))
+	default:
+		o.s.SetAttributes(attribute.String(key, fmt.Sprint(v)))
+	}
+}
+
+func (o otelSpan) End(err error) {
+	if err != nil {
+		o.s.RecordError(err)
+		o.s.SetStatus(codes.Error, err.Error())
+	}
+	o.s.End()
+}
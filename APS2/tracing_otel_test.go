@@ -0,0 +1,101 @@
+//go:build otel
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanAttr(s tracetest.SpanStub, key string) (attribute.Value, bool) {
+	for _, kv := range s.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+// Um span de download com um filho por chunk e, abaixo de cada chunk, um
+// por tentativa; a primeira requisição de faixa falha e gera uma tentativa
+// a mais
+func TestOtelSpanTree(t *testing.T) {
+	data := testData(10000)
+	var failed atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" && failed.CompareAndSwap(false, true) {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		serveRange(w, r, data)
+	}))
+	defer srv.Close()
+
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	cfg := testConfig(t, srv.URL+"/arquivo.bin")
+	cfg.Tracer = NewOtelTracer(tp)
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exp.GetSpans()
+	var root tracetest.SpanStub
+	children := map[string][]tracetest.SpanStub{}
+	for _, s := range spans {
+		if !s.Parent.IsValid() {
+			root = s
+			continue
+		}
+		parent := s.Parent.SpanID().String()
+		children[parent] = append(children[parent], s)
+	}
+
+	if root.Name != "download" {
+		t.Fatalf("span raiz %q, esperado download", root.Name)
+	}
+	if v, _ := spanAttr(root, "size"); v.AsInt64() != int64(len(data)) {
+		t.Errorf("size do download = %v, esperado %d", v.Emit(), len(data))
+	}
+	if v, _ := spanAttr(root, "status"); v.AsString() != outcomeCompleted {
+		t.Errorf("status do download = %q", v.AsString())
+	}
+
+	chunks := children[root.SpanContext.SpanID().String()]
+	if len(chunks) != 4 {
+		t.Fatalf("%d spans de chunk, esperados 4", len(chunks))
+	}
+	attempts, errored := 0, 0
+	var bytesTotal int64
+	for _, c := range chunks {
+		if c.Name != "chunk" {
+			t.Errorf("filho do download %q, esperado chunk", c.Name)
+		}
+		for _, a := range children[c.SpanContext.SpanID().String()] {
+			if a.Name != "attempt" {
+				t.Errorf("filho do chunk %q, esperado attempt", a.Name)
+			}
+			attempts++
+			if a.Status.Code == codes.Error {
+				errored++
+			}
+			v, _ := spanAttr(a, "bytes")
+			bytesTotal += v.AsInt64()
+		}
+	}
+	if attempts != 5 || errored != 1 {
+		t.Errorf("%d tentativas com %d erros, esperadas 5 com 1 erro", attempts, errored)
+	}
+	if bytesTotal != int64(len(data)) {
+		t.Errorf("tentativas somam %d bytes, esperados %d", bytesTotal, len(data))
+	}
+}
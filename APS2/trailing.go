@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// O que fazer quando o servidor envia mais bytes do que a faixa pedida
+const (
+	trailingDiscard = "discard"
+	trailingWarn    = "warn"
+	trailingError   = "error"
+)
+
+// Com -trailing error o chunk já está completo quando o excesso aparece: uma
+// nova tentativa o daria por baixado, então o erro encerra o download
+var errTrailingData = errors.New("servidor enviou bytes além da faixa")
+
+func validTrailingMode(mode string) bool {
+	switch mode {
+	case trailingDiscard, trailingWarn, trailingError:
+		return true
+	}
+	return false
+}
+
+// Chamada depois de gravar exatamente os bytes esperados: o que sobrar no
+// corpo nunca é gravado, para não sobrescrever a região do chunk vizinho
+func (d *download) checkTrailing(body io.Reader, start, end int64) error {
+	if d.cfg.Trailing == trailingDiscard {
+		return nil
+	}
+
+	extra, err := io.Copy(io.Discard, body)
+	if err != nil || extra == 0 {
+		return nil
+	}
+
+	if d.cfg.Trailing == trailingError {
+		return fmt.Errorf("%w: %d bytes além de %d-%d", errTrailingData, extra, start, end)
+	}
+	slog.Warn("Servidor enviou bytes além da faixa, descartados", "extras", extra, "inicio", start, "fim", end)
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Servidor que envia lixo depois de cada faixa pedida, sem Content-Length,
+// como os que ignoram o fim do Range
+func newTrailingServer(t *testing.T, data []byte, extra int) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start, end, ranged := requestedRange(r.Header.Get("Range"), int64(len(data)))
+		if !ranged || r.Method != http.MethodGet {
+			serveRange(w, r, data)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[start : end+1])
+		w.Write(bytes.Repeat([]byte{0xff}, extra))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// Os bytes além da faixa nunca chegam ao arquivo, em nenhum modo: o
+// conteúdo dos chunks vizinhos fica intacto
+func TestTrailingNeverWritten(t *testing.T) {
+	data := testData(10000)
+	srv := newTrailingServer(t, data, 500)
+
+	for _, mode := range []string{trailingDiscard, trailingWarn} {
+		cfg := testConfig(t, srv.URL+"/arquivo.bin")
+		cfg.Trailing = mode
+		if _, _, err := runDownload(context.Background(), cfg); err != nil {
+			t.Fatalf("-trailing %s: %v", mode, err)
+		}
+		checkFile(t, cfg.Output, data)
+	}
+}
+
+// Com -trailing error o excesso falha o download, sem nova tentativa que
+// daria o chunk já completo por baixado
+func TestTrailingError(t *testing.T) {
+	data := testData(10000)
+	srv := newTrailingServer(t, data, 500)
+
+	cfg := testConfig(t, srv.URL+"/arquivo.bin")
+	cfg.Trailing = trailingError
+	_, _, err := runDownload(context.Background(), cfg)
+	if !errors.Is(err, errTrailingData) || !strings.Contains(err.Error(), "500 bytes") {
+		t.Fatalf("erro %v, esperado %v com 500 bytes", err, errTrailingData)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// Lê a URL de -proxy. O transporte do Go já sabe falar com proxies HTTP,
+// HTTPS e SOCKS5.
+func parseProxy(raw string) (*url.URL, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("proxy inválido %q: %w", raw, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("proxy inválido %q: use http://, https:// ou socks5://", raw)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy inválido %q: falta o host", raw)
+	}
+	return u, nil
+}
+
+// Carrega o bundle de CAs de -cacert (PEM), usado no lugar das CAs do sistema
+func loadCertPool(path string) (*x509.CertPool, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("erro lendo -cacert: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("nenhum certificado PEM válido em %s", path)
+	}
+	return pool, nil
+}
+
+// Cliente HTTP compartilhado por todas as requisições de um download (e de
+// todos os arquivos com -input ou -manifest), com um único pool de conexões. Sem
+// -proxy valem HTTP_PROXY, HTTPS_PROXY e NO_PROXY, como no transporte padrão.
+func newHTTPClient(cfg Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.Proxy != nil {
+		transport.Proxy = http.ProxyURL(cfg.Proxy)
+	}
+	if cfg.RootCAs != nil || cfg.Insecure {
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs:            cfg.RootCAs,
+			InsecureSkipVerify: cfg.Insecure,
+		}
+	}
+
+	// O padrão do Go mantém só 2 conexões ociosas por host: com mais threads
+	// as demais são fechadas ao fim de cada requisição e reabertas na próxima
+	transport.MaxIdleConnsPerHost = cfg.idleConnsPerHost()
+	transport.MaxIdleConns = max(transport.MaxIdleConns, transport.MaxIdleConnsPerHost)
+	transport.MaxConnsPerHost = cfg.MaxConnsPerHost
+
+	// Um mapa não nil em TLSNextProto impede o transporte de negociar h2 via
+	// ALPN; sem -http1 o HTTP/2 é usado quando o servidor oferece
+	if cfg.HTTP1 {
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	if cfg.ConnectStagger > 0 || cfg.Prefer != "" || cfg.DNSCache {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		var gate *dialGate
+		if cfg.ConnectStagger > 0 {
+			gate = &dialGate{interval: cfg.ConnectStagger}
+		}
+		var cache *dnsCache
+		if cfg.DNSCache {
+			cache = newDNSCache()
+		}
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if gate != nil {
+				if err := gate.wait(ctx); err != nil {
+					return nil, err
+				}
+			}
+			network = dialNetwork(network, cfg.Prefer)
+			if cache != nil {
+				return cache.dial(ctx, dialer, network, addr)
+			}
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+
+	return &http.Client{Transport: transport, CheckRedirect: redirectPolicy(cfg)}
+}
+
+// Requisições curtas (consulta de tamanho, sondagens, manifesto e arquivos
+// de checksum), com o -request-timeout valendo até o corpo ser fechado. Cada
+// uma ocupa uma vaga do -max-per-host até o corpo ser fechado, como as
+// faixas; quem ainda tem um corpo aberto não deve fazer outra no mesmo
+// host. As faixas e o fluxo único não passam por aqui: o tempo delas é
+// controlado pelo watchdog, que desconta as pausas.
+func (cfg Config) do(req *http.Request) (*http.Response, error) {
+	// A espera pela vaga não conta para o tempo limite
+	release, err := cfg.HostLimiter.acquire(req.Context(), req.URL.String())
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if cfg.RequestTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, cfg.RequestTimeout)
+	}
+	resp, err := cfg.httpClient().Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		release()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: func() {
+		cancel()
+		release()
+	}}
+	return resp, nil
+}
+
+// Corpo que encerra o contexto da requisição e libera a vaga no host ao ser
+// fechado, uma vez só mesmo com Close repetido
+type cancelBody struct {
+	io.ReadCloser
+	cancel func()
+	once   sync.Once
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.cancel)
+	return err
+}
+
+// Valores aceitos por -prefer
+const (
+	preferAuto = "auto"
+	preferIPv4 = "ip4"
+	preferIPv6 = "ip6"
+)
+
+func parsePrefer(value string) (string, error) {
+	switch value {
+	case preferAuto:
+		return "", nil
+	case preferIPv4, preferIPv6:
+		return value, nil
+	}
+	return "", fmt.Errorf("valor inválido para -prefer: %s (use ip4, ip6 ou auto)", value)
+}
+
+// Restringe a conexão TCP à família de endereços de -prefer. Sem preferência
+// o Go tenta IPv6 e IPv4 em paralelo (Happy Eyeballs).
+func dialNetwork(network, prefer string) string {
+	if network != "tcp" {
+		return network
+	}
+	switch prefer {
+	case preferIPv4:
+		return "tcp4"
+	case preferIPv6:
+		return "tcp6"
+	}
+	return network
+}
+
+func (c Config) idleConnsPerHost() int {
+	if c.MaxIdleConns > 0 {
+		return c.MaxIdleConns
+	}
+	if c.AutoThreads || c.Threads <= 0 {
+		return autoMaxThreads
+	}
+	return max(int(c.Threads), http.DefaultMaxIdleConnsPerHost)
+}
+
+// Espaça a abertura de novas conexões, e com isso os handshakes TLS, para
+// não abrir todas ao mesmo tempo no início do download. Conexões reutilizadas
+// não passam por aqui.
+type dialGate struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func (g *dialGate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	now := time.Now()
+	at := g.next
+	if at.Before(now) {
+		at = now
+	}
+	g.next = at.Add(g.interval)
+	g.mu.Unlock()
+
+	return sleepContext(ctx, at.Sub(now))
+}
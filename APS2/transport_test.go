@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Intervalos entre instantes consecutivos, em ordem
+func gaps(times []time.Time) []time.Duration {
+	slices.SortFunc(times, time.Time.Compare)
+	var d []time.Duration
+	for i := 1; i < len(times); i++ {
+		d = append(d, times[i].Sub(times[i-1]))
+	}
+	return d
+}
+
+func TestDialGateSpreadsStarts(t *testing.T) {
+	const interval = 30 * time.Millisecond
+	g := &dialGate{interval: interval}
+
+	var mu sync.Mutex
+	var started []time.Time
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := g.wait(context.Background()); err != nil {
+				t.Error(err)
+			}
+			mu.Lock()
+			started = append(started, time.Now())
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	// Um timer que dispara atrasado encurta o intervalo seguinte: cada
+	// intervalo tem folga e o tempo total confere o espaçamento
+	var total time.Duration
+	for i, d := range gaps(started) {
+		if d < interval/2 {
+			t.Errorf("conexões %d e %d abertas com %s de intervalo, esperado %s", i, i+1, d, interval)
+		}
+		total += d
+	}
+	if want := time.Duration(len(started)-1) * interval; total < want-10*time.Millisecond {
+		t.Errorf("%d conexões abertas em %s, esperado pelo menos %s", len(started), total, want)
+	}
+}
+
+func TestDialGateCanceled(t *testing.T) {
+	g := &dialGate{interval: time.Hour}
+	g.wait(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := g.wait(ctx); err == nil {
+		t.Error("espera pela vaga não parou com o contexto cancelado")
+	}
+}
+
+// Com -connect-stagger as conexões dos chunks chegam ao servidor espaçadas
+func TestConnectStaggerDownload(t *testing.T) {
+	data := testData(100000)
+	var mu sync.Mutex
+	var opened []time.Time
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Respostas lentas: cada chunk precisa da própria conexão, sem
+		// reaproveitar a de outro
+		if r.Method == http.MethodGet {
+			time.Sleep(200 * time.Millisecond)
+		}
+		serveRange(w, r, data)
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			opened = append(opened, time.Now())
+			mu.Unlock()
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	const stagger = 50 * time.Millisecond
+	cfg := testConfig(t, srv.URL+"/arquivo.bin")
+	cfg.ConnectStagger = stagger
+	cfg.Client = newHTTPClient(cfg)
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(opened) < int(cfg.Threads) {
+		t.Fatalf("%d conexões abertas, esperadas pelo menos %d", len(opened), cfg.Threads)
+	}
+	// O servidor vê a conexão um pouco depois do dial, com atraso variável:
+	// cada intervalo tem folga e o tempo total confere o espaçamento
+	var total time.Duration
+	for i, d := range gaps(opened) {
+		if d < stagger/2 {
+			t.Errorf("conexões %d e %d abertas com %s de intervalo, esperado %s", i, i+1, d, stagger)
+		}
+		total += d
+	}
+	if want := time.Duration(len(opened)-1) * stagger; total < want-20*time.Millisecond {
+		t.Errorf("%d conexões abertas em %s, esperado pelo menos %s", len(opened), total, want)
+	}
+}
+
+func TestIdleConnsPerHost(t *testing.T) {
+	tests := []struct {
+		cfg  Config
+		want int
+	}{
+		{Config{Threads: 8}, 8},
+		{Config{Threads: 1}, http.DefaultMaxIdleConnsPerHost},
+		{Config{Threads: 8, AutoThreads: true}, autoMaxThreads},
+		{Config{}, autoMaxThreads},
+		{Config{Threads: 8, MaxIdleConns: 2}, 2},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.idleConnsPerHost(); got != tt.want {
+			t.Errorf("%+v: %d conexões ociosas por host, esperadas %d", tt.cfg, got, tt.want)
+		}
+	}
+
+	tr := newHTTPClient(Config{Threads: 32, MaxConnsPerHost: 4}).Transport.(*http.Transport)
+	if tr.MaxIdleConnsPerHost != 32 || tr.MaxIdleConns < 32 || tr.MaxConnsPerHost != 4 {
+		t.Errorf("transporte com %d ociosas por host, %d no total e %d por host, esperado 32, >= 32 e 4",
+			tr.MaxIdleConnsPerHost, tr.MaxIdleConns, tr.MaxConnsPerHost)
+	}
+}
+
+// Servidor que entrega no máximo 1000 bytes por faixa, para o download
+// fazer muitas requisições a um host, e registra o pico de conexões
+// simultâneas
+func newPoolServer(t *testing.T, data []byte) (url string, peak func() int) {
+	var mu sync.Mutex
+	open, highest := 0, 0
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerMaxRange, "1000")
+		serveRange(w, r, data)
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch state {
+		case http.StateNew:
+			open++
+			highest = max(highest, open)
+		case http.StateClosed, http.StateHijacked:
+			open--
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv.URL + "/arquivo.bin", func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return highest
+	}
+}
+
+// Conexões abertas no servidor, esperando até valerem want: o cliente
+// fecha as que não cabem no pool depois de devolvê-las, e o servidor só vê o
+// fechamento um pouco depois
+func waitOpenConns(t *testing.T, open func() int, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for open() != want && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := open(); got != want {
+		t.Errorf("%d conexões abertas no servidor, esperadas %d", got, want)
+	}
+}
+
+// Os chunks esperam uns pelos outros no servidor, então cada thread usa a
+// própria conexão. Ao final o pool guarda uma conexão ociosa por thread no
+// padrão, e só -max-idle-conns com o valor informado: as demais são fechadas.
+func TestMaxIdleConnsReuse(t *testing.T) {
+	data := testData(10000)
+	tests := []struct {
+		idle int
+		kept int
+	}{
+		{0, 4},
+		{2, 2},
+		{1, 1},
+	}
+	for _, tt := range tests {
+		var mu sync.Mutex
+		open, arrived := 0, 0
+		all := make(chan struct{})
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if start, end, ok := requestedRange(r.Header.Get("Range"), int64(len(data))); ok && end > start {
+				mu.Lock()
+				if arrived++; arrived == 4 {
+					close(all)
+				}
+				mu.Unlock()
+				select {
+				case <-all:
+				case <-time.After(5 * time.Second):
+				}
+			}
+			serveRange(w, r, data)
+		}))
+		srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+			mu.Lock()
+			defer mu.Unlock()
+			switch state {
+			case http.StateNew:
+				open++
+			case http.StateClosed, http.StateHijacked:
+				open--
+			}
+		}
+		srv.Start()
+		defer srv.Close()
+
+		cfg := testConfig(t, srv.URL+"/arquivo.bin")
+		cfg.MaxIdleConns = tt.idle
+		cfg.Client = newHTTPClient(cfg)
+		if _, _, err := runDownload(context.Background(), cfg); err != nil {
+			t.Fatal(err)
+		}
+		checkFile(t, cfg.Output, data)
+
+		waitOpenConns(t, func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return open
+		}, tt.kept)
+		cfg.Client.CloseIdleConnections()
+	}
+}
+
+// -max-conns-per-host limita as conexões abertas ao mesmo tempo, mesmo com
+// mais threads
+func TestMaxConnsPerHost(t *testing.T) {
+	data := testData(100000)
+	url, peak := newPoolServer(t, data)
+	cfg := testConfig(t, url)
+	cfg.Threads = 8
+	cfg.MaxConnsPerHost = 2
+	cfg.Client = newHTTPClient(cfg)
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+	cfg.Client.CloseIdleConnections()
+
+	if n := peak(); n > cfg.MaxConnsPerHost {
+		t.Errorf("%d conexões simultâneas com -max-conns-per-host %d", n, cfg.MaxConnsPerHost)
+	}
+}
+
+// Servidor TLS com HTTP/2 habilitado que atende faixas e registra o
+// protocolo de cada requisição
+func newTLSRangeServer(tb testing.TB, data []byte) (url string, protos func() []string) {
+	var mu sync.Mutex
+	var seen []string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Proto)
+		mu.Unlock()
+		serveRange(w, r, data)
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	tb.Cleanup(srv.Close)
+	return srv.URL + "/arquivo.bin", func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), seen...)
+	}
+}
+
+// Sem -http1 o cliente negocia HTTP/2 quando o servidor oferece; com a
+// opção todas as requisições são HTTP/1.1
+func TestHTTP1(t *testing.T) {
+	data := testData(100000)
+	url, protos := newTLSRangeServer(t, data)
+
+	for _, http1 := range []bool{false, true} {
+		cfg := testConfig(t, url)
+		cfg.Insecure = true
+		cfg.HTTP1 = http1
+		cfg.Client = newHTTPClient(cfg)
+		before := len(protos())
+		if _, _, err := runDownload(context.Background(), cfg); err != nil {
+			t.Fatal(err)
+		}
+		checkFile(t, cfg.Output, data)
+
+		want := "HTTP/2.0"
+		if http1 {
+			want = "HTTP/1.1"
+		}
+		for _, p := range protos()[before:] {
+			if p != want {
+				t.Errorf("-http1=%v: requisição em %s, esperado %s", http1, p, want)
+			}
+		}
+	}
+}
+
+// Download de 32MB com 8 threads por HTTP/2 (uma conexão multiplexada) e
+// com -http1 (uma conexão por chunk): go test -bench HTTP1. Em loopback não
+// há perda nem latência, então a diferença é só o custo da multiplexação.
+func BenchmarkHTTP1(b *testing.B) {
+	data := testData(32 << 20)
+	url, _ := newTLSRangeServer(b, data)
+	for _, http1 := range []bool{false, true} {
+		name := "http2"
+		if http1 {
+			name = "http1"
+		}
+		b.Run(name, func(b *testing.B) {
+			cfg := testConfig(b, url)
+			cfg.Threads = 8
+			cfg.Insecure = true
+			cfg.HTTP1 = http1
+			cfg.Client = newHTTPClient(cfg)
+			b.SetBytes(int64(len(data)))
+			for b.Loop() {
+				os.Remove(cfg.Output)
+				if _, _, err := runDownload(context.Background(), cfg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Lê uma URL por linha, ignorando linhas em branco e comentários com #
+func parseURLList(r io.Reader) ([]string, error) {
+	var urls []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, scanner.Err()
+}
+
+// Baixa cada URL do arquivo de -input, com até cfg.MaxConcurrentFiles
+// arquivos ao mesmo tempo. Cada arquivo recebe o nome extraído da própria URL.
+func runURLList(ctx context.Context, cfg Config, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	urls, err := parseURLList(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Lista de URLs carregada", "arquivos", len(urls), "simultaneos", max(cfg.MaxConcurrentFiles, 1))
+
+	var (
+		mu     sync.Mutex
+		failed []string
+	)
+	pool := newFilePool(cfg.MaxConcurrentFiles)
+	for _, rawURL := range urls {
+		fileCfg := cfg
+		fileCfg.URL = rawURL
+		fileCfg.Output = getFileName(rawURL)
+
+		pool.Go(func() {
+			if _, _, err := runWithTimeout(ctx, fileCfg); err != nil {
+				slog.Error("Erro baixando URL da lista", "url", rawURL, "erro", err)
+				mu.Lock()
+				failed = append(failed, rawURL)
+				mu.Unlock()
+			}
+		})
+	}
+	pool.Wait()
+
+	slog.Info("Lista concluída", "baixados", len(urls)-len(failed), "falhas", len(failed), "arquivos", len(urls))
+	if len(failed) > 0 {
+		return fmt.Errorf("falha em %d arquivos: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Cancela a requisição de um chunk quando nenhum byte novo é gravado
+// durante o tempo de ociosidade, pegando conexões que enviam poucos bytes
+// por minuto e escapam do timeout por requisição. Também aplica o
+// -request-timeout às requisições de faixa e do fluxo único, no lugar do
+// Timeout do http.Client, que continuaria correndo com o download pausado.
+// O tempo em pausa não conta para nenhum dos dois.
+type watchdog struct {
+	stalled atomic.Bool
+	// A requisição passou de -request-timeout
+	expired atomic.Bool
+	done    chan struct{}
+}
+
+func startWatchdog(idle, timeout time.Duration, progress func() int64, paused func() bool, cancel context.CancelFunc) *watchdog {
+	w := &watchdog{done: make(chan struct{})}
+	if idle <= 0 && timeout <= 0 {
+		return w
+	}
+
+	interval := time.Duration(0)
+	for _, limit := range []time.Duration{idle, timeout} {
+		if limit > 0 && (interval == 0 || limit/4 < interval) {
+			interval = limit / 4
+		}
+	}
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last := progress()
+		lastChange := time.Now()
+		lastTick := lastChange
+		var elapsed time.Duration
+		for {
+			select {
+			case <-w.done:
+				return
+			case now := <-ticker.C:
+				isPaused := paused()
+				if !isPaused {
+					elapsed += now.Sub(lastTick)
+				}
+				lastTick = now
+				if timeout > 0 && elapsed >= timeout {
+					w.expired.Store(true)
+					cancel()
+					return
+				}
+				if idle <= 0 {
+					continue
+				}
+				if cur := progress(); cur != last || isPaused {
+					last = cur
+					lastChange = now
+				} else if now.Sub(lastChange) >= idle {
+					w.stalled.Store(true)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return w
+}
+
+func (w *watchdog) stop() {
+	close(w.done)
+}
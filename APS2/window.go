@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Com -range-start ou -range-end só uma janela do arquivo remoto é baixada
+func (cfg Config) hasWindow() bool {
+	return cfg.RangeStart > 0 || cfg.RangeEnd > 0
+}
+
+// Confere os valores de -range-start e -range-end antes de qualquer
+// requisição
+func checkWindow(start, end int64) error {
+	if start < 0 || end < 0 {
+		return errors.New("-range-start e -range-end não podem ser negativos")
+	}
+	if end > 0 && end < start {
+		return fmt.Errorf("-range-end (%d) antes de -range-start (%d)", end, start)
+	}
+	return nil
+}
+
+// Primeiro e último byte da janela no arquivo remoto de total bytes. Sem
+// -range-end a janela vai até o fim do arquivo.
+func (cfg Config) byteWindow(total int64) (start, end int64, err error) {
+	if total == unknownSize {
+		return 0, 0, errors.New("servidor não informou o tamanho do arquivo, necessário para -range-start e -range-end")
+	}
+	start, end = cfg.RangeStart, cfg.RangeEnd
+	if end == 0 {
+		end = total - 1
+	}
+	if start >= total || end >= total {
+		return 0, 0, fmt.Errorf("faixa %d-%d fora do arquivo remoto de %d bytes", start, end, total)
+	}
+	return start, end, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Atributos estendidos gravados no arquivo com -xattr, para que a origem e o
+// checksum acompanhem o arquivo
+const (
+	xattrChecksum = "user.aps2.sha256"
+	xattrURL      = "user.aps2.url"
+	// Tamanho e mtime do arquivo quando o checksum foi gravado
+	xattrStamp = "user.aps2.stamp"
+)
+
+var errXattrUnsupported = errors.New("atributos estendidos não suportados neste sistema")
+
+func fileStamp(fi os.FileInfo) string {
+	return strconv.FormatInt(fi.Size(), 10) + ":" + strconv.FormatInt(fi.ModTime().UnixNano(), 10)
+}
+
+// Grava a URL de origem e o checksum nos atributos estendidos do arquivo
+func writeProvenance(path, url, checksum string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	for _, attr := range [][2]string{
+		{xattrURL, url},
+		{xattrChecksum, checksum},
+		{xattrStamp, fileStamp(fi)},
+	} {
+		if err := setXattr(path, attr[0], attr[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checksum gravado por -xattr, válido só se o arquivo não mudou desde então
+// (mesmo tamanho e mtime)
+func cachedChecksum(path string) (string, bool) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", false
+	}
+	stamp, err := getXattr(path, xattrStamp)
+	if err != nil || stamp != fileStamp(fi) {
+		return "", false
+	}
+	sum, err := getXattr(path, xattrChecksum)
+	if err != nil || sum == "" {
+		return "", false
+	}
+	return sum, true
+}
+
+// SHA-256 do arquivo, usando o valor dos atributos estendidos quando o
+// arquivo não mudou
+func fileChecksumCached(path string) (string, error) {
+	if sum, ok := cachedChecksum(path); ok {
+		return sum, nil
+	}
+	return fileChecksum(path)
+}
+
+// Grava a origem no arquivo ao final do download; falhas só geram aviso
+func (d *download) storeProvenance(output string) {
+	var sum string
+	var err error
+	if output == d.cfg.Output {
+		sum, err = d.digest(defaultAlgo)
+	} else {
+		// Descompactado: o digest do download não é o do arquivo final
+		sum, err = fileChecksum(output)
+	}
+	if err != nil {
+		slog.Warn("Não foi possível calcular o checksum para -xattr", "erro", err)
+		return
+	}
+
+	err = writeProvenance(output, d.cfg.URL, sum)
+	if errors.Is(err, errXattrUnsupported) {
+		slog.Warn("-xattr ignorado", "erro", err)
+	} else if err != nil {
+		slog.Warn("Não foi possível gravar os atributos estendidos", "arquivo", output, "erro", err)
+	}
+}
+
+// Modo -verify: confere um arquivo já baixado, sem recalcular o checksum se
+// os atributos estendidos ainda valem
+func verifyFile(path, algo, expected string) error {
+	var sum string
+	var cached bool
+	if algo == defaultAlgo {
+		// Os atributos estendidos só guardam o SHA-256
+		sum, cached = cachedChecksum(path)
+	}
+	if !cached {
+		var err error
+		if sum, err = fileDigest(path, algo); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("%s  %s\n", sum, path)
+	if url, err := getXattr(path, xattrURL); err == nil {
+		fmt.Printf("Origem: %s\n", url)
+	}
+	if cached {
+		fmt.Println("Checksum lido dos atributos estendidos (arquivo inalterado)")
+	}
+
+	if expected == "" {
+		return nil
+	}
+	if expected = strings.ToLower(strings.TrimSpace(expected)); sum != expected {
+		return fmt.Errorf("checksum não confere: esperado %s, obtido %s", expected, sum)
+	}
+	fmt.Println("Checksum verificado")
+	return nil
+}
@@ -0,0 +1,28 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+func setXattr(path, name, value string) error {
+	err := syscall.Setxattr(path, name, []byte(value), 0)
+	if errors.Is(err, syscall.ENOTSUP) {
+		return errXattrUnsupported
+	}
+	return err
+}
+
+func getXattr(path, name string) (string, error) {
+	buf := make([]byte, 4096)
+	n, err := syscall.Getxattr(path, name, buf)
+	if errors.Is(err, syscall.ENOTSUP) {
+		return "", errXattrUnsupported
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(buf[:n]), nil
+}
@@ -0,0 +1,91 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Arquivo temporário num diretório com atributos estendidos; pula o teste
+// se o sistema de arquivos não suportar
+func xattrFile(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "arquivo.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := setXattr(path, "user.aps2.teste", "1"); errors.Is(err, errXattrUnsupported) {
+		t.Skip(err)
+	} else if err != nil {
+		t.Skipf("atributos estendidos indisponíveis: %v", err)
+	}
+	return path
+}
+
+// A origem e o checksum gravados são lidos de volta enquanto o arquivo não
+// muda; o checksum em cache é usado sem recalcular
+func TestProvenanceRoundTrip(t *testing.T) {
+	path := xattrFile(t, testData(10000))
+	const url = "https://exemplo.com/arquivo.bin"
+	// Diferente do conteúdo: só aparece se vier dos atributos
+	fake := strings.Repeat("ab", 32)
+	if err := writeProvenance(path, url, fake); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := getXattr(path, xattrURL); err != nil || got != url {
+		t.Errorf("URL %q, %v; esperado %q", got, err, url)
+	}
+	if sum, ok := cachedChecksum(path); !ok || sum != fake {
+		t.Errorf("checksum em cache %q, %v; esperado %q", sum, ok, fake)
+	}
+	if sum, err := fileChecksumCached(path); err != nil || sum != fake {
+		t.Errorf("fileChecksumCached = %q, %v; esperado o do cache", sum, err)
+	}
+
+	// Com o mtime alterado o cache deixa de valer
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if sum, ok := cachedChecksum(path); ok {
+		t.Errorf("checksum %q em cache para um arquivo alterado", sum)
+	}
+	if err := verifyFile(path, defaultAlgo, fake); err == nil {
+		t.Error("-verify aceitou o checksum antigo de um arquivo alterado")
+	}
+}
+
+// Com -xattr o download grava a URL e o SHA-256 do arquivo baixado
+func TestXattrDownload(t *testing.T) {
+	data := testData(10000)
+	srv := newRangeServer(t, data)
+	// O arquivo de saída fica no mesmo sistema de arquivos temporário
+	xattrFile(t, nil)
+	cfg := testConfig(t, srv.fileURL())
+	cfg.Xattr = true
+
+	if _, _, err := runDownload(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, cfg.Output, data)
+
+	sum := sha256.Sum256(data)
+	if got, ok := cachedChecksum(cfg.Output); !ok || got != hex.EncodeToString(sum[:]) {
+		t.Errorf("checksum gravado %q, %v; esperado %x", got, ok, sum)
+	}
+	if got, _ := getXattr(cfg.Output, xattrURL); got != cfg.URL {
+		t.Errorf("URL gravada %q, esperado %q", got, cfg.URL)
+	}
+	if err := verifyFile(cfg.Output, defaultAlgo, hex.EncodeToString(sum[:])); err != nil {
+		t.Error(err)
+	}
+}